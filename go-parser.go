@@ -9,16 +9,29 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
+	"math"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/user"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -27,26 +40,182 @@ import (
 	"github.com/paulfdunn/go-parser/parser"
 )
 
+// countingWriter counts the rows (newlines) and bytes written to w. w may be nil to discard output.
+type countingWriter struct {
+	bytes int64
+	rows  int64
+	w     io.Writer
+}
+
+// fileResult is the result of processing a single data file. When consolidating output, output
+// is a temporary file in the dataDirectory holding the parsed output for the file; see
+// consolidateOutput. renameErrors are errors renaming output files to remove
+// the lockedFileSuffix; those output files are left with the lockedFileSuffix. checksum is the
+// hex SHA256 of the data file when flags.checksum is set. timings are the stage timings when
+// flags.stageTimings is set. errors is the number of errors counted by the Scanner, and hashes
+// the unique hashes, for the run summary.
+type fileResult struct {
+	checksum     string
+	dataFilePath string
+	errors       int
+	hashes       []string
+	output       *os.File
+	outputBytes  int64
+	outputRows   int64
+	renameErrors []error
+	timings      *stageTimings
+}
+
+// outputSchema is written to the schema file, describing the parsed output columns.
+// UniqueId is true when the unique ID is output as the first column. SqlColumns is the number of
+// VALUES in SQL output, which are the Columns followed by the extracts, truncated or padded
+// with NULL, and followed by the SqlProvenanceColumns.
+type outputSchema struct {
+	parser.Schema
+	OutputFormat         string
+	SqlColumns           int
+	SqlProvenanceColumns []string
+	UniqueId             bool
+}
+
+// runSummary is output as a single line of JSON when processing completes, with the totals for
+// all data files processed, for scripting. Hashes is the number of unique hashes across all data
+// files; hashes is the set of those hashes.
+type runSummary struct {
+	Files      int
+	Rows       int64
+	Errors     int
+	Hashes     int
+	DurationMs int64
+	hashes     map[string]bool
+}
+
+// add adds the results of data files to the totals.
+func (summary *runSummary) add(results ...fileResult) {
+	for _, result := range results {
+		summary.Files++
+		summary.Rows += result.outputRows
+		summary.Errors += result.errors
+		if summary.hashes == nil {
+			summary.hashes = make(map[string]bool)
+		}
+		for _, hash := range result.hashes {
+			summary.hashes[hash] = true
+		}
+	}
+	summary.Hashes = len(summary.hashes)
+}
+
+// String returns the summary as a single line of JSON.
+func (summary runSummary) String() string {
+	b, err := json.Marshal(summary)
+	if err != nil {
+		lpf(logh.Error, "calling Marshal: %s", err)
+	}
+	return string(b)
+}
+
+// removeOutput closes and removes the temporary output file, when there is one.
+func (result *fileResult) removeOutput() {
+	if result.output == nil {
+		return
+	}
+	result.output.Close()
+	os.Remove(result.output.Name())
+	result.output = nil
+}
+
+// renameUnlocked renames the file at lockedFilePath, removing the lockedFileSuffix, when rename
+// is true. The unlocked path is returned. Errors are logged and added to the renameErrors.
+func (result *fileResult) renameUnlocked(lockedFilePath string, rename bool) string {
+	unlockedFilePath := strings.TrimSuffix(lockedFilePath, lockedFileSuffix)
+	if !rename {
+		return unlockedFilePath
+	}
+	if err := os.Rename(lockedFilePath, unlockedFilePath); err != nil {
+		lpf(logh.Error, "calling os.Rename, output file left locked: %s", err)
+		result.renameErrors = append(result.renameErrors, err)
+	}
+	return unlockedFilePath
+}
+
+// rowOutput pairs a RowFormatter with the writer for the formatted rows. When stdout is true
+// the formatted rows are also printed to STDOUT.
+type rowOutput struct {
+	formatter parser.RowFormatter
+	stdout    bool
+	writer    io.StringWriter
+}
+
 type flags struct {
+	appendHashes        bool
+	checksum            bool
+	consolidatedAppend  bool
+	consolidatedFile    string
+	dataFileName        string
 	dataFilePath        string
+	dryRun              bool
+	errorsFile          bool
+	extractCoverage     bool
 	hashFormat          parser.HashFormat
+	limiter             *parser.RateLimiter
+	maxMemory           int
+	maxOpenFiles        int
+	mergeColumn         int
+	mergeFile           string
+	noMove              bool
+	outputFormat        string
+	recent              *recentRows
+	runId               string
+	runIdColumn         bool
 	sqlite3FilePath     string
+	sqlite3Retries      int
+	sqlite3RetryBackoff time.Duration
 	sqlDataTable        string
 	sqlHashTable        string
 	sqlColumns          int
+	splitUniqueId       bool
+	splitUniqueIdOpen   int
+	spoolLiveRows       bool
+	sorted              bool
+	stableInterval      time.Duration
+	stageTimings        bool
 	stdout              bool
+	syslog              *syslogWriter
+	taggedExtracts      *taggedExtractWriters
+	tee                 bool
 	threads             int
+	timings             *stageTimings
 	uniqueId            string
-	uniqueIdRegexString string
+	uniqueIdRegex       *regexp.Regexp
 }
 
 const (
 	appName          = "go-parser"
 	lockedFileSuffix = "locked"
 
+	errorsFileSuffix       = ".errors.txt"
+	gzipFileSuffix         = ".gz"
 	hashesOutputFileSuffix = ".hashes.txt"
 	hashesOutputDelimiter  = "|"
+	messageTypesFileSuffix = ".messagetypes.txt"
 	parsedOutputFileSuffix = ".parsed.txt"
+	schemaFileSuffix       = ".schema.json"
+	sqlOutputFileSuffix    = ".parsed.sql"
+	// taggedExtractsFileSuffix follows the data file name and the Extract OutputTag.
+	taggedExtractsFileSuffix = ".extracts.txt"
+
+	outputFormatCsv       = "csv"
+	outputFormatDelimited = "delimited"
+	outputFormatNdjson    = "ndjson"
+
+	// maxOutputRowSize is the maximum size of a row of output read back by mergeSorted and
+	// spooledRows, rather than the bufio.Scanner default; output rows can be longer than input
+	// lines, as extracted values repeat the input.
+	maxOutputRowSize = math.MaxInt32
+
+	sqlTransactionBegin = "PRAGMA busy_timeout = 10000; BEGIN IMMEDIATE TRANSACTION;"
+	sqlTransactionEnd   = "END TRANSACTION;"
 )
 
 var (
@@ -54,18 +223,48 @@ var (
 	lpf func(logh.LoghLevel, string, ...any)
 
 	// CLI flags
-	dataFilePtr      *string
-	inputFilePtr     *string
-	logFilePtr       *string
-	logLevel         *int
-	sqlite3FilePtr   *string
-	sqlDataTablePtr  *string
-	sqlHashTablePtr  *string
-	sqlColumnsPtr    *int
-	stdoutPtr        *bool
-	threadsPtr       *int
-	uniqueIdPtr      *string
-	uniqueIdRegexPtr *string
+	appendHashesPtr   *bool
+	checksumPtr       *bool
+	consolidatedPtr   *string
+	dataFilePtr       *string
+	dryRunPtr         *bool
+	dumpConfigPtr     *bool
+	errorsFilePtr     *bool
+	extractCovPtr     *bool
+	inputFilePtr      *string
+	logFilePtr        *string
+	logLevel          *int
+	maxMemoryPtr      *int
+	maxOpenFilesPtr   *int
+	mergeColumnPtr    *int
+	mergeFilePtr      *string
+	noMovePtr         *bool
+	outputFormatPtr   *string
+	quietPtr          *bool
+	recentAddrPtr     *string
+	recentRowsPtr     *int
+	runIdPtr          *bool
+	sqlite3BackoffPtr *time.Duration
+	sqlite3FilePtr    *string
+	sqlite3RetriesPtr *int
+	sqlDataTablePtr   *string
+	sqlHashTablePtr   *string
+	sqlColumnsPtr     *int
+	splitUniqueIdPtr  *bool
+	splitOpenPtr      *int
+	sortedPtr         *bool
+	stablePtr         *time.Duration
+	stageTimingsPtr   *bool
+	stdoutPtr         *bool
+	summaryPtr        *bool
+	syslogPtr         *string
+	syslogFacPtr      *string
+	syslogSevPtr      *string
+	teePtr            *bool
+	threadsPtr        *int
+	uniqueIdPtr       *string
+	uniqueIdRegexPtr  *string
+	verifyHashesPtr   *string
 
 	// dataDirectorySuffix is appended to the users home directory.
 	dataDirectorySuffix = filepath.Join(`tmp`, appName)
@@ -98,20 +297,69 @@ func main() {
 		fmt.Printf("Error creating data directory: : %s", err)
 	}
 
-	dataFilePtr = flag.String("datafile", "", "Path to data file. Overrides input file DataDirectory.")
+	appendHashesPtr = flag.Bool("appendhashes", false, "Merge hash counts into any existing hashes output file, instead of overwriting it, so counts accumulate across runs; the hashes file is written as hash|count|value. Not used with SQL output.")
+	checksumPtr = flag.Bool("checksum", false, "Compute the SHA256 checksum of each data file as it is read, and log it with the file results.")
+	consolidatedPtr = flag.String("consolidatedfile", "", "When processing a directory, write the parsed output for all files to this file in "+dataDirectory+
+		", in filename order, instead of one output file per data file. Hashes are still output per data file. When watching the DataDirectory, the output of each sweep is appended.")
+	dataFilePtr = flag.String("datafile", "", "Path to data file, or an http(s) URL to read the data from without downloading it first. Overrides input file DataDirectory.")
+	dryRunPtr = flag.Bool("dryrun", false, "Process the data and report the number of output rows and bytes, without writing output files.")
+	dumpConfigPtr = flag.Bool("dumpconfig", false, "Print the resolved inputs as JSON, then exit.")
+	errorsFilePtr = flag.Bool("errorsfile", false, "Write the errors for each data file (I.E. lines with an unexpected number of fields, extract errors), "+
+		"with the line number and line, to a file with suffix "+errorsFileSuffix+", in addition to the log.")
+	extractCovPtr = flag.Bool("extractcoverage", false, "Log an extraction coverage report for each data file: for each Extract and column, "+
+		"the number of rows where the Extract was attempted and matched. Columns where an Extract never matched are marked. Use with dryrun to tune Extracts.")
 	inputFilePtr = flag.String("inputfile", "", "Path to json file with inputs. See ./inputs/exampleInputs.json.")
 	logFilePtr = flag.String("logfile", "", "Name of log file in "+dataDirectory+"; blank to print logs to terminal.")
 	logLevel = flag.Int("loglevel", int(logh.Info), fmt.Sprintf("Logging level; default %d. Zero based index into: %v",
 		int(logh.Info), logh.DefaultLevels))
+	maxMemoryPtr = flag.Int("maxmemory", 0, "Memory limit in MB. When memory in use approaches the limit, hashes are spilled to a file, "+
+		"output is flushed, and reading is paused, to reduce memory use. Inputs.HashCollisionPolicy only applies to hashes in memory "+
+		"since the last spill. Zero for no limit.")
+	maxOpenFilesPtr = flag.Int("maxopenfiles", 0, "When processing a directory, the maximum number of files open at once across all threads; threads "+
+		"wait for files to be closed before processing another data file. Zero for no limit.")
+	mergeColumnPtr = flag.Int("mergecolumn", 1, "Used with mergefile to specify the column of the parsed output by which rows are ordered; "+
+		"column 0 is the unique ID. Numeric values are compared as numbers, otherwise values are compared as strings.")
+	mergeFilePtr = flag.String("mergefile", "", "When processing a directory of files that are each ordered by time, merge the parsed output for all "+
+		"files into this file in "+dataDirectory+", ordered by mergecolumn. The merge is streamed, so memory use does not depend on file size. "+
+		"Only used with delimited output, and not with consolidatedfile.")
+	noMovePtr = flag.Bool("nomove", false, "Leave input files in place, overriding Inputs.ProcessedInputDirectory; the DataDirectory is processed once.")
+	outputFormatPtr = flag.String("outputformat", outputFormatDelimited, fmt.Sprintf("Format of the parsed output, one of: %s, %s, %s. Not used for SQL output, except with tee.",
+		outputFormatDelimited, outputFormatCsv, outputFormatNdjson))
+	quietPtr = flag.Bool("quiet", false, "Suppress the debug and info logs while processing data files; warnings and errors are still logged. Use with summary for scripting.")
+	recentAddrPtr = flag.String("recentaddr", "", "When not empty, the most recent parsed rows are kept in memory and served at this address "+
+		"(I.E. localhost:8080) via GET "+recentPath+"?n=100.")
+	recentRowsPtr = flag.Int("recentrows", 1000, "Used with recentaddr to specify the number of recent parsed rows kept in memory.")
+	runIdPtr = flag.Bool("runid", false, "Output the run ID, which is generated at startup and logged, as a column after the data columns, "+
+		"and with Inputs.SqlProvenance as the run_id provenance column, to correlate output files, logs, and SQL rows from a run.")
+	sqlite3BackoffPtr = flag.Duration("sqlite3backoff", time.Second, "Delay before the first sqlite3 import retry; the delay doubles for each retry.")
 	sqlite3FilePtr = flag.String("sqlite3file", "", "Fully qualified path to a sqlite3 database file that has tables already created. Output files will be imported into sqlite3 then deleted.")
+	sqlite3RetriesPtr = flag.Int("sqlite3retries", 3, "Number of times to retry a failed sqlite3 import. Output files are not deleted when the import fails.")
 	sqlDataTablePtr = flag.String("sqldatatable", "data", "Used with sqlColumnsPtr to specify the table in which to import pased data; the table should already exist.")
 	sqlHashTablePtr = flag.String("sqlhashtable", "hash", "Used with sqlColumnsPtr to specify the table in which to import the hash table; the table should already exist.")
 	sqlColumnsPtr = flag.Int("sqlcolumns", 0, "When > 0, output parsed data as SQL INSERT INTO statements, instead of delimited data. The value specifies the maximum number of columns output in the VALUES clause.")
+	splitUniqueIdPtr = flag.Bool("splituniqueid", false, "Write the output for each unique ID to its own file, <DATA_FILE_NAME>.<uniqueId>"+parsedOutputFileSuffix+". "+
+		"The uniqueidregex is applied to every row, so the unique ID can change within the data file. Rows before a unique ID is found are written to the parsed output file.")
+	splitOpenPtr = flag.Int("splituniqueidopen", 16, "Used with splituniqueid to specify the maximum number of unique ID output files that are open at once.")
+	sortedPtr = flag.Bool("sorted", false, "When processing a directory, process files one at a time in filename order, so repeated runs produce identical output. Overrides threads.")
+	stablePtr = flag.Duration("stableinterval", 0, "When watching the DataDirectory, only process files whose size and modification time "+
+		"have not changed for this interval (I.E. 10s), so files still being written are not processed and moved. 0 processes all files.")
+	stageTimingsPtr = flag.Bool("stagetimings", false, "Time each pipeline stage (scan, preprocess, filter, replace, split, extract, hash, write) "+
+		"and log a report of the time spent in each stage for each data file, for performance tuning.")
 	stdoutPtr = flag.Bool("stdout", false, "Output parsed data to STDOUT (in addition to file output)")
+	summaryPtr = flag.Bool("summary", false, "When processing completes, print a single line of JSON to STDOUT with the number of files, "+
+		"output rows, errors, and unique hashes, and the duration in milliseconds. Not printed when watching the DataDirectory.")
+	syslogPtr = flag.String("syslog", "", "When not empty, parsed rows are also forwarded, in the outputformat, as RFC5424 messages to this syslog "+
+		"endpoint: "+syslogLocal+" for "+syslogLocalPath+", or udp://host:port or tcp://host:port.")
+	syslogFacPtr = flag.String("syslogfacility", "user", "Used with syslog to specify the facility name, I.E. user, daemon, or local0 - local7.")
+	syslogSevPtr = flag.String("syslogseverity", "info", "Used with syslog to specify the severity name, I.E. err, warning, notice, info, or debug.")
+	teePtr = flag.Bool("tee", false, "Used with sqlcolumns to write delimited output to the parsed output file and SQL output to a file with suffix "+
+		sqlOutputFileSuffix+", in one pass. The SQL output is the file imported into sqlite3. Not used with consolidatedfile.")
 	threadsPtr = flag.Int("threads", 6, "Threads to use when processing a directory")
 	uniqueIdPtr = flag.String("uniqueid", "", "Unique ID that is output with each parsed row.")
 	uniqueIdRegexPtr = flag.String("uniqueidregex", "", "Regex that will be called on the input data to find a unique ID that "+
-		"is output with each parsed row. Overrides uniqueid parameter")
+		"is output with each parsed row; the unique ID is the first capture group. Overrides uniqueid parameter")
+	verifyHashesPtr = flag.String("verifyhashes", "", "Path to a hashes output file (not SQL) to verify; the hash of each value is recomputed "+
+		"and compared to the stored hash, using the hash format for sqlcolumns. Mismatches are printed, then exit; the exit code is non-zero if there are mismatches.")
 	flag.Usage = func() {
 		w := flag.CommandLine.Output()
 		fmt.Fprintf(w, "Usage of %s: note that parsed output will be written to %s, "+
@@ -133,31 +381,150 @@ func main() {
 	lpf = logh.Map[appName].Printf
 	lpf(logh.Debug, "user.Current(): %+v", usr)
 	lpf(logh.Info, "Data and logs being saved to directory: %s", dataDirectory)
+	start := time.Now()
+	runId := newRunId()
+	lpf(logh.Info, "run ID: %s", runId)
 
 	inputs, err := parser.NewInputs(*inputFilePtr)
 	if err != nil {
 		lpf(logh.Error, "calling NewInputs: %s", err)
 		os.Exit(7)
 	}
-
+	if *dumpConfigPtr {
+		b, err := inputs.MarshalResolved()
+		if err != nil {
+			lpf(logh.Error, "calling MarshalResolved: %s", err)
+			os.Exit(7)
+		}
+		fmt.Println(string(b))
+		logh.ShutdownAll()
+		return
+	}
 	hashFormat := parser.HASH_FORMAT_STRING
 	if *sqlColumnsPtr > 0 {
 		hashFormat = parser.HASH_FORMAT_SQL
 	}
+	if *verifyHashesPtr != "" {
+		if !verifyHashes(*verifyHashesPtr, hashFormat) {
+			os.Exit(13)
+		}
+		logh.ShutdownAll()
+		return
+	}
+
+	if *teePtr && (*sqlColumnsPtr <= 0 || *consolidatedPtr != "") {
+		lp(logh.Error, "tee requires sqlcolumns > 0 and cannot be used with consolidatedfile")
+		os.Exit(7)
+	}
+
+	switch *outputFormatPtr {
+	case outputFormatCsv, outputFormatDelimited, outputFormatNdjson:
+	default:
+		lpf(logh.Error, "invalid outputformat: %s", *outputFormatPtr)
+		os.Exit(7)
+	}
+
+	if *mergeFilePtr != "" && (*sqlColumnsPtr > 0 || *consolidatedPtr != "" || *outputFormatPtr != outputFormatDelimited) {
+		lp(logh.Error, "mergefile requires delimited output and cannot be used with sqlcolumns or consolidatedfile")
+		os.Exit(7)
+	}
+
+	// Reordered rows are not in line order, so line numbers in the errors file, and unique IDs, which
+	// apply to the rows following the row they are found in, would be wrong.
+	if inputs.ReorderWindow > 0 && (*errorsFilePtr || *uniqueIdRegexPtr != "") {
+		lp(logh.Error, "errorsfile and uniqueidregex cannot be used with Inputs.ReorderWindow")
+		os.Exit(7)
+	}
+
+	// The uniqueidregex is compiled once, as it may be applied to every row; see splituniqueid.
+	var uniqueIdRegex *regexp.Regexp
+	if *uniqueIdRegexPtr != "" {
+		uniqueIdRegex, err = regexp.Compile(*uniqueIdRegexPtr)
+		if err != nil {
+			lpf(logh.Error, "invalid uniqueidregex: %s", err)
+			os.Exit(7)
+		}
+		// The unique ID is the first capture group.
+		if uniqueIdRegex.NumSubexp() < 1 {
+			lpf(logh.Error, "invalid uniqueidregex, it has no capture group: %s", *uniqueIdRegexPtr)
+			os.Exit(7)
+		}
+	}
+
 	flags := flags{
+		appendHashes:        *appendHashesPtr,
+		checksum:            *checksumPtr,
+		consolidatedFile:    *consolidatedPtr,
 		dataFilePath:        *dataFilePtr,
+		dryRun:              *dryRunPtr,
+		errorsFile:          *errorsFilePtr,
+		extractCoverage:     *extractCovPtr,
 		hashFormat:          hashFormat,
+		maxMemory:           *maxMemoryPtr,
+		maxOpenFiles:        *maxOpenFilesPtr,
+		mergeColumn:         *mergeColumnPtr,
+		mergeFile:           *mergeFilePtr,
+		noMove:              *noMovePtr,
+		outputFormat:        *outputFormatPtr,
+		runId:               runId,
+		runIdColumn:         *runIdPtr,
 		sqlite3FilePath:     *sqlite3FilePtr,
+		sqlite3Retries:      *sqlite3RetriesPtr,
+		sqlite3RetryBackoff: *sqlite3BackoffPtr,
 		sqlDataTable:        *sqlDataTablePtr,
 		sqlHashTable:        *sqlHashTablePtr,
 		sqlColumns:          *sqlColumnsPtr,
+		splitUniqueId:       *splitUniqueIdPtr,
+		splitUniqueIdOpen:   *splitOpenPtr,
+		sorted:              *sortedPtr,
+		stableInterval:      *stablePtr,
+		stageTimings:        *stageTimingsPtr,
 		stdout:              *stdoutPtr,
+		tee:                 *teePtr,
 		threads:             *threadsPtr,
 		uniqueId:            *uniqueIdPtr,
-		uniqueIdRegexString: *uniqueIdRegexPtr,
+		uniqueIdRegex:       uniqueIdRegex,
+	}
+
+	if *recentAddrPtr != "" {
+		if *recentRowsPtr <= 0 {
+			lp(logh.Error, "recentrows must be > 0")
+			os.Exit(7)
+		}
+		flags.recent = newRecentRows(*recentRowsPtr)
+		mux := http.NewServeMux()
+		mux.Handle(recentPath, flags.recent)
+		go func() {
+			lpf(logh.Info, "serving recent rows at: %s%s", *recentAddrPtr, recentPath)
+			if err := http.ListenAndServe(*recentAddrPtr, mux); err != nil {
+				lpf(logh.Error, "calling ListenAndServe: %s", err)
+			}
+		}()
+	}
+
+	// Output is paced across all threads.
+	if inputs.MaxRowsPerSecond > 0 {
+		flags.limiter = parser.NewRateLimiter(inputs.MaxRowsPerSecond)
+		lpf(logh.Info, "output limited to %d rows per second", inputs.MaxRowsPerSecond)
+	}
+
+	if *syslogPtr != "" {
+		flags.syslog, err = newSyslogWriter(*syslogPtr, *syslogFacPtr, *syslogSevPtr)
+		if err != nil {
+			lpf(logh.Error, "calling newSyslogWriter: %s", err)
+			os.Exit(7)
+		}
+		defer flags.syslog.close()
+		lpf(logh.Info, "forwarding parsed rows to syslog: %s", *syslogPtr)
+	}
+
+	// Startup is logged as usual; the logs for each data file are suppressed in quiet mode.
+	if *quietPtr {
+		lp, lpf = quietLoggers(lp, lpf)
 	}
 
 	// The `datafile` CLI parameter overrides the Inputs.DataDirectory.
+	var summary runSummary
 	if *dataFilePtr == "" && inputs.DataDirectory != "" {
 		if _, err := os.Stat(inputs.DataDirectory); os.IsNotExist(err) {
 			lpf(logh.Error, "inputs.DataDirectory does not exist: %s", err)
@@ -170,52 +537,182 @@ func main() {
 			os.Exit(6)
 		}
 
-		// If inputs.ProcessedInputDirectory is empty, only process the DataDirectory once.
-		// Otherwise watch the DataDirectory, forever.
+		// If inputs.ProcessedInputDirectory is empty, or files are not moved, only process the
+		// DataDirectory once. Otherwise watch the DataDirectory, forever, reading it for each sweep.
+		watch := inputs.ProcessedInputDirectory != "" && !flags.noMove
+		var stable *stableFiles
+		if watch && flags.stableInterval > 0 {
+			stable = newStableFiles(flags.stableInterval)
+		}
 		loops := 0
 		for {
-			parseFileEngine(inputs, files, flags)
-			if inputs.ProcessedInputDirectory == "" {
+			if stable != nil {
+				files = stable.filter(files, time.Now())
+			}
+			// A sweep with no files to process writes no output, I.E. an empty consolidated file.
+			if len(files) > 0 || !watch {
+				results, _ := parseFileEngine(inputs, files, flags)
+				// The summary is not output when watching, so is not kept.
+				if !watch {
+					summary.add(results...)
+				}
+				flags.consolidatedAppend = true
+			}
+			if !watch {
 				break
 			}
 			time.Sleep(time.Second)
 			if loops%60 == 0 {
 				lp(logh.Debug, "Waiting to process more input.")
 			}
+			loops++
+			if files, err = os.ReadDir(inputs.DataDirectory); err != nil {
+				lpf(logh.Error, "ReadDir error: %s", err)
+			}
 		}
 
 	} else {
-		parseFile(inputs, flags, flags.dataFilePath)
+		result, err := parseFile(inputs, flags, flags.dataFilePath)
+		if err != nil {
+			lpf(logh.Error, "calling parseFile for file: %s, error: %s", flags.dataFilePath, err)
+		}
+		summary.add(result)
 	}
 
 	lpf(logh.Info, "%s processing complete...", appName)
 	logh.ShutdownAll()
+	if *summaryPtr {
+		summary.DurationMs = time.Since(start).Milliseconds()
+		fmt.Println(summary.String())
+	}
+}
+
+// quietLoggers returns lp and lpf wrapped to drop logs below the Warning level, so only
+// warnings and errors are logged while processing data files.
+func quietLoggers(lp func(logh.LoghLevel, ...any), lpf func(logh.LoghLevel, string, ...any)) (func(logh.LoghLevel, ...any),
+	func(logh.LoghLevel, string, ...any)) {
+	quietLp := func(level logh.LoghLevel, v ...any) {
+		if level >= logh.Warning {
+			lp(level, v...)
+		}
+	}
+	quietLpf := func(level logh.LoghLevel, format string, v ...any) {
+		if level >= logh.Warning {
+			lpf(level, format, v...)
+		}
+	}
+	return quietLp, quietLpf
+}
+
+// Write counts the rows and bytes in p, and writes p to cw.w when not nil.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if cw.w != nil {
+		var err error
+		n, err = cw.w.Write(p)
+		if err != nil {
+			return n, err
+		}
+	}
+	cw.bytes += int64(n)
+	cw.rows += int64(bytes.Count(p[:n], []byte("\n")))
+	return n, nil
 }
 
 // parseFileEngine will use Go routines to start multiple instances of parseFile and process all
-// files in the Inputs.DataDirectory.
-func parseFileEngine(inputs *parser.Inputs, fileList []fs.DirEntry, flags flags) error {
-	tasks := make(chan string, flags.threads)
+// files in the Inputs.DataDirectory. The fileResults are returned in the order processing completed.
+// When flags.sorted is set, files are processed by a single Go routine in filename order, so
+// repeated runs produce the same results in the same order.
+func parseFileEngine(inputs *parser.Inputs, fileList []fs.DirEntry, flags flags) ([]fileResult, error) {
+	threads := flags.threads
+	if flags.sorted {
+		threads = 1
+		fileList = slices.Clone(fileList)
+		slices.SortFunc(fileList, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	}
+	type task struct {
+		file  string
+		index int
+	}
+	tasks := make(chan task, threads)
 	// Make sure the error buffer cannot fill up and cause a deadlock.
 	// errorOut := make(chan error, threads)
 
+	// When consolidating output, each file's output is written to a temporary file, and copied to
+	// the consolidated file in fileList order; pending holds output for files that completed out of
+	// order. When flags.consolidatedAppend is set (I.E. for later sweeps when watching the
+	// DataDirectory) the output is appended to the consolidated file, which is locked again while
+	// appending, so the output of earlier sweeps is kept.
+	var consolidatedFile *os.File
+	consolidatedFilePath := filepath.Join(dataDirectory, flags.consolidatedFile+lockedFileSuffix)
+	if flags.consolidatedFile != "" && !flags.dryRun {
+		flag := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+		if flags.consolidatedAppend {
+			flag = os.O_APPEND | os.O_CREATE | os.O_WRONLY
+			err := os.Rename(strings.TrimSuffix(consolidatedFilePath, lockedFileSuffix), consolidatedFilePath)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				lpf(logh.Error, "calling os.Rename: %s", err)
+				os.Exit(17)
+			}
+		}
+		var err error
+		consolidatedFile, err = os.OpenFile(consolidatedFilePath, flag, 0666)
+		lpf(logh.Info, "consolidated output file: %s", consolidatedFilePath)
+		if err != nil {
+			lpf(logh.Error, "calling os.OpenFile: %s", err)
+			os.Exit(17)
+		}
+	}
+	pending := make(map[int]*fileResult)
+	nextIndex := 0
+
+	var limiter *openFiles
+	if flags.maxOpenFiles > 0 {
+		limiter = newOpenFiles(flags.maxOpenFiles)
+	}
+
 	// Start number of Go Routines that will call s3mftDownloadFile
 	var wg sync.WaitGroup
-	for i := 0; i < flags.threads; i++ {
+	var resultsMutex sync.Mutex
+	results := make([]fileResult, 0, len(fileList))
+	for i := 0; i < threads; i++ {
 		wg.Add(1)
 		go func() {
-			for file := range tasks {
-				parseFile(inputs, flags, file)
+			for tsk := range tasks {
+				var acquired int
+				if limiter != nil {
+					acquired = limiter.acquire(filesPerDataFile(flags))
+				}
+				result, err := parseFile(inputs, flags, tsk.file)
+				if limiter != nil {
+					limiter.release(acquired)
+				}
+				if err != nil {
+					lpf(logh.Error, "calling parseFile for file: %s, error: %s", tsk.file, err)
+				}
+				resultsMutex.Lock()
+				results = append(results, result)
+				if consolidatedFile != nil {
+					pending[tsk.index] = &result
+					for next, ok := pending[nextIndex]; ok; next, ok = pending[nextIndex] {
+						if err := consolidateOutput(consolidatedFile, next); err != nil {
+							lpf(logh.Error, "writing consolidated output: %s", err)
+						}
+						delete(pending, nextIndex)
+						nextIndex++
+					}
+				}
+				resultsMutex.Unlock()
 			}
 			wg.Done()
 		}()
 	}
 
 	// Read the download list, line by line, feeding work to the Go routines started above.
-	for _, file := range fileList {
+	for index, file := range fileList {
 		fn := filepath.Join(inputs.DataDirectory, file.Name())
 		lpf(logh.Debug, "calling parseFile for file: %s", fn)
-		tasks <- fn
+		tasks <- task{file: fn, index: index}
 
 		// Need to prevent the error channel from filling up and blocking
 		// DONE:
@@ -237,65 +734,309 @@ func parseFileEngine(inputs *parser.Inputs, fileList []fs.DirEntry, flags flags)
 	// 	lpf(logh.Error, "file download error: %+v", e)
 	// }
 
-	return nil
+	if flags.mergeFile != "" && !flags.dryRun {
+		if err := mergeParsedOutput(inputs, fileList, flags); err != nil {
+			return results, err
+		}
+	}
+
+	if consolidatedFile != nil {
+		consolidatedFile.Close()
+		consolidatedFilePathUnlocked := strings.TrimSuffix(consolidatedFilePath, lockedFileSuffix)
+		if err := os.Rename(consolidatedFilePath, consolidatedFilePathUnlocked); err != nil {
+			lpf(logh.Error, "calling os.Rename, output file left locked: %s", err)
+			return results, err
+		}
+		if flags.sqlite3FilePath != "" {
+			if err := sqlite3ImportRetry(flags, consolidatedFilePathUnlocked); err != nil {
+				lpf(logh.Error, "sqlite3 import failed, output file retained: %s", consolidatedFilePathUnlocked)
+				return results, err
+			}
+			os.Remove(consolidatedFilePathUnlocked)
+		}
+	}
+
+	return results, nil
+}
+
+// consolidateOutput copies the temporary output file of the result, if any, to consolidatedFile,
+// and removes the temporary file.
+func consolidateOutput(consolidatedFile *os.File, result *fileResult) error {
+	if result.output == nil {
+		return nil
+	}
+	defer result.removeOutput()
+	if _, err := result.output.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(consolidatedFile, result.output)
+	return err
+}
+
+// dataFileName returns the name used for the output files of a data file: the file name, or for
+// a URL the last element of the URL path (I.E. "app.log" for "https://host/logs/app.log?day=1").
+func dataFileName(dataFilePath string) string {
+	if !isUrl(dataFilePath) {
+		return filepath.Base(dataFilePath)
+	}
+	u, err := url.Parse(dataFilePath)
+	if err != nil || strings.Trim(u.Path, "/") == "" {
+		return url.PathEscape(dataFilePath)
+	}
+	return path.Base(u.Path)
+}
+
+// isUrl is true when dataFilePath is an HTTP(S) URL rather than a file path.
+func isUrl(dataFilePath string) bool {
+	return strings.HasPrefix(dataFilePath, "http://") || strings.HasPrefix(dataFilePath, "https://")
 }
 
 // parseFile uses an input file from inputPath to process a data file from dataFilePath.
 // While the output files are being written the suffix is ".locked". When the files are fully
 // processed the ".locked" suffix is removed and callers can use the output files.
-func parseFile(inputs *parser.Inputs, flags flags, dataFilePath string) {
+// An error is returned if importing into sqlite3 fails, or Inputs.MaxErrors is exceeded. For a
+// dry run no output files are written; the fileResult has the number of output rows and bytes
+// that would have been written. When the data file cannot be read to the end (parser.ErrScan),
+// the partial output is discarded and the file is processed again from the start, up to
+// Inputs.ScanErrorRetries times.
+func parseFile(inputs *parser.Inputs, flags flags, dataFilePath string) (fileResult, error) {
+	fileName := dataFileName(dataFilePath)
+	fileInputs, err := inputs.ForFile(fileName)
+	if err != nil {
+		lpf(logh.Error, "calling ForFile: %s", err)
+		os.Exit(9)
+	}
+	if flags.noMove {
+		fileInputs.ProcessedInputDirectory = ""
+	}
+	// Rows are only sent to the recent rows and syslog outputs once an attempt reads the whole file.
+	flags.spoolLiveRows = fileInputs.ScanErrorRetries > 0
+	for retry := 1; ; retry++ {
+		result, err := parseFileInputs(fileInputs, flags, dataFilePath)
+		if !errors.Is(err, parser.ErrScan) || retry > fileInputs.ScanErrorRetries {
+			return result, err
+		}
+		lpf(logh.Warning, "retrying file: %s, retry: %d of %d, error: %s", dataFilePath, retry,
+			fileInputs.ScanErrorRetries, err)
+	}
+}
 
-	// Create the scanner and open the file.
-	scnr, err := parser.NewScanner(*inputs)
+// parseFileInputs implements parseFile for one attempt at processing the data file, with the
+// inputs for the file.
+func parseFileInputs(fileInputs parser.Inputs, flags flags, dataFilePath string) (fileResult, error) {
+	result := fileResult{dataFilePath: dataFilePath}
+
+	// Create the scanner, using the inputs for this file, and open the file.
+	fileName := dataFileName(dataFilePath)
+	scnr, err := parser.NewScanner(fileInputs)
 	if err != nil {
 		lpf(logh.Error, "calling NewScanner: %s", err)
 		os.Exit(9)
 	}
-	err = scnr.OpenFileScanner(dataFilePath)
+	if flags.runIdColumn {
+		scnr.SetRunId(flags.runId)
+	}
+	if flags.runId != "" {
+		lpf(logh.Info, "run ID: %s, data file: %s", flags.runId, dataFilePath)
+	}
+	// The checksum is computed as the data is read, rather than reading the file twice.
+	var checksum hash.Hash
+	if flags.checksum {
+		checksum = sha256.New()
+		scnr.SetChecksum(checksum)
+	}
+	// URLs are read without downloading them first, and are not moved after processing.
+	if isUrl(dataFilePath) {
+		err = scnr.OpenUrlScanner(dataFilePath)
+	} else {
+		err = scnr.OpenFileScanner(dataFilePath)
+	}
 	if err != nil {
 		lpf(logh.Error, "calling OpenScanner: %s", err)
 		os.Exit(13)
 	}
+	if scnr.Charset() != "" {
+		lpf(logh.Info, "charset: %s, file: %s", scnr.Charset(), dataFilePath)
+	}
 
 	// Process all data.
-	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(dataFilePath)+parsedOutputFileSuffix+lockedFileSuffix)
-	hashesOutputFilePath := filepath.Join(dataDirectory, filepath.Base(dataFilePath)+hashesOutputFileSuffix+lockedFileSuffix)
-	processScanner(scnr, flags, parsedOutputFilePath, hashesOutputFilePath)
+	parsedOutputFilePath := filepath.Join(dataDirectory, fileName+parsedOutputFileSuffix+lockedFileSuffix)
+	hashesOutputFilePath := filepath.Join(dataDirectory, fileName+hashesOutputFileSuffix+lockedFileSuffix)
+	messageTypesFilePath := filepath.Join(dataDirectory, fileName+messageTypesFileSuffix+lockedFileSuffix)
+	sqlOutputFilePath := filepath.Join(dataDirectory, fileName+sqlOutputFileSuffix+lockedFileSuffix)
+	errorsFilePath := filepath.Join(dataDirectory, fileName+errorsFileSuffix+lockedFileSuffix)
+	if scnr.CompressionLevel() > 0 {
+		parsedOutputFilePath = filepath.Join(dataDirectory, fileName+parsedOutputFileSuffix+gzipFileSuffix+lockedFileSuffix)
+		sqlOutputFilePath = filepath.Join(dataDirectory, fileName+sqlOutputFileSuffix+gzipFileSuffix+lockedFileSuffix)
+	}
+	var output io.Writer
+	if flags.consolidatedFile != "" && !flags.dryRun {
+		result.output, err = os.CreateTemp(dataDirectory, fileName+".*"+parsedOutputFileSuffix+lockedFileSuffix)
+		if err != nil {
+			lpf(logh.Error, "calling os.CreateTemp: %s", err)
+			os.Exit(17)
+		}
+		output = result.output
+	}
+	// flags is a copy, so the data file name, stage timings, and tagged extracts are for this file.
+	flags.dataFileName = fileName
+	if flags.stageTimings {
+		flags.timings = &stageTimings{}
+	}
+	if !flags.dryRun {
+		flags.taggedExtracts, err = newTaggedExtractWriters(scnr, fileName)
+		if err != nil {
+			lpf(logh.Error, "calling newTaggedExtractWriters: %s", err)
+			os.Exit(17)
+		}
+	}
+	result.outputRows, result.outputBytes, err = processScanner(scnr, flags, parsedOutputFilePath, hashesOutputFilePath,
+		messageTypesFilePath, sqlOutputFilePath, errorsFilePath, output)
+	result.errors = scnr.ErrorCount()
+	for hash := range scnr.HashCounts {
+		result.hashes = append(result.hashes, hash)
+	}
+	// Aborted output is left locked.
+	flags.taggedExtracts.close(err == nil)
 	scnr.Shutdown()
+	if flags.timings != nil {
+		result.timings = flags.timings
+		lpf(logh.Info, "stage timings for file: %s\n%s", dataFilePath, flags.timings.report())
+	}
+	if flags.extractCoverage {
+		lpf(logh.Info, "extraction coverage for file: %s\n%s", dataFilePath, scnr.ExtractCoverageReport())
+	}
+	// Overlapping Extracts are almost always a configuration error, so they are always reported.
+	for _, overlap := range scnr.ExtractOverlaps() {
+		lpf(logh.Warning, "extract overlap for file: %s, extract: %s matched the token of extract: %s, column: %d, rows: %d",
+			dataFilePath, overlap.Extract, overlap.TokenOf, overlap.Column, overlap.Rows)
+	}
+	// The errors are complete for the rows processed, even when processing was aborted.
+	result.renameUnlocked(errorsFilePath, flags.errorsFile && !flags.dryRun)
+	// Aborted output is left locked, and not consolidated, as it is incomplete.
+	if err != nil {
+		result.removeOutput()
+		return result, err
+	}
+	if checksum != nil {
+		result.checksum = hex.EncodeToString(checksum.Sum(nil))
+		lpf(logh.Info, "data file: %s, sha256: %s", dataFilePath, result.checksum)
+	}
+	if flags.dryRun {
+		lpf(logh.Info, "dry run for file: %s, output rows: %d, output bytes: %d", dataFilePath, result.outputRows, result.outputBytes)
+		return result, nil
+	}
+
+	saveSchema(scnr, flags, filepath.Join(dataDirectory, fileName+schemaFileSuffix))
 
 	// Rename the output files, removing the lockedFileSuffix
-	parsedOutputFilePathUnlocked := filepath.Join(dataDirectory, filepath.Base(dataFilePath)+parsedOutputFileSuffix)
-	os.Rename(parsedOutputFilePath, parsedOutputFilePathUnlocked)
-	hashesOutputFilePathUnlocked := filepath.Join(dataDirectory, filepath.Base(dataFilePath)+hashesOutputFileSuffix)
-	os.Rename(hashesOutputFilePath, hashesOutputFilePathUnlocked)
+	parsedOutputFilePathUnlocked := result.renameUnlocked(parsedOutputFilePath, result.output == nil)
+	hashesOutputFilePathUnlocked := result.renameUnlocked(hashesOutputFilePath, scnr.HashingEnabled())
+	if scnr.HashColumnsIndividually() {
+		for _, column := range scnr.HashColumns {
+			result.renameUnlocked(columnHashesFilePath(hashesOutputFilePath, column), true)
+		}
+	}
+	result.renameUnlocked(messageTypesFilePath, scnr.MessageTypeIdsEnabled())
+	// In tee mode the SQL output is in its own file, and that is the file that is imported.
+	importFilePathUnlocked := parsedOutputFilePathUnlocked
+	if flags.tee {
+		importFilePathUnlocked = result.renameUnlocked(sqlOutputFilePath, true)
+	}
+	// Output files that could not be renamed are not imported.
+	if len(result.renameErrors) > 0 {
+		return result, errors.Join(result.renameErrors...)
+	}
 
 	// If the data is being imported into a DB, do the import and remove the output file.
+	// Output files are retained when the import fails so data is not lost.
 	if flags.sqlite3FilePath != "" {
 		if scnr.HashingEnabled() && flags.sqlHashTable != "" {
-			sqlite3Import(flags.sqlite3FilePath, hashesOutputFilePathUnlocked)
+			err := sqlite3ImportRetry(flags, hashesOutputFilePathUnlocked)
+			if err != nil {
+				lpf(logh.Error, "sqlite3 import failed, output file retained: %s", hashesOutputFilePathUnlocked)
+				return result, err
+			}
 			os.Remove(hashesOutputFilePathUnlocked)
 		}
-		sqlite3Import(flags.sqlite3FilePath, parsedOutputFilePathUnlocked)
-		os.Remove(parsedOutputFilePathUnlocked)
+		// Consolidated output is imported after all files are processed.
+		if result.output == nil {
+			err := sqlite3ImportRetry(flags, importFilePathUnlocked)
+			if err != nil {
+				lpf(logh.Error, "sqlite3 import failed, output file retained: %s", importFilePathUnlocked)
+				return result, err
+			}
+			os.Remove(importFilePathUnlocked)
+		}
 	}
+
+	return result, nil
 }
 
 // processScanner takes a scanner, (optionally) finds the unique ID in the input to append to each row,
 // then replaces, spits, extracts, and hashes all data from the scanner. The parsed data is
-// saved to the output, and  hashes saved to a seperate file.
-func processScanner(scnr *parser.Scanner, flags flags, parsedOutputFilePath string, hashesOutputFilePath string) {
+// saved to the output, and  hashes saved to a seperate file. When message type IDs are enabled
+// the mapping of IDs to hashes is saved to a third file. The number of parsed output rows and
+// bytes are returned; for a dry run the output is counted but no files are written.
+// When output is not nil, parsed output is written to output instead of parsedOutputFilePath.
+// When Inputs.CompressionLevel > 0 the parsed and SQL output files are gzip compressed.
+// When Inputs.MaxErrors is exceeded processing stops, hashes and message type IDs are not saved,
+// and the error is returned; the same for parser.ErrScan when the input could not be read to the
+// end. When flags.errorsFile is set, the errors for each row are also written to errorsFilePath
+// with the line number and row.
+func processScanner(scnr *parser.Scanner, flags flags, parsedOutputFilePath string, hashesOutputFilePath string,
+	messageTypesFilePath string, sqlOutputFilePath string, errorsFilePath string, output io.Writer) (int64, int64, error) {
 
 	dataChan, errorChan := scnr.Read(100, 100)
 
-	parsedOutputFile, err := os.Create(parsedOutputFilePath)
-	lpf(logh.Info, "parsed output file: %s", parsedOutputFilePath)
-	if err != nil {
-		lpf(logh.Error, "calling os.Create: %s", err)
-		os.Exit(17)
+	counter := &countingWriter{}
+	if output != nil {
+		counter.w = output
+	} else if !flags.dryRun {
+		parsedOutputFile, err := os.Create(parsedOutputFilePath)
+		lpf(logh.Info, "parsed output file: %s", parsedOutputFilePath)
+		if err != nil {
+			lpf(logh.Error, "calling os.Create: %s", err)
+			os.Exit(17)
+		}
+		defer parsedOutputFile.Close()
+		parsedWriter, closeCompressed := compressedWriter(scnr, parsedOutputFile)
+		defer closeCompressed()
+		counter.w = parsedWriter
+	}
+	outputWriter := bufio.NewWriter(counter)
+
+	// SQL output goes to the parsed output, unless in tee mode where it has its own file.
+	sqlWriter := outputWriter
+	if flags.tee {
+		sqlCounter := &countingWriter{}
+		if !flags.dryRun {
+			sqlOutputFile, err := os.Create(sqlOutputFilePath)
+			lpf(logh.Info, "SQL output file: %s", sqlOutputFilePath)
+			if err != nil {
+				lpf(logh.Error, "calling os.Create: %s", err)
+				os.Exit(17)
+			}
+			defer sqlOutputFile.Close()
+			sqlFileWriter, closeCompressed := compressedWriter(scnr, sqlOutputFile)
+			defer closeCompressed()
+			sqlCounter.w = sqlFileWriter
+		}
+		sqlWriter = bufio.NewWriter(sqlCounter)
+	}
+
+	// Errors are written to their own file, in addition to the log, for triage.
+	var errorsWriter *bufio.Writer
+	if flags.errorsFile && !flags.dryRun {
+		errorsFile, err := os.Create(errorsFilePath)
+		lpf(logh.Info, "errors output file: %s", errorsFilePath)
+		if err != nil {
+			lpf(logh.Error, "calling os.Create: %s", err)
+			os.Exit(17)
+		}
+		defer errorsFile.Close()
+		errorsWriter = bufio.NewWriter(errorsFile)
 	}
-	defer parsedOutputFile.Close()
-	outputWriter := bufio.NewWriter(parsedOutputFile)
-	defer outputWriter.Flush()
 
 	unexpectedFieldCount := 0
 	uniqueId := flags.uniqueId
@@ -304,17 +1045,96 @@ func processScanner(scnr *parser.Scanner, flags flags, parsedOutputFilePath stri
 	}
 
 	if flags.sqlColumns > 0 {
-		outputWriter.WriteString("PRAGMA busy_timeout = 10000; BEGIN IMMEDIATE TRANSACTION;\n")
+		sqlWriter.WriteString(sqlTransactionBegin + scnr.Newline())
+	}
+
+	var rowWriter io.StringWriter = outputWriter
+	var rowSqlWriter io.StringWriter = sqlWriter
+	if flags.splitUniqueId && !flags.dryRun {
+		uiw := newUniqueIdWriters(flags, &uniqueId, outputWriter, scnr.Newline())
+		defer uiw.close()
+		rowWriter = uiw
+		if !flags.tee {
+			rowSqlWriter = uiw
+		}
+	}
+
+	// In tee mode the row is output both in the output format and as SQL.
+	var outputs []rowOutput
+	if flags.sqlColumns <= 0 || flags.tee {
+		outputs = append(outputs, rowOutput{formatter: newRowFormatter(scnr, flags.outputFormat), stdout: flags.stdout, writer: rowWriter})
+	}
+	if flags.sqlColumns > 0 {
+		outputs = append(outputs, rowOutput{
+			formatter: parser.SqlFormatter{Columns: flags.sqlColumns, Scanner: scnr, Table: flags.sqlDataTable},
+			stdout:    flags.stdout,
+			writer:    rowSqlWriter,
+		})
+	}
+	// Recent rows are kept, and rows are forwarded to syslog, in the first output format. When
+	// flags.spoolLiveRows is set, the rows are spooled and sent once the data file has been read
+	// to the end, so the rows of an attempt that is retried are not sent.
+	var liveWriters []io.StringWriter
+	if flags.recent != nil {
+		liveWriters = append(liveWriters, flags.recent)
+	}
+	if flags.syslog != nil {
+		liveWriters = append(liveWriters, flags.syslog)
+	}
+	var spool *spooledRows
+	if flags.spoolLiveRows && len(liveWriters) > 0 {
+		var err error
+		spool, err = newSpooledRows(flags.dataFileName)
+		if err != nil {
+			lpf(logh.Error, "calling newSpooledRows: %s", err)
+			os.Exit(17)
+		}
+		defer spool.close()
+		outputs = append(outputs, rowOutput{formatter: outputs[0].formatter, writer: spool})
+	} else {
+		for _, writer := range liveWriters {
+			outputs = append(outputs, rowOutput{formatter: outputs[0].formatter, writer: writer})
+		}
 	}
 
 	if flags.stdout {
 		fmt.Println("---------------- PARSED OUTPUT START ----------------")
 	}
 
+	flush := func() error {
+		if err := outputWriter.Flush(); err != nil {
+			return err
+		}
+		return sqlWriter.Flush()
+	}
+	rows := 0
+	var abortErr error
+	scanStart := flags.timings.start()
 	for row := range dataChan {
-		if err := processScannerRow(&uniqueId, scnr, flags, row, outputWriter); err != nil {
+		flags.timings.record(stageScan, &scanStart)
+		rowErrors, err := processScannerRow(&uniqueId, scnr, flags, row, outputs)
+		if err != nil {
 			unexpectedFieldCount++
 		}
+		if errorsWriter != nil {
+			// Line numbers start at 1; Read returns every line of the file, in order, as errorsfile
+			// cannot be used with Inputs.ReorderWindow.
+			for _, rowErr := range rowErrors {
+				fmt.Fprintf(errorsWriter, "line: %d, error: %s, row: %s%s", rows+1, rowErr, row, scnr.Newline())
+			}
+		}
+		if abortErr = scnr.AddErrors(len(rowErrors)); abortErr != nil {
+			lpf(logh.Error, "aborting processing: %s", abortErr)
+			// Read stops after the rows already read; they are not processed.
+			for range dataChan {
+			}
+			break
+		}
+		rows++
+		if flags.maxMemory > 0 && rows%memoryCheckRows == 0 && memoryHigh(flags.maxMemory) {
+			degradeMemory(scnr, flags, hashesOutputFilePath, flush)
+		}
+		scanStart = flags.timings.start()
 	}
 
 	if flags.stdout {
@@ -322,84 +1142,303 @@ func processScanner(scnr *parser.Scanner, flags flags, parsedOutputFilePath stri
 	}
 
 	if flags.sqlColumns > 0 {
-		outputWriter.WriteString("END TRANSACTION;\n")
+		sqlWriter.WriteString(sqlTransactionEnd + scnr.Newline())
 	}
 
 	lpf(logh.Info, "total lines with unexpected number of fields=%d", unexpectedFieldCount)
 	for err := range errorChan {
+		// An unterminated final line is still processed, but can indicate a partial file.
+		if errors.Is(err, parser.ErrUnterminatedFinalLine) {
+			lp(logh.Warning, err)
+			continue
+		}
+		// The output is incomplete, so it is handled like an aborted file.
+		if errors.Is(err, parser.ErrScan) && abortErr == nil {
+			abortErr = err
+		}
 		lp(logh.Error, err)
 	}
 
+	if err := outputWriter.Flush(); err != nil {
+		lpf(logh.Error, "calling Flush: %s", err)
+	}
+	if sqlWriter != outputWriter {
+		if err := sqlWriter.Flush(); err != nil {
+			lpf(logh.Error, "calling Flush: %s", err)
+		}
+	}
+	if errorsWriter != nil {
+		if err := errorsWriter.Flush(); err != nil {
+			lpf(logh.Error, "calling Flush: %s", err)
+		}
+	}
+	if spool != nil && abortErr == nil {
+		if err := spool.send(liveWriters); err != nil {
+			lpf(logh.Error, "sending spooled rows: %s", err)
+		}
+	}
+	if flags.dryRun || abortErr != nil {
+		// Hashes spilled before the abort would otherwise be merged when the file is processed again.
+		if abortErr != nil {
+			os.Remove(hashesOutputFilePath + hashesSpillFileSuffix)
+		}
+		return counter.rows, counter.bytes, abortErr
+	}
+
 	if scnr.HashingEnabled() {
-		saveHashes(scnr.HashCounts, scnr.HashMap, hashesOutputFilePath, flags)
+		// Output is left locked when the hashes are not saved.
+		if err := mergeSpilledHashes(scnr, hashesOutputFilePath+hashesSpillFileSuffix); err != nil {
+			return counter.rows, counter.bytes, err
+		}
+		if err := saveHashes(scnr.HashCounts, scnr.HashMap, hashesOutputFilePath, scnr.Newline(), flags); err != nil {
+			return counter.rows, counter.bytes, err
+		}
+		if scnr.HashColumnsIndividually() {
+			for _, column := range scnr.HashColumns {
+				saveColumnHashes(scnr, column, columnHashesFilePath(hashesOutputFilePath, column))
+			}
+		}
 	}
+	if scnr.MessageTypeIdsEnabled() {
+		saveMessageTypeIds(scnr, messageTypesFilePath)
+	}
+	return counter.rows, counter.bytes, nil
 }
 
-func processScannerRow(uniqueId *string, scnr *parser.Scanner, flags flags, row string, outputWriter *bufio.Writer) error {
-	if *uniqueId == "" && flags.uniqueIdRegexString != "" {
-		match := regexp.MustCompile(flags.uniqueIdRegexString).FindStringSubmatch(row)
-		if match != nil {
+// processScannerRow processes a single row and writes the output to outputWriter. The uniqueId
+// is updated when found via the Inputs.UniqueIdFunc, or flags.uniqueIdRegex; only the first
+// match is used unless flags.splitUniqueId is set, in which case the unique ID is found for every row.
+// The errors logged for the row are returned, and the error when the row has an unexpected
+// number of fields.
+func processScannerRow(uniqueId *string, scnr *parser.Scanner, flags flags, row string, outputs []rowOutput) ([]error, error) {
+	var rowErrors []error
+	// Time spent between stages (I.E. finding the unique ID) is included in the next stage.
+	start := flags.timings.start()
+	// The row ID is the hash of the row as read, so it does not change with the Inputs.
+	rawRow := row
+	row, err := scnr.PreProcess(row)
+	if err != nil {
+		lpf(logh.Warning, "%s", err)
+		rowErrors = append(rowErrors, err)
+	}
+	flags.timings.record(stagePreProcess, &start)
+
+	if (*uniqueId == "" || flags.splitUniqueId) && scnr.UniqueIdFuncEnabled() {
+		if id := scnr.UniqueId(row); id != "" && id != *uniqueId {
+			*uniqueId = id
+			// With splitUniqueId the unique ID changes between tenants; uniqueIdWriters logs each new file.
+			if !flags.splitUniqueId {
+				lpf(logh.Info, "UniqueID found via UniqueIdFunc: %s", *uniqueId)
+			}
+		}
+	} else if (*uniqueId == "" || flags.splitUniqueId) && flags.uniqueIdRegex != nil {
+		match := flags.uniqueIdRegex.FindStringSubmatch(row)
+		if match != nil && match[1] != *uniqueId {
 			*uniqueId = match[1]
-			lpf(logh.Info, "UniqueID found via regex: %s", *uniqueId)
+			if !flags.splitUniqueId {
+				lpf(logh.Info, "UniqueID found via regex: %s", *uniqueId)
+			}
 		}
 	}
 
-	if scnr.Filter(row) {
-		return nil
+	filtered := scnr.Filter(row)
+	flags.timings.record(stageFilter, &start)
+	if filtered {
+		return rowErrors, nil
 	}
 
 	// Replace, split, and extract.
 	row = scnr.Replace(row)
+	flags.timings.record(stageReplace, &start)
 	splits, err := scnr.Split(row)
-	if err != nil {
+	flags.timings.record(stageSplit, &start)
+	if errors.Is(err, parser.ErrFieldCountPadded) {
+		// The row is still output, aligned to the expected columns.
+		lpf(logh.Warning, "%+v, row: %s", err, row)
+		rowErrors = append(rowErrors, err)
+	} else if err != nil {
 		lpf(logh.Error, "%+v, splits:%s", err, strings.Join(splits, scnr.OutputDelimiter))
-		return err
+		return append(rowErrors, err), err
 	}
+	// The format router dropped the row.
+	if splits == nil {
+		return rowErrors, nil
+	}
+	for _, err := range scnr.ValidateColumns(splits) {
+		lpf(logh.Warning, "%s, row: %s", err, row)
+		rowErrors = append(rowErrors, err)
+	}
+	// Extract Delta values are differenced per unique ID.
+	scnr.SetDeltaKey(*uniqueId)
 	extracts, errors := scnr.Extract(splits)
 	for _, err := range errors {
 		lpf(logh.Warning, "%s", err)
 	}
+	rowErrors = append(rowErrors, errors...)
+	if scnr.FilterExtracts() {
+		flags.timings.record(stageExtract, &start)
+		return rowErrors, nil
+	}
+	if err := flags.taggedExtracts.write(*uniqueId, scnr.TaggedExtracts()); err != nil {
+		lpf(logh.Error, "writing tagged extracts: %s", err)
+	}
+	splits = scnr.AppendIngestTimestamp(splits)
+	splits = scnr.AppendRunId(splits)
+	if limited := scnr.LimitFieldLengths(splits); limited > 0 {
+		lpf(logh.Debug, "fields limited to MaxFieldLength: %d", limited)
+	}
+	flags.timings.record(stageExtract, &start)
 
+	var hash string
 	if scnr.HashingEnabled() {
 		sehc, err := scnr.SplitsExcludeHashColumns(splits, flags.hashFormat)
 		if err != nil {
 			lpf(logh.Error, "calling SplitsExcludeHashColumns: %s", err)
+			return append(rowErrors, err), nil
 		}
-		var out string
-
-		if flags.sqlColumns > 0 {
-			if *uniqueId != "" {
-				sehc = append([]string{*uniqueId}, sehc...)
-			}
-			out = scnr.SplitsToSql(flags.sqlColumns, flags.sqlDataTable, sehc, extracts)
-		} else {
-			out = *uniqueId + scnr.OutputDelimiter + strings.Join(sehc, scnr.OutputDelimiter) + "|EXTRACTS|" + strings.Join(extracts, scnr.OutputDelimiter)
+		splits = sehc
+		// The hash is inserted at the first hash column. When hash columns are hashed
+		// individually there is no row hash.
+		if !scnr.HashColumnsIndividually() {
+			hash = splits[slices.Min(scnr.HashColumns)]
 		}
-		outputWriter.WriteString(out + "\n")
-		if flags.stdout {
-			fmt.Println(out)
+		flags.timings.record(stageHash, &start)
+	}
+	splits, err = scnr.PrependRowId(splits, rawRow, flags.hashFormat)
+	if err != nil {
+		lpf(logh.Error, "calling PrependRowId: %s", err)
+		return append(rowErrors, err), nil
+	}
+
+	// The row is hashed once, but may be output as several rows; see Extract.Explode.
+	for _, extracts := range scnr.Explode(extracts) {
+		if flags.limiter != nil {
+			flags.limiter.Wait()
 		}
-	} else {
-		var out string
-		if flags.sqlColumns > 0 {
-			if *uniqueId != "" {
-				splits = append([]string{*uniqueId}, splits...)
+		for _, output := range outputs {
+			out := output.formatter.Format(*uniqueId, splits, extracts, hash)
+			output.writer.WriteString(out + scnr.Newline())
+			if output.stdout {
+				fmt.Println(out)
 			}
-			out = scnr.SplitsToSql(flags.sqlColumns, flags.sqlDataTable, splits, extracts)
-		} else {
-			out = *uniqueId + scnr.OutputDelimiter + strings.Join(splits, scnr.OutputDelimiter) + "|EXTRACTS|" + strings.Join(extracts, scnr.OutputDelimiter)
 		}
-		outputWriter.WriteString(out + "\n")
-		if flags.stdout {
-			fmt.Println(out)
+	}
+	flags.timings.record(stageWrite, &start)
+
+	return rowErrors, nil
+}
+
+// mergeParsedOutput merges the parsed output files for the fileList into the flags.mergeFile,
+// ordered by flags.mergeColumn; see mergeSorted. Data files without parsed output are skipped.
+func mergeParsedOutput(inputs *parser.Inputs, fileList []fs.DirEntry, flags flags) error {
+	parsedOutputFilePaths := make([]string, 0, len(fileList))
+	for _, file := range fileList {
+		parsedOutputFilePath := filepath.Join(dataDirectory, file.Name()+parsedOutputFileSuffix)
+		if _, err := os.Stat(parsedOutputFilePath); err != nil {
+			lpf(logh.Warning, "no parsed output to merge for file: %s", file.Name())
+			continue
 		}
+		parsedOutputFilePaths = append(parsedOutputFilePaths, parsedOutputFilePath)
 	}
 
+	mergeFilePath := filepath.Join(dataDirectory, flags.mergeFile+lockedFileSuffix)
+	mergeFile, err := os.Create(mergeFilePath)
+	lpf(logh.Info, "merged output file: %s", mergeFilePath)
+	if err != nil {
+		lpf(logh.Error, "calling os.Create: %s", err)
+		return err
+	}
+	err = mergeSorted(parsedOutputFilePaths, inputs.OutputDelimiter, flags.mergeColumn, inputs.Newline(), mergeFile)
+	mergeFile.Close()
+	if err != nil {
+		lpf(logh.Error, "calling mergeSorted: %s", err)
+		return err
+	}
+	if err := os.Rename(mergeFilePath, strings.TrimSuffix(mergeFilePath, lockedFileSuffix)); err != nil {
+		lpf(logh.Error, "calling os.Rename, output file left locked: %s", err)
+		return err
+	}
 	return nil
 }
 
-// saveHashes writes the hashes out to a file for later importing into a database.
-func saveHashes(hashCounts map[string]int, hashMap map[string]string, hashesOutputFilePath string, flags flags) {
+// newRowFormatter returns the RowFormatter for the outputFormat, which is validated in main.
+func newRowFormatter(scnr *parser.Scanner, outputFormat string) parser.RowFormatter {
+	switch outputFormat {
+	case outputFormatCsv:
+		return parser.CsvFormatter{}
+	case outputFormatNdjson:
+		return parser.NdjsonFormatter{ColumnNames: scnr.OutputColumnNames(), Scanner: scnr}
+	default:
+		return parser.DelimitedFormatter{Delimiter: scnr.OutputDelimiter}
+	}
+}
+
+// verifyHashes verifies the hashes in a hashes output file, written with format, printing any
+// mismatches. Hashes are computed with MD5, as the scanner does. The return is false if the file
+// could not be read, or there are mismatches.
+func verifyHashes(hashesFilePath string, format parser.HashFormat) bool {
+	hashesFile, err := os.Open(hashesFilePath)
+	if err != nil {
+		lpf(logh.Error, "calling os.Open: %s", err)
+		return false
+	}
+	defer hashesFile.Close()
+	mismatches, err := parser.VerifyHashes(hashesFile, format, parser.HASH_ALGORITHM_MD5)
+	if err != nil {
+		lpf(logh.Error, "calling VerifyHashes: %s", err)
+	}
+	for _, mismatch := range mismatches {
+		fmt.Println(mismatch)
+	}
+	lpf(logh.Info, "verified hashes file: %s, mismatches: %d", hashesFilePath, len(mismatches))
+	return err == nil && len(mismatches) == 0
+}
+
+// columnHashesFilePath returns the path of the hashes file for column, when hash columns are
+// hashed individually, from the hashes output file path: <DATA_FILE_NAME>.column<N>.hashes.txt.
+func columnHashesFilePath(hashesOutputFilePath string, column int) string {
+	dir, file := filepath.Split(hashesOutputFilePath)
+	dataFileName, lockedSuffix, _ := strings.Cut(file, hashesOutputFileSuffix)
+	return filepath.Join(dir, fmt.Sprintf("%s.column%d%s%s", dataFileName, column, hashesOutputFileSuffix, lockedSuffix))
+}
+
+// saveColumnHashes saves the hashes and counts for a single column, when hash columns are hashed
+// individually, in the hashes file format. These files are not imported into sqlite3; all
+// hashes are in the hashes output file.
+func saveColumnHashes(scnr *parser.Scanner, column int, columnHashesFilePath string) {
+	columnHashesFile, err := os.Create(columnHashesFilePath)
+	lpf(logh.Info, "column %d hashes output file: %s", column, columnHashesFilePath)
+	if err != nil {
+		lpf(logh.Error, "calling os.Create: %s", err)
+		os.Exit(17)
+	}
+	defer columnHashesFile.Close()
+	lpf(logh.Info, "column %d len(hashCounts)=%d", column, len(scnr.ColumnHashCounts[column]))
+	if err := parser.WriteHashes(columnHashesFile, hashesOutputDelimiter, scnr.Newline(), scnr.ColumnHashCounts[column], scnr.ColumnHashMap[column]); err != nil {
+		lpf(logh.Error, "calling WriteHashes: %s", err)
+	}
+}
+
+// saveHashes writes the hashes out to a file for later importing into a database. Lines end with
+// newline, the Scanner.Newline. In append mode, an error is returned, and no hashes file is written,
+// when the existing hashes file cannot be read, so the existing file is not replaced.
+func saveHashes(hashCounts map[string]int, hashMap map[string]string, hashesOutputFilePath string, newline string, flags flags) error {
+	// In append mode, merge the counts from any existing hash file so counts accumulate across runs.
+	if flags.appendHashes && flags.sqlColumns <= 0 {
+		existingHashesFilePath := strings.TrimSuffix(hashesOutputFilePath, lockedFileSuffix)
+		if existingHashesFile, err := os.Open(existingHashesFilePath); err == nil {
+			err = parser.ReadHashes(existingHashesFile, hashesOutputDelimiter, hashCounts, hashMap)
+			existingHashesFile.Close()
+			if err != nil {
+				lpf(logh.Error, "calling ReadHashes, existing hashes file not replaced: %s", err)
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			lpf(logh.Error, "calling os.Open, existing hashes file not replaced: %s", err)
+			return err
+		}
+	}
+
 	// Open output files
 	hashesOutputFile, err := os.Create(hashesOutputFilePath)
 	lpf(logh.Info, "hashes output file: %s", hashesOutputFilePath)
@@ -410,7 +1449,7 @@ func saveHashes(hashCounts map[string]int, hashMap map[string]string, hashesOutp
 	defer hashesOutputFile.Close()
 
 	if flags.sqlColumns > 0 {
-		_, err := hashesOutputFile.WriteString("PRAGMA busy_timeout = 10000; BEGIN IMMEDIATE TRANSACTION;\n")
+		_, err := hashesOutputFile.WriteString(sqlTransactionBegin + newline)
 		if err != nil {
 			lpf(logh.Error, "calling hashesOutputFile.WriteString: %s", err)
 		}
@@ -419,24 +1458,34 @@ func saveHashes(hashCounts map[string]int, hashMap map[string]string, hashesOutp
 	sortedHashKeys := parser.SortedHashMapCounts(hashCounts)
 	lpf(logh.Info, "len(hashCounts)=%d", len(hashCounts))
 	lpf(logh.Debug, "Hashes and counts:")
-	var dump string
 	for _, v := range sortedHashKeys {
 		lpf(logh.Debug, "hash: %s, count: %d, value: %s", v, hashCounts[v], hashMap[v])
-		var out string
-		if flags.sqlColumns > 0 {
-			out = fmt.Sprintf("INSERT OR IGNORE INTO %s VALUES(%s, '%s');", flags.sqlHashTable, v, hashMap[v]) + "\n"
-		} else {
-			out = strings.Join([]string{v, hashMap[v]}, hashesOutputDelimiter) + "\n"
-		}
-		dump += out
-		_, err := hashesOutputFile.WriteString(out)
+	}
+	var dump string
+	if flags.sqlColumns > 0 {
+		for _, v := range sortedHashKeys {
+			dump += fmt.Sprintf("INSERT OR IGNORE INTO %s VALUES(%s, '%s');", flags.sqlHashTable, v, hashMap[v]) + newline
+		}
+	} else {
+		// Counts are only written in append mode, where they are read back on the next run.
+		var sb strings.Builder
+		writeHashes := parser.WriteHashValues
+		if flags.appendHashes {
+			writeHashes = parser.WriteHashes
+		}
+		err := writeHashes(&sb, hashesOutputDelimiter, newline, hashCounts, hashMap)
 		if err != nil {
-			lpf(logh.Error, "calling hashesOutputFile.WriteString: %s", err)
+			lpf(logh.Error, "calling WriteHashes: %s", err)
 		}
+		dump = sb.String()
+	}
+	_, err = hashesOutputFile.WriteString(dump)
+	if err != nil {
+		lpf(logh.Error, "calling hashesOutputFile.WriteString: %s", err)
 	}
 
 	if flags.sqlColumns > 0 {
-		_, err := hashesOutputFile.WriteString("END TRANSACTION;\n")
+		_, err := hashesOutputFile.WriteString(sqlTransactionEnd + newline)
 		if err != nil {
 			lpf(logh.Error, "calling hashesOutputFile.WriteString: %s", err)
 		}
@@ -448,20 +1497,110 @@ func saveHashes(hashCounts map[string]int, hashMap map[string]string, hashesOutp
 		fmt.Println("---------------- HASHED OUTPUT END   ----------------")
 	}
 
+	return nil
+}
+
+// saveSchema writes the outputSchema to a file.
+func saveSchema(scnr *parser.Scanner, flags flags, schemaFilePath string) {
+	schema := outputSchema{Schema: scnr.Schema(), OutputFormat: flags.outputFormat}
+	if schema.OutputFormat == "" {
+		schema.OutputFormat = outputFormatDelimited
+	}
+	// The unique ID is always a column of delimited and CSV output, and a field of NDJSON output.
+	schema.UniqueId = schema.OutputFormat != outputFormatNdjson
+	if flags.sqlColumns > 0 && !flags.tee {
+		schema.OutputFormat = "sql"
+		schema.UniqueId = flags.uniqueId != "" || flags.uniqueIdRegex != nil || scnr.UniqueIdFuncEnabled()
+	}
+	if flags.sqlColumns > 0 {
+		schema.SqlColumns = flags.sqlColumns
+		if scnr.SqlProvenanceEnabled() {
+			schema.SqlProvenanceColumns = scnr.SqlProvenanceColumns()
+		}
+	}
+
+	b, err := json.MarshalIndent(schema, "", "    ")
+	if err != nil {
+		lpf(logh.Error, "calling json.MarshalIndent: %s", err)
+		return
+	}
+	lpf(logh.Info, "schema output file: %s", schemaFilePath)
+	if err := os.WriteFile(schemaFilePath, b, 0644); err != nil {
+		lpf(logh.Error, "calling os.WriteFile: %s", err)
+	}
+}
+
+// saveMessageTypeIds writes the message type IDs, with their hashes and values, out to a file.
+func saveMessageTypeIds(scnr *parser.Scanner, messageTypesFilePath string) {
+	messageTypesFile, err := os.Create(messageTypesFilePath)
+	lpf(logh.Info, "message types output file: %s", messageTypesFilePath)
+	if err != nil {
+		lpf(logh.Error, "calling os.Create: %s", err)
+		os.Exit(17)
+	}
+	defer messageTypesFile.Close()
+
+	err = scnr.WriteMessageTypeIds(messageTypesFile)
+	if err != nil {
+		lpf(logh.Error, "calling WriteMessageTypeIds: %s", err)
+	}
+}
+
+// newRunId returns an ID for this run (invocation), for correlating output files, logs, and SQL
+// rows: the UTC start time and a random suffix, so concurrent runs have different IDs.
+func newRunId() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// compressedWriter returns a writer that gzip compresses to w, at the Inputs.CompressionLevel,
+// and a function that must be called after the last write to complete the compressed output.
+// When the CompressionLevel is 0, w is returned and the function does nothing.
+func compressedWriter(scnr *parser.Scanner, w io.Writer) (io.Writer, func()) {
+	if scnr.CompressionLevel() == 0 {
+		return w, func() {}
+	}
+	// The level is validated by NewScanner.
+	gzipWriter, _ := gzip.NewWriterLevel(w, scnr.CompressionLevel())
+	return gzipWriter, func() {
+		if err := gzipWriter.Close(); err != nil {
+			lpf(logh.Error, "closing gzip writer: %s", err)
+		}
+	}
+}
+
+// sqlite3ImportRetry calls sqlite3Import, retrying up to flags.sqlite3Retries times with the
+// delay starting at flags.sqlite3RetryBackoff and doubling for each retry.
+func sqlite3ImportRetry(flags flags, inputFilePath string) error {
+	backoff := flags.sqlite3RetryBackoff
+	err := sqlite3Import(flags.sqlite3FilePath, inputFilePath)
+	for retry := 1; err != nil && retry <= flags.sqlite3Retries; retry++ {
+		lpf(logh.Warning, "sqlite3 import retry %d of %d in %s", retry, flags.sqlite3Retries, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		err = sqlite3Import(flags.sqlite3FilePath, inputFilePath)
+	}
+	return err
 }
 
 // sqlite3Import is used to import the SQL output into a sqlite3 database.
-// The sqlite file and tables must be created prior to import.
-func sqlite3Import(sqlite3FilePath, inputFilePath string) {
-	b, _ := os.ReadFile(inputFilePath)
-	lpf(logh.Debug, string(b))
-	// if _, err := os.Stat(sqlite3FilePath); err == nil {
-	args := []string{sqlite3FilePath}
+// The sqlite file and tables must be created prior to import. Gzip compressed SQL output
+// (inputFilePath ending in .gz) is decompressed as it is streamed to sqlite3, so no
+// decompressed file is written.
+func sqlite3Import(sqlite3FilePath, inputFilePath string) error {
+	if strings.HasSuffix(inputFilePath, gzipFileSuffix) {
+		return sqlite3ImportGzip(sqlite3FilePath, inputFilePath)
+	}
+	// With -bail sqlite3 stops at the first error, so the transaction is not committed and the
+	// import can be retried without duplicating rows; see sqlite3ImportRetry.
+	args := []string{"-bail", sqlite3FilePath}
 	sqc := fmt.Sprintf(".read %s", inputFilePath)
 	cmd := exec.Command("sqlite3", args...)
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		lpf(logh.Error, "StdinPipe: %s", err)
+		return err
 	}
 	_, err = io.WriteString(stdin, sqc)
 	if err != nil {
@@ -469,11 +1608,38 @@ func sqlite3Import(sqlite3FilePath, inputFilePath string) {
 	}
 	stdin.Close()
 	stdoutStderr, err := cmd.CombinedOutput()
+	lpf(logh.Debug, "stdoutStderr: \n%s", stdoutStderr)
 	if err != nil {
 		lpf(logh.Error, "calling sqlite3: %+v, args: %s, file: %s", err, args, inputFilePath)
+		return err
+	}
+	return nil
+}
+
+// sqlite3ImportGzip imports gzip compressed SQL output into a sqlite3 database, streaming the
+// decompressed SQL to sqlite3 on stdin.
+func sqlite3ImportGzip(sqlite3FilePath, inputFilePath string) error {
+	inputFile, err := os.Open(inputFilePath)
+	if err != nil {
+		lpf(logh.Error, "opening file: %s", err)
+		return err
+	}
+	defer inputFile.Close()
+	gzipReader, err := gzip.NewReader(inputFile)
+	if err != nil {
+		lpf(logh.Error, "gzip.NewReader: %s, file: %s", err, inputFilePath)
+		return err
 	}
+	defer gzipReader.Close()
+
+	args := []string{"-bail", sqlite3FilePath}
+	cmd := exec.Command("sqlite3", args...)
+	cmd.Stdin = gzipReader
+	stdoutStderr, err := cmd.CombinedOutput()
 	lpf(logh.Debug, "stdoutStderr: \n%s", stdoutStderr)
-	// } else {
-	// 	lpf(logh.Error, "accessing sqlite3File path: %s", err)
-	// }
+	if err != nil {
+		lpf(logh.Error, "calling sqlite3: %+v, args: %s, file: %s", err, args, inputFilePath)
+		return err
+	}
+	return nil
 }
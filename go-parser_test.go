@@ -0,0 +1,1737 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paulfdunn/go-helper/logh"
+	"github.com/paulfdunn/go-parser/parser"
+)
+
+const (
+	testDataFilePath = "./parser/test/test_extract.txt"
+)
+
+func TestMain(m *testing.M) {
+	logh.New(appName, "", logh.DefaultLevels, logh.Error, logh.DefaultFlags, 100, int64(100e6))
+	lp = logh.Map[appName].Println
+	lpf = logh.Map[appName].Printf
+	code := m.Run()
+	logh.ShutdownAll()
+	os.Exit(code)
+}
+
+// testSetup sets the output directory to a temporary directory and returns the example inputs.
+func testSetup(t *testing.T) *parser.Inputs {
+	dataDirectory = t.TempDir()
+	inputs, err := parser.NewInputs("./inputs/exampleInput.json")
+	if err != nil {
+		t.Fatalf("calling NewInputs: %s", err)
+	}
+	return inputs
+}
+
+// TestParseFile_sqlite3ImportFails verifies the output file is retained, and the error returned,
+// when the sqlite3 import fails after retrying.
+func TestParseFile_sqlite3ImportFails(t *testing.T) {
+	inputs := testSetup(t)
+	flags := flags{
+		sqlite3FilePath:     filepath.Join(t.TempDir(), "missing", "test.db"),
+		sqlite3Retries:      2,
+		sqlite3RetryBackoff: time.Millisecond,
+		sqlDataTable:        "parsed",
+		sqlColumns:          10,
+	}
+
+	_, err := parseFile(inputs, flags, testDataFilePath)
+	if err == nil {
+		t.Errorf("expected sqlite3 import error")
+	}
+	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix)
+	if _, err := os.Stat(parsedOutputFilePath); err != nil {
+		t.Errorf("output file not retained: %s", err)
+	}
+}
+
+// TestSqlite3Import_gzip verifies gzip compressed SQL output is imported, with no decompressed
+// file written.
+func TestSqlite3Import_gzip(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	directory := t.TempDir()
+	sqlite3FilePath := filepath.Join(directory, "test.db")
+	if out, err := exec.Command("sqlite3", sqlite3FilePath, "CREATE TABLE parsed (c0 TEXT, c1 TEXT);").CombinedOutput(); err != nil {
+		t.Fatalf("creating table: %s, %s", err, out)
+	}
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write([]byte("INSERT OR IGNORE INTO parsed VALUES('a','b');\nINSERT OR IGNORE INTO parsed VALUES('c','d');\n"))
+	gzipWriter.Close()
+	sqlFilePath := filepath.Join(directory, "test"+sqlOutputFileSuffix+gzipFileSuffix)
+	if err := os.WriteFile(sqlFilePath, compressed.Bytes(), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+
+	if err := sqlite3Import(sqlite3FilePath, sqlFilePath); err != nil {
+		t.Fatalf("calling sqlite3Import: %s", err)
+	}
+	out, err := exec.Command("sqlite3", sqlite3FilePath, "SELECT c0 || c1 FROM parsed;").Output()
+	if err != nil {
+		t.Fatalf("querying: %s", err)
+	}
+	if got, want := string(out), "ab\ncd\n"; got != want {
+		t.Errorf("rows, got: %q, want: %q", got, want)
+	}
+	entries, _ := os.ReadDir(directory)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"test.db", filepath.Base(sqlFilePath)}; !slices.Equal(names, want) {
+		t.Errorf("files, got: %q, want: %q", names, want)
+	}
+}
+
+// TestParseFile_splitUniqueId verifies output for each unique ID is written to its own file,
+// with only one file open at a time.
+func TestParseFile_splitUniqueId(t *testing.T) {
+	inputs := testSetup(t)
+	data := "serial number:TENANT_A\n" +
+		"2023-10-07 12:00:00.00 MDT  0         0         notification  debug          multi word type     sw_a          Unit 12.Ab.34 message (789)\n" +
+		"serial number:TENANT_B\n" +
+		"2023-10-07 12:00:00.01 MDT  1         001       notification  info           SingleWordType      sw_b          Info SW version = 1.2.34 release=a.1.1\n" +
+		"serial number:TENANT_A\n" +
+		"2023-10-07 12:00:00.02 MDT  1         002       status        info           alphanumeric value  sw_a          Message with alphanumberic value abc123def\n"
+	dataFilePath := filepath.Join(t.TempDir(), "tenants.txt")
+	if err := os.WriteFile(dataFilePath, []byte(data), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	flags := flags{
+		splitUniqueId:     true,
+		splitUniqueIdOpen: 1,
+		uniqueIdRegex:     regexp.MustCompile(`serial number:(\w+)`),
+	}
+
+	if _, err := parseFile(inputs, flags, dataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+
+	expected := map[string]string{
+		"TENANT_A": "TENANT_A|2023-10-07 12:00:00.00 MDT|0|0|notification|debug|multi word type|sw_a|Unit {} message ({})|EXTRACTS|12.Ab.34|789\n" +
+			"TENANT_A|2023-10-07 12:00:00.02 MDT|1|002|status|info|alphanumeric value|sw_a|Message with alphanumberic value {}|EXTRACTS|abc123def\n",
+		"TENANT_B": "TENANT_B|2023-10-07 12:00:00.01 MDT|1|001|notification|info|SingleWordType|sw_b|Info SW version = {} release={}|EXTRACTS|1.2.34|a.1.1\n",
+	}
+	for uniqueId, output := range expected {
+		b, err := os.ReadFile(filepath.Join(dataDirectory, "tenants.txt."+uniqueId+parsedOutputFileSuffix))
+		if err != nil {
+			t.Errorf("calling os.ReadFile: %s", err)
+		}
+		if string(b) != output {
+			t.Errorf("unique ID: %s, output:\n%s\nexpected:\n%s", uniqueId, b, output)
+		}
+	}
+}
+
+// TestParseFile_splitUniqueIdFileNames verifies unique IDs that are the same once made into file
+// names are still written to their own files.
+func TestParseFile_splitUniqueIdFileNames(t *testing.T) {
+	inputs := testSetup(t)
+	row := "2023-10-07 12:00:00.00 MDT  0         0         notification  debug          multi word type     sw_a          Unit 12.Ab.34 message (789)\n"
+	uniqueIds := []string{"a/b", "a b", "a_b"}
+	data := ""
+	for _, uniqueId := range uniqueIds {
+		data += "serial number:" + uniqueId + "\n" + row
+	}
+	dataFilePath := filepath.Join(t.TempDir(), "tenants.txt")
+	if err := os.WriteFile(dataFilePath, []byte(data), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	flags := flags{
+		dataFileName:      "tenants.txt",
+		splitUniqueId:     true,
+		splitUniqueIdOpen: 1,
+		uniqueIdRegex:     regexp.MustCompile(`serial number:(.+)`),
+	}
+
+	if _, err := parseFile(inputs, flags, dataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+
+	uiw := newUniqueIdWriters(flags, nil, nil, "\n")
+	for _, uniqueId := range uniqueIds {
+		filePath := strings.TrimSuffix(uiw.filePath(uniqueId), lockedFileSuffix)
+		b, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Errorf("calling os.ReadFile: %s", err)
+		}
+		if rows := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"); len(rows) != 1 || !strings.HasPrefix(rows[0], uniqueId+"|") {
+			t.Errorf("unique ID: %s, file: %s, output:\n%s", uniqueId, filepath.Base(filePath), b)
+		}
+	}
+}
+
+// TestParseFile_dryRun verifies a dry run writes no files, and that the estimate matches the
+// output of a real run.
+func TestParseFile_dryRun(t *testing.T) {
+	inputs := testSetup(t)
+	flags := flags{dryRun: true}
+	dryRunResult, err := parseFile(inputs, flags, testDataFilePath)
+	if err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+	files, _ := os.ReadDir(dataDirectory)
+	if len(files) != 0 {
+		t.Errorf("dry run wrote files: %+v", files)
+	}
+
+	flags.dryRun = false
+	result, err := parseFile(inputs, flags, testDataFilePath)
+	if err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+	fileInfo, err := os.Stat(filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.Stat: %s", err)
+	}
+	if dryRunResult.outputRows != 7 || dryRunResult.outputRows != result.outputRows ||
+		dryRunResult.outputBytes != fileInfo.Size() {
+		t.Errorf("dry run rows: %d, bytes: %d, real run rows: %d, bytes: %d",
+			dryRunResult.outputRows, dryRunResult.outputBytes, result.outputRows, fileInfo.Size())
+	}
+}
+
+// TestParseFileEngine_sorted verifies repeated runs over a directory in sorted mode produce
+// identical combined output, with files processed in filename order.
+func TestParseFileEngine_sorted(t *testing.T) {
+	testSetup(t)
+	inputs, err := parser.NewInputs("./inputs/exampleInputWithHashing.json")
+	if err != nil {
+		t.Fatalf("calling NewInputs: %s", err)
+	}
+	inputs.DataDirectory = t.TempDir()
+	testFileBytes, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	for _, name := range []string{"c.txt", "a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(inputs.DataDirectory, name), testFileBytes, 0644); err != nil {
+			t.Fatalf("calling os.WriteFile: %s", err)
+		}
+	}
+	files, err := os.ReadDir(inputs.DataDirectory)
+	if err != nil {
+		t.Fatalf("calling os.ReadDir: %s", err)
+	}
+
+	combinedOutputs := []string{}
+	for run := 0; run < 2; run++ {
+		results, err := parseFileEngine(inputs, files, flags{sorted: true, threads: 6})
+		if err != nil {
+			t.Errorf("calling parseFileEngine: %s", err)
+		}
+		combined := ""
+		for i, result := range results {
+			if filepath.Base(result.dataFilePath) != []string{"a.txt", "b.txt", "c.txt"}[i] {
+				t.Errorf("file %d processed out of order: %s", i, result.dataFilePath)
+			}
+			for _, suffix := range []string{parsedOutputFileSuffix, hashesOutputFileSuffix} {
+				b, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(result.dataFilePath)+suffix))
+				if err != nil {
+					t.Errorf("calling os.ReadFile: %s", err)
+				}
+				combined += string(b)
+			}
+		}
+		combinedOutputs = append(combinedOutputs, combined)
+	}
+
+	if combinedOutputs[0] == "" || combinedOutputs[0] != combinedOutputs[1] {
+		t.Errorf("combined output differs between runs:\n%s\n%s", combinedOutputs[0], combinedOutputs[1])
+	}
+}
+
+// TestParseFileEngine_fileFormats verifies files matching different FileFormats patterns are
+// split with different delimiters.
+func TestParseFileEngine_fileFormats(t *testing.T) {
+	testSetup(t)
+	inputs := &parser.Inputs{
+		DataDirectory:   t.TempDir(),
+		InputDelimiter:  `\s`,
+		OutputDelimiter: "|",
+		FileFormats: []*parser.FileFormat{
+			{Pattern: "*.csv", InputDelimiter: `,`, ExpectedFieldCount: 3},
+			{Pattern: "*.tsv", InputDelimiter: `\t`, ExpectedFieldCount: 2},
+		},
+	}
+	data := map[string]string{
+		"a.csv": "a b,c,d\n",
+		"b.tsv": "a b,c\td\n",
+	}
+	for name, d := range data {
+		if err := os.WriteFile(filepath.Join(inputs.DataDirectory, name), []byte(d), 0644); err != nil {
+			t.Fatalf("calling os.WriteFile: %s", err)
+		}
+	}
+	files, err := os.ReadDir(inputs.DataDirectory)
+	if err != nil {
+		t.Fatalf("calling os.ReadDir: %s", err)
+	}
+
+	if _, err := parseFileEngine(inputs, files, flags{threads: 2}); err != nil {
+		t.Errorf("calling parseFileEngine: %s", err)
+	}
+
+	expected := map[string]string{
+		"a.csv": "|a b|c|d|EXTRACTS|\n",
+		"b.tsv": "|a b,c|d|EXTRACTS|\n",
+	}
+	for name, output := range expected {
+		b, err := os.ReadFile(filepath.Join(dataDirectory, name+parsedOutputFileSuffix))
+		if err != nil {
+			t.Errorf("calling os.ReadFile: %s", err)
+		}
+		if string(b) != output {
+			t.Errorf("file: %s, output: %s, expected: %s", name, b, output)
+		}
+	}
+}
+
+// TestParseFileEngine_inputCharset verifies, with CHARSET_AUTO, a UTF-8 file with a byte order
+// mark and a Latin-1 file in the same directory are both decoded correctly.
+func TestParseFileEngine_inputCharset(t *testing.T) {
+	testSetup(t)
+	inputs := &parser.Inputs{
+		DataDirectory:      t.TempDir(),
+		ExpectedFieldCount: 2,
+		InputCharset:       parser.CHARSET_AUTO,
+		InputDelimiter:     `,`,
+		OutputDelimiter:    "|",
+	}
+	data := map[string][]byte{
+		"bom.txt":    append([]byte{0xef, 0xbb, 0xbf}, []byte("café,naïve\n")...),
+		"latin1.txt": []byte("caf\xe9,na\xefve\n"),
+	}
+	for name, d := range data {
+		if err := os.WriteFile(filepath.Join(inputs.DataDirectory, name), d, 0644); err != nil {
+			t.Fatalf("calling os.WriteFile: %s", err)
+		}
+	}
+	files, err := os.ReadDir(inputs.DataDirectory)
+	if err != nil {
+		t.Fatalf("calling os.ReadDir: %s", err)
+	}
+
+	if _, err := parseFileEngine(inputs, files, flags{threads: 2}); err != nil {
+		t.Errorf("calling parseFileEngine: %s", err)
+	}
+
+	for name := range data {
+		b, err := os.ReadFile(filepath.Join(dataDirectory, name+parsedOutputFileSuffix))
+		if err != nil {
+			t.Errorf("calling os.ReadFile: %s", err)
+		}
+		if expected := "|café|naïve|EXTRACTS|\n"; string(b) != expected {
+			t.Errorf("file: %s, output: %q, expected: %q", name, b, expected)
+		}
+	}
+}
+
+// TestParseFile_outputNewline verifies parsed output rows, hashes, and message type IDs end with
+// CRLF when configured.
+func TestParseFile_outputNewline(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.HashColumns = []int{7}
+	inputs.MessageTypeIdPrefix = "MT"
+	inputs.OutputNewline = "crlf"
+	if _, err := parseFile(inputs, flags{}, testDataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+	for _, suffix := range []string{parsedOutputFileSuffix, hashesOutputFileSuffix, messageTypesFileSuffix} {
+		b, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+suffix))
+		if err != nil {
+			t.Fatalf("calling os.ReadFile: %s", err)
+		}
+		lines := strings.SplitAfter(string(b), "\n")
+		lines = lines[:len(lines)-1]
+		if len(lines) == 0 || suffix == parsedOutputFileSuffix && len(lines) != 7 {
+			t.Errorf("file: %s, wrong number of lines: %d", suffix, len(lines))
+		}
+		for _, line := range lines {
+			if !strings.HasSuffix(line, "\r\n") {
+				t.Errorf("file: %s, line does not end with CRLF: %q", suffix, line)
+			}
+		}
+	}
+}
+
+// TestParseFileEngine_consolidated verifies consolidated output is in filename order, regardless
+// of the order in which files complete.
+func TestParseFileEngine_consolidated(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.DataDirectory = t.TempDir()
+	testFileBytes, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	// The first file is much larger so it is likely to complete last.
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	for i, name := range names {
+		data := testFileBytes
+		if i == 0 {
+			data = bytes.Repeat(testFileBytes, 200)
+		}
+		if err := os.WriteFile(filepath.Join(inputs.DataDirectory, name), data, 0644); err != nil {
+			t.Fatalf("calling os.WriteFile: %s", err)
+		}
+	}
+	files, err := os.ReadDir(inputs.DataDirectory)
+	if err != nil {
+		t.Fatalf("calling os.ReadDir: %s", err)
+	}
+
+	// Expected output is the per file output in filename order.
+	if _, err := parseFileEngine(inputs, files, flags{sorted: true}); err != nil {
+		t.Errorf("calling parseFileEngine: %s", err)
+	}
+	expected := ""
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(dataDirectory, name+parsedOutputFileSuffix))
+		if err != nil {
+			t.Errorf("calling os.ReadFile: %s", err)
+		}
+		expected += string(b)
+	}
+
+	for run := 0; run < 3; run++ {
+		if _, err := parseFileEngine(inputs, files, flags{consolidatedFile: "consolidated.txt", threads: 3}); err != nil {
+			t.Errorf("calling parseFileEngine: %s", err)
+		}
+		b, err := os.ReadFile(filepath.Join(dataDirectory, "consolidated.txt"))
+		if err != nil {
+			t.Errorf("calling os.ReadFile: %s", err)
+		}
+		if string(b) != expected {
+			t.Errorf("consolidated output not in filename order, run: %d", run)
+		}
+	}
+
+	// Later sweeps when watching append to the output of earlier sweeps.
+	if _, err := parseFileEngine(inputs, files, flags{consolidatedAppend: true, consolidatedFile: "consolidated.txt", threads: 3}); err != nil {
+		t.Errorf("calling parseFileEngine: %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dataDirectory, "consolidated.txt"))
+	if err != nil {
+		t.Errorf("calling os.ReadFile: %s", err)
+	}
+	if string(b) != expected+expected {
+		t.Errorf("consolidated output not appended")
+	}
+	if temporary, _ := filepath.Glob(filepath.Join(dataDirectory, "*"+lockedFileSuffix)); len(temporary) > 0 {
+		t.Errorf("temporary output files not removed: %q", temporary)
+	}
+}
+
+// TestParseFile_tee verifies the delimited output and SQL output are both written with tee, with
+// one SQL INSERT per parsed row.
+func TestParseFile_tee(t *testing.T) {
+	inputs := testSetup(t)
+	flags := flags{
+		hashFormat:   parser.HASH_FORMAT_SQL,
+		sqlDataTable: "parsed",
+		sqlColumns:   10,
+		tee:          true,
+	}
+	if _, err := parseFile(inputs, flags, testDataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+
+	parsed, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	sql, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+sqlOutputFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	parsedLines := strings.Split(strings.TrimSuffix(string(parsed), "\n"), "\n")
+	sqlLines := strings.Split(strings.TrimSuffix(string(sql), "\n"), "\n")
+	// The SQL output has the transaction begin and end lines.
+	if len(sqlLines) != len(parsedLines)+2 {
+		t.Fatalf("line count mismatch, parsed: %d, sql: %d", len(parsedLines), len(sqlLines))
+	}
+	if strings.Contains(string(parsed), "INSERT ") {
+		t.Errorf("parsed output contains SQL")
+	}
+	for i, line := range sqlLines[1 : len(sqlLines)-1] {
+		if !strings.HasPrefix(line, "INSERT OR IGNORE INTO parsed VALUES(") {
+			t.Errorf("SQL line %d not an INSERT: %s", i, line)
+		}
+	}
+}
+
+// TestParseFileEngine_maxOpenFiles verifies processing completes, and the limit is not exceeded,
+// with a limit lower than the number of files the threads would otherwise have open.
+func TestParseFileEngine_maxOpenFiles(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.DataDirectory = t.TempDir()
+	testFileBytes, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	names := []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt", "f.txt"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(inputs.DataDirectory, name), testFileBytes, 0644); err != nil {
+			t.Fatalf("calling os.WriteFile: %s", err)
+		}
+	}
+	files, err := os.ReadDir(inputs.DataDirectory)
+	if err != nil {
+		t.Fatalf("calling os.ReadDir: %s", err)
+	}
+
+	results, err := parseFileEngine(inputs, files, flags{maxOpenFiles: 3, threads: 6})
+	if err != nil {
+		t.Errorf("calling parseFileEngine: %s", err)
+	}
+	if len(results) != len(names) {
+		t.Errorf("wrong number of results: %d", len(results))
+	}
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(dataDirectory, name+parsedOutputFileSuffix)); err != nil {
+			t.Errorf("missing output: %s", err)
+		}
+	}
+
+	limiter := newOpenFiles(3)
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			acquired := limiter.acquire(2)
+			time.Sleep(time.Millisecond)
+			limiter.release(acquired)
+		}()
+	}
+	wg.Wait()
+	if limiter.peak > 3 || limiter.open != 0 {
+		t.Errorf("limit exceeded, peak: %d, open: %d", limiter.peak, limiter.open)
+	}
+}
+
+// TestParseFile_maxMemory verifies that when memory is high hashes are spilled and merged back,
+// resulting in the same hashes output as processing without a memory limit.
+func TestParseFile_maxMemory(t *testing.T) {
+	testSetup(t)
+	inputs, err := parser.NewInputs("./inputs/exampleInputWithHashing.json")
+	if err != nil {
+		t.Fatalf("calling NewInputs: %s", err)
+	}
+	testFileBytes, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	dataFilePath := filepath.Join(t.TempDir(), "large.txt")
+	if err := os.WriteFile(dataFilePath, bytes.Repeat(testFileBytes, 500), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	hashesFilePath := filepath.Join(dataDirectory, filepath.Base(dataFilePath)+hashesOutputFileSuffix)
+
+	if _, err := parseFile(inputs, flags{}, dataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+	expected, err := os.ReadFile(hashesFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+
+	// Memory is reported high on each check, then low once degradation has run.
+	defer func(f func() uint64) { memoryInUse = f }(memoryInUse)
+	calls := 0
+	memoryInUse = func() uint64 {
+		calls++
+		if calls%2 == 1 {
+			return 1e9
+		}
+		return 0
+	}
+	if _, err := parseFile(inputs, flags{maxMemory: 1}, dataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+	if calls < 2 {
+		t.Errorf("degradation did not run, memory checks: %d", calls)
+	}
+	actual, err := os.ReadFile(hashesFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	if string(actual) != string(expected) {
+		t.Errorf("hashes differ with spilling:\n%s\n%s", expected, actual)
+	}
+	if _, err := os.Stat(hashesFilePath + lockedFileSuffix + hashesSpillFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("spill file not removed: %v", err)
+	}
+
+	scnr, err := parser.NewScanner(*inputs)
+	if err != nil {
+		t.Fatalf("calling NewScanner: %s", err)
+	}
+	scnr.HashCounts["'0x01'"] = 2
+	scnr.HashMap["'0x01'"] = "value"
+	spilled := degradeMemory(scnr, flags{maxMemory: 1}, filepath.Join(dataDirectory, "degrade"), func() error { return nil })
+	if spilled != 1 || len(scnr.HashCounts) != 0 || len(scnr.HashMap) != 0 {
+		t.Errorf("hashes not spilled, spilled: %d, hashes: %d", spilled, len(scnr.HashCounts))
+	}
+	// The in memory value is kept, as it is the most recent.
+	scnr.HashCounts["'0x01'"] = 1
+	scnr.HashMap["'0x01'"] = "newer value"
+	spillFilePath := filepath.Join(dataDirectory, "degrade"+hashesSpillFileSuffix)
+	if err := mergeSpilledHashes(scnr, spillFilePath); err != nil {
+		t.Errorf("calling mergeSpilledHashes: %s", err)
+	}
+	if scnr.HashCounts["'0x01'"] != 3 || scnr.HashMap["'0x01'"] != "newer value" {
+		t.Errorf("hashes not merged, counts: %+v, values: %+v", scnr.HashCounts, scnr.HashMap)
+	}
+	if _, err := os.Stat(spillFilePath); !os.IsNotExist(err) {
+		t.Errorf("spill file not removed: %v", err)
+	}
+
+	// A spill file that cannot be read is kept, and the hashes are unchanged.
+	if err := os.WriteFile(spillFilePath, []byte("'0x02'|not a count|value\n"), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	if err := mergeSpilledHashes(scnr, spillFilePath); err == nil {
+		t.Errorf("expected ReadHashes error")
+	}
+	if len(scnr.HashCounts) != 1 || scnr.HashCounts["'0x01'"] != 3 {
+		t.Errorf("hashes changed, counts: %+v", scnr.HashCounts)
+	}
+	if _, err := os.Stat(spillFilePath); err != nil {
+		t.Errorf("spill file not kept: %s", err)
+	}
+}
+
+// TestParseFile_schema verifies the schema file describes the parsed output columns for a run
+// with hashing and extracts.
+func TestParseFile_schema(t *testing.T) {
+	testSetup(t)
+	inputs, err := parser.NewInputs("./inputs/exampleInputWithHashing.json")
+	if err != nil {
+		t.Fatalf("calling NewInputs: %s", err)
+	}
+	if _, err := parseFile(inputs, flags{}, testDataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+schemaFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	schema := outputSchema{}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatalf("calling json.Unmarshal: %s", err)
+	}
+	if schema.OutputFormat != outputFormatDelimited || !schema.UniqueId || len(schema.Columns) != 4 || len(schema.Extracts) != 5 {
+		t.Fatalf("wrong schema: %+v", schema)
+	}
+	hashColumn := schema.Columns[3]
+	if !hashColumn.Hashed || hashColumn.Type != "hash" || !slices.Equal(hashColumn.SplitColumns, []int{3, 4, 5, 6, 7}) {
+		t.Errorf("wrong hash column: %+v", hashColumn)
+	}
+
+	b, err = os.ReadFile(filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	firstRow := strings.Split(string(b), "\n")[0]
+	columns := strings.Split(strings.Split(firstRow, "|EXTRACTS|")[0], inputs.OutputDelimiter)
+	if len(columns) != len(schema.Columns)+1 {
+		t.Errorf("schema has %d columns, plus unique ID, output has %d: %s", len(schema.Columns), len(columns), firstRow)
+	}
+	if !strings.HasPrefix(columns[4], "'0x") {
+		t.Errorf("output column 4 is not a hash: %s", columns[4])
+	}
+}
+
+// TestParseFile_renameFails verifies an error renaming an output file is reported, and the
+// output file is left with the lockedFileSuffix.
+func TestParseFile_renameFails(t *testing.T) {
+	inputs := testSetup(t)
+	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix)
+	if err := os.MkdirAll(filepath.Join(parsedOutputFilePath, "blocker"), 0777); err != nil {
+		t.Fatalf("calling os.MkdirAll: %s", err)
+	}
+
+	result, err := parseFile(inputs, flags{}, testDataFilePath)
+	if err == nil {
+		t.Errorf("expected rename error")
+	}
+	if len(result.renameErrors) != 1 {
+		t.Errorf("wrong rename errors: %+v", result.renameErrors)
+	}
+	if _, err := os.Stat(parsedOutputFilePath + lockedFileSuffix); err != nil {
+		t.Errorf("locked output file missing: %s", err)
+	}
+}
+
+// TestParseFile_appendHashesReadError verifies that, in append mode, an existing hashes file that
+// cannot be read by ReadHashes is not replaced and parseFile returns an error.
+func TestParseFile_appendHashesReadError(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.Extracts = nil
+	inputs.HashEntireRow = true
+	hashesFilePath := filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+hashesOutputFileSuffix)
+	// The hash|value layout written without append mode can not be read by ReadHashes.
+	existing := "somehash|some value\n"
+	if err := os.WriteFile(hashesFilePath, []byte(existing), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+
+	if _, err := parseFile(inputs, flags{appendHashes: true}, testDataFilePath); err == nil {
+		t.Errorf("expected ReadHashes error")
+	}
+	b, err := os.ReadFile(hashesFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	if string(b) != existing {
+		t.Errorf("existing hashes file was replaced: %q", b)
+	}
+	if _, err := os.Stat(hashesFilePath + lockedFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("locked hashes file was created: %v", err)
+	}
+}
+
+// TestParseFile_recentRows verifies parsed rows are kept in the recentRows and returned by the
+// HTTP endpoint, most recent last.
+func TestParseFile_recentRows(t *testing.T) {
+	inputs := testSetup(t)
+	recent := newRecentRows(5)
+	if _, err := parseFile(inputs, flags{recent: recent}, testDataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	parsedRows := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+
+	server := httptest.NewServer(recent)
+	defer server.Close()
+	for _, test := range []struct {
+		query    string
+		expected []string
+	}{
+		{"?n=2", parsedRows[len(parsedRows)-2:]},
+		{"", parsedRows[len(parsedRows)-5:]},
+		{"?n=0", []string{}},
+	} {
+		resp, err := http.Get(server.URL + recentPath + test.query)
+		if err != nil {
+			t.Fatalf("calling http.Get: %s", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		rows := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+		if len(body) == 0 {
+			rows = []string{}
+		}
+		if resp.StatusCode != http.StatusOK || !slices.Equal(rows, test.expected) {
+			t.Errorf("query: %s, status: %d, rows: %q, expected: %q", test.query, resp.StatusCode, rows, test.expected)
+		}
+	}
+
+	resp, err := http.Get(server.URL + recentPath + "?n=x")
+	if err != nil {
+		t.Fatalf("calling http.Get: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("wrong status for invalid n: %d", resp.StatusCode)
+	}
+}
+
+// TestParseFileEngine_merge verifies the parsed output of two time ordered files is merged into
+// one time ordered output, with the configured newline.
+func TestParseFileEngine_merge(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.DataDirectory = t.TempDir()
+	testFileBytes, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	// Split the time ordered test data into two time ordered files, alternating rows.
+	hosts := [][]string{{}, {}}
+	for i, row := range strings.Split(strings.TrimSpace(string(testFileBytes)), "\n")[1:] {
+		hosts[i%2] = append(hosts[i%2], row)
+	}
+	for i, name := range []string{"host1.txt", "host2.txt"} {
+		if err := os.WriteFile(filepath.Join(inputs.DataDirectory, name), []byte(strings.Join(hosts[i], "\n")), 0644); err != nil {
+			t.Fatalf("calling os.WriteFile: %s", err)
+		}
+	}
+	files, err := os.ReadDir(inputs.DataDirectory)
+	if err != nil {
+		t.Fatalf("calling os.ReadDir: %s", err)
+	}
+
+	for _, newline := range []string{"lf", "crlf"} {
+		inputs.OutputNewline = newline
+		if _, err := parseFileEngine(inputs, files, flags{mergeColumn: 1, mergeFile: "merged.txt", threads: 2}); err != nil {
+			t.Errorf("calling parseFileEngine: %s", err)
+		}
+		b, err := os.ReadFile(filepath.Join(dataDirectory, "merged.txt"))
+		if err != nil {
+			t.Fatalf("calling os.ReadFile: %s", err)
+		}
+		rows := strings.SplitAfter(string(b), "\n")
+		rows = rows[:len(rows)-1]
+		if len(rows) != 7 {
+			t.Fatalf("newline: %s, wrong number of merged rows: %d", newline, len(rows))
+		}
+		for i, row := range rows {
+			expected := fmt.Sprintf("2023-10-07 12:00:00.%02d MDT", i)
+			if strings.Split(row, inputs.OutputDelimiter)[1] != expected {
+				t.Errorf("newline: %s, row %d out of order: %s", newline, i, row)
+			}
+			if (newline == "crlf") != strings.HasSuffix(row, "\r\n") {
+				t.Errorf("newline: %s, row %d wrong newline: %q", newline, i, row)
+			}
+		}
+	}
+}
+
+// TestParseFile_explode verifies a row with three sub-events is output as three rows.
+func TestParseFile_explode(t *testing.T) {
+	testSetup(t)
+	inputs := &parser.Inputs{
+		ExpectedFieldCount: 2,
+		Extracts: []*parser.Extract{
+			{Columns: []int{1}, Explode: true, RegexString: `event=(\w+)`, Submatch: 1, Token: "event={}"},
+		},
+		InputDelimiter:  ",",
+		OutputDelimiter: "|",
+	}
+	dataFilePath := filepath.Join(t.TempDir(), "batch.txt")
+	if err := os.WriteFile(dataFilePath, []byte("host1,batch event=start event=run event=stop\nhost2,no events\n"), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	if _, err := parseFile(inputs, flags{}, dataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+
+	parsed, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(dataFilePath)+parsedOutputFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	want := []string{
+		"|host1|batch event={} event={} event={}|EXTRACTS|start",
+		"|host1|batch event={} event={} event={}|EXTRACTS|run",
+		"|host1|batch event={} event={} event={}|EXTRACTS|stop",
+		"|host2|no events|EXTRACTS|",
+	}
+	if got := strings.Split(strings.TrimSuffix(string(parsed), "\n"), "\n"); !slices.Equal(got, want) {
+		t.Errorf("parsed output mismatch\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+// TestParseFile_noMove verifies the input file is left in place, despite the Inputs having a
+// ProcessedInputDirectory, when noMove is set.
+func TestParseFile_noMove(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.ProcessedInputDirectory = t.TempDir()
+	dataFilePath := filepath.Join(t.TempDir(), filepath.Base(testDataFilePath))
+	testFileBytes, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	if err := os.WriteFile(dataFilePath, testFileBytes, 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+
+	if _, err := parseFile(inputs, flags{noMove: true}, dataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+	if _, err := os.Stat(dataFilePath); err != nil {
+		t.Errorf("input file moved: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(inputs.ProcessedInputDirectory, filepath.Base(dataFilePath))); !os.IsNotExist(err) {
+		t.Errorf("input file in ProcessedInputDirectory, error: %v", err)
+	}
+
+	if _, err := parseFile(inputs, flags{}, dataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+	if _, err := os.Stat(dataFilePath); !os.IsNotExist(err) {
+		t.Errorf("input file not moved without noMove, error: %v", err)
+	}
+}
+
+// TestParseFile_maxErrors verifies processing aborts, leaving the output locked, when the number
+// of errors exceeds Inputs.MaxErrors.
+func TestParseFile_maxErrors(t *testing.T) {
+	testSetup(t)
+	inputs := &parser.Inputs{
+		ExpectedFieldCount: 2,
+		InputDelimiter:     ",",
+		MaxErrors:          3,
+		OutputDelimiter:    "|",
+	}
+	dataFilePath := filepath.Join(t.TempDir(), "errors.txt")
+	var data strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&data, "bad%d\ngood,%d\n", i, i)
+	}
+	if err := os.WriteFile(dataFilePath, []byte(data.String()), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+
+	result, err := parseFile(inputs, flags{}, dataFilePath)
+	if !errors.Is(err, parser.ErrMaxErrors) {
+		t.Errorf("expected ErrMaxErrors, got: %v", err)
+	}
+	// The fourth error aborts processing; the three good rows before it were output.
+	if result.outputRows != 3 {
+		t.Errorf("output rows, got: %d, want: 3", result.outputRows)
+	}
+	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(dataFilePath)+parsedOutputFileSuffix)
+	if _, err := os.Stat(parsedOutputFilePath + lockedFileSuffix); err != nil {
+		t.Errorf("aborted output not left locked: %s", err)
+	}
+	if _, err := os.Stat(parsedOutputFilePath); !os.IsNotExist(err) {
+		t.Errorf("aborted output unlocked, error: %v", err)
+	}
+}
+
+// TestParseFile_errorsFile verifies the errors file has the line number and line of each
+// malformed line.
+func TestParseFile_errorsFile(t *testing.T) {
+	testSetup(t)
+	inputs := &parser.Inputs{
+		ExpectedFieldCount: 2,
+		InputDelimiter:     ",",
+		OutputDelimiter:    "|",
+	}
+	dataFilePath := filepath.Join(t.TempDir(), "malformed.txt")
+	if err := os.WriteFile(dataFilePath, []byte("a,1\nmissing field\nb,2\nc,3,extra\n"), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	if _, err := parseFile(inputs, flags{errorsFile: true}, dataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+
+	errorsOutput, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(dataFilePath)+errorsFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	want := []string{
+		"line: 2, error: Split expectedFieldCount: 2, actual: 1, row: missing field",
+		"line: 4, error: Split expectedFieldCount: 2, actual: 3, row: c,3,extra",
+	}
+	if got := strings.Split(strings.TrimSuffix(string(errorsOutput), "\n"), "\n"); !slices.Equal(got, want) {
+		t.Errorf("errors output mismatch\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+// TestParseFile_hashColumnsIndividually verifies a hashes file is written for each hash column,
+// with the counts for that column.
+func TestParseFile_hashColumnsIndividually(t *testing.T) {
+	testSetup(t)
+	inputs := &parser.Inputs{
+		ExpectedFieldCount:      3,
+		HashColumns:             []int{0, 2},
+		HashColumnsIndividually: true,
+		InputDelimiter:          ",",
+		OutputDelimiter:         "|",
+	}
+	dataFilePath := filepath.Join(t.TempDir(), "columns.txt")
+	if err := os.WriteFile(dataFilePath, []byte("a,1,x\na,2,y\nb,3,x\n"), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	if _, err := parseFile(inputs, flags{}, dataFilePath); err != nil {
+		t.Errorf("calling parseFile: %s", err)
+	}
+
+	hashesOutputFilePath := filepath.Join(dataDirectory, filepath.Base(dataFilePath)+hashesOutputFileSuffix)
+	for column, want := range map[int][]string{0: {"2|a", "1|b"}, 2: {"2|x", "1|y"}} {
+		columnHashes, err := os.ReadFile(columnHashesFilePath(hashesOutputFilePath, column))
+		if err != nil {
+			t.Fatalf("calling os.ReadFile: %s", err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(columnHashes), "\n"), "\n")
+		if len(lines) != len(want) {
+			t.Fatalf("column %d hashes, got: %q, want counts and values: %q", column, lines, want)
+		}
+		for i, line := range lines {
+			if !strings.HasSuffix(line, "|"+want[i]) {
+				t.Errorf("column %d hashes line %d, got: %s, want suffix: %s", column, i, line, want[i])
+			}
+		}
+	}
+}
+
+// TestParseFile_url verifies data is read from an HTTP URL, including gzip Content-Encoding.
+func TestParseFile_url(t *testing.T) {
+	testSetup(t)
+	inputs := &parser.Inputs{
+		ExpectedFieldCount: 2,
+		InputDelimiter:     ",",
+		OutputDelimiter:    "|",
+	}
+	logLines := "a,1\nb,2\nc,3\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/compressed.log" {
+			w.Header().Set("Content-Encoding", "gzip")
+			gzipWriter := gzip.NewWriter(w)
+			gzipWriter.Write([]byte(logLines))
+			gzipWriter.Close()
+			return
+		}
+		if r.URL.Path != "/logs/app.log" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(logLines))
+	}))
+	defer server.Close()
+
+	for _, urlPath := range []string{"/logs/app.log?day=1", "/compressed.log"} {
+		result, err := parseFile(inputs, flags{}, server.URL+urlPath)
+		if err != nil {
+			t.Errorf("calling parseFile: %s", err)
+		}
+		if result.outputRows != 3 {
+			t.Errorf("url: %s, output rows, got: %d, want: 3", urlPath, result.outputRows)
+		}
+	}
+	parsed, err := os.ReadFile(filepath.Join(dataDirectory, "app.log"+parsedOutputFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	if want := "|a|1|EXTRACTS|\n|b|2|EXTRACTS|\n|c|3|EXTRACTS|\n"; string(parsed) != want {
+		t.Errorf("parsed output, got: %q, want: %q", parsed, want)
+	}
+}
+
+// TestParseFile_checksum verifies the checksum computed while reading matches the SHA256 of the
+// data file, for plain and gzip compressed files.
+func TestParseFile_checksum(t *testing.T) {
+	inputs := testSetup(t)
+	testFileBytes, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write(testFileBytes)
+	gzipWriter.Close()
+	gzipFilePath := filepath.Join(t.TempDir(), filepath.Base(testDataFilePath)+".gz")
+	if err := os.WriteFile(gzipFilePath, compressed.Bytes(), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+
+	for dataFilePath, fileBytes := range map[string][]byte{testDataFilePath: testFileBytes, gzipFilePath: compressed.Bytes()} {
+		result, err := parseFile(inputs, flags{checksum: true, dryRun: true}, dataFilePath)
+		if err != nil {
+			t.Errorf("calling parseFile: %s", err)
+		}
+		if want := fmt.Sprintf("%x", sha256.Sum256(fileBytes)); result.checksum != want {
+			t.Errorf("file: %s, checksum, got: %s, want: %s", dataFilePath, result.checksum, want)
+		}
+	}
+}
+
+// TestParseFile_sqlFieldCountPad verifies, in SQL mode, a short row is padded so the VALUES align
+// with the table columns, and a short row is skipped with the default policy.
+func TestParseFile_sqlFieldCountPad(t *testing.T) {
+	testSetup(t)
+	dataFilePath := filepath.Join(t.TempDir(), "short.txt")
+	if err := os.WriteFile(dataFilePath, []byte("a,b,c\nd,e\n"), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	flags := flags{hashFormat: parser.HASH_FORMAT_SQL, sqlColumns: 4, sqlDataTable: "parsed"}
+	for _, test := range []struct {
+		policy parser.FieldCountPolicy
+		want   []string
+	}{
+		{parser.FIELD_COUNT_ERROR, []string{"INSERT OR IGNORE INTO parsed VALUES('a','b','c',NULL);"}},
+		{parser.FIELD_COUNT_PAD, []string{"INSERT OR IGNORE INTO parsed VALUES('a','b','c',NULL);",
+			"INSERT OR IGNORE INTO parsed VALUES('d','e','',NULL);"}},
+	} {
+		inputs := &parser.Inputs{
+			ExpectedFieldCount: 3,
+			FieldCountPolicy:   test.policy,
+			InputDelimiter:     ",",
+			OutputDelimiter:    "|",
+			SqlQuoteColumns:    []int{0, 1, 2},
+		}
+		if _, err := parseFile(inputs, flags, dataFilePath); err != nil {
+			t.Errorf("calling parseFile: %s", err)
+		}
+		sql, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(dataFilePath)+parsedOutputFileSuffix))
+		if err != nil {
+			t.Fatalf("calling os.ReadFile: %s", err)
+		}
+		// The SQL output has the transaction begin and end lines.
+		lines := strings.Split(strings.TrimSuffix(string(sql), "\n"), "\n")
+		if got := lines[1 : len(lines)-1]; !slices.Equal(got, test.want) {
+			t.Errorf("policy: %d, SQL output mismatch\ngot:  %q\nwant: %q", test.policy, got, test.want)
+		}
+	}
+}
+
+// TestParseFile_stageTimings verifies each stage that runs has calls and a non-zero duration,
+// and that timing is not done unless enabled.
+func TestParseFile_stageTimings(t *testing.T) {
+	testSetup(t)
+	inputs, err := parser.NewInputs("./inputs/exampleInputWithHashing.json")
+	if err != nil {
+		t.Fatalf("calling NewInputs: %s", err)
+	}
+
+	result, err := parseFile(inputs, flags{dryRun: true, stageTimings: true}, testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+	if result.timings == nil {
+		t.Fatalf("no stage timings")
+	}
+	for _, stage := range []int{stageScan, stagePreProcess, stageFilter, stageReplace, stageSplit,
+		stageExtract, stageHash, stageWrite} {
+		if result.timings.calls[stage] == 0 || result.timings.durations[stage] <= 0 {
+			t.Errorf("stage: %s, calls: %d, duration: %s", stageNames[stage], result.timings.calls[stage],
+				result.timings.durations[stage])
+		}
+	}
+	if report := result.timings.report(); !strings.Contains(report, "stage: extract, calls: ") {
+		t.Errorf("report missing extract stage:\n%s", report)
+	}
+
+	result, err = parseFile(inputs, flags{dryRun: true}, testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+	if result.timings != nil {
+		t.Errorf("stage timings when not enabled")
+	}
+}
+
+// TestParseFile_compressionLevel verifies the parsed output is valid gzip at each level, with
+// the same content as uncompressed output, and the best compression is smaller than the fastest.
+func TestParseFile_compressionLevel(t *testing.T) {
+	inputs := testSetup(t)
+	testFileBytes, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	dataFilePath := filepath.Join(t.TempDir(), "large.txt")
+	if err := os.WriteFile(dataFilePath, bytes.Repeat(testFileBytes, 200), 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(dataFilePath)+parsedOutputFileSuffix)
+
+	if _, err := parseFile(inputs, flags{}, dataFilePath); err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+	uncompressed, err := os.ReadFile(parsedOutputFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+
+	sizes := map[int]int{}
+	for _, level := range []int{gzip.BestSpeed, 5, gzip.BestCompression} {
+		inputs.CompressionLevel = level
+		if _, err := parseFile(inputs, flags{}, dataFilePath); err != nil {
+			t.Fatalf("level: %d, calling parseFile: %s", level, err)
+		}
+		compressed, err := os.ReadFile(parsedOutputFilePath + gzipFileSuffix)
+		if err != nil {
+			t.Fatalf("level: %d, calling os.ReadFile: %s", level, err)
+		}
+		sizes[level] = len(compressed)
+		gzipReader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("level: %d, calling gzip.NewReader: %s", level, err)
+		}
+		decompressed, err := io.ReadAll(gzipReader)
+		if err != nil {
+			t.Fatalf("level: %d, decompressing: %s", level, err)
+		}
+		if !bytes.Equal(decompressed, uncompressed) {
+			t.Errorf("level: %d, decompressed output differs from uncompressed output", level)
+		}
+	}
+	if sizes[gzip.BestCompression] >= sizes[gzip.BestSpeed] || sizes[gzip.BestSpeed] >= len(uncompressed) {
+		t.Errorf("sizes: %v, uncompressed: %d", sizes, len(uncompressed))
+	}
+
+	inputs.CompressionLevel = 10
+	if _, err := parser.NewScanner(*inputs); err == nil {
+		t.Errorf("expected error for CompressionLevel 10")
+	}
+}
+
+// TestParseFile_runId verifies the run ID is in the log, in a column of the parsed output, and in
+// the SQL provenance column.
+func TestParseFile_runId(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.SqlProvenance = true
+	var logged []string
+	var loggedMutex sync.Mutex
+	defaultLpf := lpf
+	lpf = func(level logh.LoghLevel, format string, v ...any) {
+		loggedMutex.Lock()
+		defer loggedMutex.Unlock()
+		logged = append(logged, fmt.Sprintf(format, v...))
+	}
+	defer func() { lpf = defaultLpf }()
+	runId := newRunId()
+	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix)
+
+	if _, err := parseFile(inputs, flags{runId: runId, runIdColumn: true}, testDataFilePath); err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+	b, err := os.ReadFile(parsedOutputFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if !strings.Contains(line, "|"+runId+"|EXTRACTS|") {
+			t.Errorf("run ID column missing: %s", line)
+		}
+	}
+
+	flags := flags{runId: runId, runIdColumn: true, sqlColumns: 20, sqlDataTable: "parsed"}
+	if _, err := parseFile(inputs, flags, testDataFilePath); err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+	b, err = os.ReadFile(parsedOutputFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	inserts := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if !strings.HasPrefix(line, "INSERT") {
+			continue
+		}
+		inserts++
+		if !strings.HasSuffix(line, ",'"+runId+"');") {
+			t.Errorf("run ID provenance column missing: %s", line)
+		}
+	}
+	if inserts == 0 {
+		t.Errorf("no SQL output:\n%s", b)
+	}
+
+	if !slices.Contains(logged, fmt.Sprintf("run ID: %s, data file: %s", runId, testDataFilePath)) {
+		t.Errorf("run ID not logged: %q", logged)
+	}
+}
+
+// TestParseFile_syslog verifies each parsed row is forwarded to syslog as an RFC5424 message with
+// the facility and severity priority, as one datagram over UDP, and with octet counting over TCP.
+func TestParseFile_syslog(t *testing.T) {
+	inputs := testSetup(t)
+	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix)
+	// local0 (16) * 8 + notice (5)
+	prefix := "<133>1 "
+
+	for _, network := range []string{"udp", "tcp"} {
+		var address string
+		received := make(chan []string, 1)
+		switch network {
+		case "udp":
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("calling net.ListenPacket: %s", err)
+			}
+			defer conn.Close()
+			address = conn.LocalAddr().String()
+			go func() {
+				var messages []string
+				buf := make([]byte, 65536)
+				for {
+					conn.SetReadDeadline(time.Now().Add(time.Second))
+					n, _, err := conn.ReadFrom(buf)
+					if err != nil {
+						break
+					}
+					messages = append(messages, string(buf[:n]))
+				}
+				received <- messages
+			}()
+		case "tcp":
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("calling net.Listen: %s", err)
+			}
+			defer listener.Close()
+			address = listener.Addr().String()
+			go func() {
+				var messages []string
+				conn, err := listener.Accept()
+				if err != nil {
+					received <- messages
+					return
+				}
+				defer conn.Close()
+				b, _ := io.ReadAll(conn)
+				// Each message is its length, a space, and the message.
+				for len(b) > 0 {
+					length, rest, ok := bytes.Cut(b, []byte(" "))
+					n, err := strconv.Atoi(string(length))
+					if !ok || err != nil || n > len(rest) {
+						messages = append(messages, "bad framing: "+string(b))
+						break
+					}
+					messages = append(messages, string(rest[:n]))
+					b = rest[n:]
+				}
+				received <- messages
+			}()
+		}
+
+		sw, err := newSyslogWriter(network+"://"+address, "local0", "notice")
+		if err != nil {
+			t.Fatalf("calling newSyslogWriter: %s", err)
+		}
+		if _, err := parseFile(inputs, flags{syslog: sw}, testDataFilePath); err != nil {
+			t.Fatalf("calling parseFile: %s", err)
+		}
+		sw.close()
+		messages := <-received
+
+		b, err := os.ReadFile(parsedOutputFilePath)
+		if err != nil {
+			t.Fatalf("calling os.ReadFile: %s", err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if len(messages) != len(rows) {
+			t.Fatalf("network: %s, messages: %d, rows: %d, messages: %q", network, len(messages), len(rows), messages)
+		}
+		for i, message := range messages {
+			fields := strings.SplitN(message, " ", 7)
+			if !strings.HasPrefix(message, prefix) || len(fields) != 7 || fields[3] != appName || fields[5] != "-" ||
+				fields[6] != "- "+rows[i] {
+				t.Errorf("network: %s, message: %q, row: %q", network, message, rows[i])
+			}
+		}
+	}
+
+	if _, err := newSyslogWriter("udp://127.0.0.1:514", "local9", "info"); err == nil {
+		t.Errorf("expected invalid facility error")
+	}
+	if _, err := newSyslogWriter("http://127.0.0.1:514", "user", "info"); err == nil {
+		t.Errorf("expected invalid address error")
+	}
+}
+
+// TestParseFile_requireExtract verifies rows where no Extract matched are dropped when
+// RequireExtract is true, while rows with extracts are kept.
+func TestParseFile_requireExtract(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.Extracts = []*parser.Extract{{Columns: []int{7}, RegexString: `val=(\d+)`, Submatch: 1, Token: "val={}"}}
+	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix)
+
+	for _, test := range []struct {
+		requireExtract bool
+		rows           int
+	}{{false, 7}, {true, 3}} {
+		inputs.RequireExtract = test.requireExtract
+		if _, err := parseFile(inputs, flags{}, testDataFilePath); err != nil {
+			t.Fatalf("calling parseFile: %s", err)
+		}
+		b, err := os.ReadFile(parsedOutputFilePath)
+		if err != nil {
+			t.Fatalf("calling os.ReadFile: %s", err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if len(rows) != test.rows {
+			t.Errorf("requireExtract: %t, rows: %d, expected: %d\n%s", test.requireExtract, len(rows), test.rows, b)
+		}
+		if !test.requireExtract {
+			continue
+		}
+		for _, row := range rows {
+			if strings.HasSuffix(row, "|EXTRACTS|") {
+				t.Errorf("row without extracts: %s", row)
+			}
+		}
+	}
+}
+
+// TestParseFile_hashEntireRow verifies each output row is just the unique ID and hash, and the
+// hashes file maps each hash to the full row.
+func TestParseFile_hashEntireRow(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.Extracts = nil
+	inputs.HashEntireRow = true
+	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix)
+	hashesFilePath := filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+hashesOutputFileSuffix)
+
+	if _, err := parseFile(inputs, flags{uniqueIdRegex: regexp.MustCompile(`serial number:(\w+)`)}, testDataFilePath); err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+	hashesFile, err := os.ReadFile(hashesFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	hashMap := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(hashesFile)), "\n") {
+		hash, value, _ := strings.Cut(line, hashesOutputDelimiter)
+		hashMap[hash] = value
+	}
+
+	scnr, err := parser.NewScanner(*inputs)
+	if err != nil {
+		t.Fatalf("calling NewScanner: %s", err)
+	}
+	b, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	// The first line is the unique ID.
+	dataRows := strings.Split(strings.TrimSpace(string(b)), "\n")[1:]
+	b, err = os.ReadFile(parsedOutputFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	rows := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(rows) != len(dataRows) {
+		t.Fatalf("rows: %d, expected: %d\n%s", len(rows), len(dataRows), b)
+	}
+	for i, row := range rows {
+		fields := strings.Split(row, "|")
+		if len(fields) != 4 || fields[0] != "SOME_SERIAL" || fields[2] != "EXTRACTS" || fields[3] != "" {
+			t.Errorf("row is not the unique ID and hash: %s", row)
+			continue
+		}
+		splits, _ := scnr.Split(scnr.Replace(dataRows[i]))
+		if hashMap[fields[1]] != strings.Join(splits, scnr.OutputDelimiter) {
+			t.Errorf("hash: %s, maps to: %q, row: %q", fields[1], hashMap[fields[1]], dataRows[i])
+		}
+	}
+
+	inputs.HashColumns = []int{0}
+	if _, err := parser.NewScanner(*inputs); err == nil {
+		t.Errorf("expected HashEntireRow error")
+	}
+}
+
+// TestParseFile_rowId verifies the row ID is the first column, is the hash of the raw input row,
+// and is the same for the same input row across runs.
+func TestParseFile_rowId(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.Extracts = nil
+	inputs.RowId = true
+	parsedOutputFilePath := filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix)
+
+	b, err := os.ReadFile(testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	// The first line is the unique ID.
+	dataRows := strings.Split(strings.TrimSpace(string(b)), "\n")[1:]
+	runRowIds := make([][]string, 2)
+	for run := range runRowIds {
+		if _, err := parseFile(inputs, flags{uniqueIdRegex: regexp.MustCompile(`serial number:(\w+)`)}, testDataFilePath); err != nil {
+			t.Fatalf("calling parseFile: %s", err)
+		}
+		b, err := os.ReadFile(parsedOutputFilePath)
+		if err != nil {
+			t.Fatalf("calling os.ReadFile: %s", err)
+		}
+		rows := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if len(rows) != len(dataRows) {
+			t.Fatalf("rows: %d, expected: %d\n%s", len(rows), len(dataRows), b)
+		}
+		for i, row := range rows {
+			fields := strings.Split(row, "|")
+			rowId, _ := parser.Hash(dataRows[i], parser.HASH_FORMAT_STRING)
+			if len(fields) != inputs.ExpectedFieldCount+4 || fields[1] != rowId {
+				t.Errorf("row ID is not the hash of the row: %s, expected: %s, row: %q", row, rowId, dataRows[i])
+			}
+			runRowIds[run] = append(runRowIds[run], fields[1])
+		}
+	}
+	if !slices.Equal(runRowIds[0], runRowIds[1]) {
+		t.Errorf("row IDs are not the same across runs: %v, %v", runRowIds[0], runRowIds[1])
+	}
+
+	scnr, err := parser.NewScanner(*inputs)
+	if err != nil {
+		t.Fatalf("calling NewScanner: %s", err)
+	}
+	if column := scnr.Schema().Columns[0]; column.Name != "rowId" {
+		t.Errorf("first schema column is not the row ID: %+v", column)
+	}
+}
+
+// TestParseFile_quietSummary verifies quiet mode suppresses the Info logs for a data file, but not
+// warnings, and the format of the summary line.
+func TestParseFile_quietSummary(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.HashColumns = []int{7}
+	var logged []logh.LoghLevel
+	var loggedMutex sync.Mutex
+	defaultLp, defaultLpf := lp, lpf
+	lp = func(level logh.LoghLevel, v ...any) {
+		loggedMutex.Lock()
+		defer loggedMutex.Unlock()
+		logged = append(logged, level)
+	}
+	lpf = func(level logh.LoghLevel, format string, v ...any) { lp(level) }
+	defer func() { lp, lpf = defaultLp, defaultLpf }()
+	countLevel := func(level logh.LoghLevel) int {
+		loggedMutex.Lock()
+		defer loggedMutex.Unlock()
+		count := 0
+		for _, l := range logged {
+			if l == level {
+				count++
+			}
+		}
+		return count
+	}
+
+	result, err := parseFile(inputs, flags{}, testDataFilePath)
+	if err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+	if countLevel(logh.Info) == 0 {
+		t.Fatalf("expected Info logs without quiet")
+	}
+
+	logged = nil
+	lp, lpf = quietLoggers(lp, lpf)
+	if _, err := parseFile(inputs, flags{}, testDataFilePath); err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+	if countLevel(logh.Info) != 0 || countLevel(logh.Debug) != 0 {
+		t.Errorf("Info or Debug logged in quiet mode: %v", logged)
+	}
+	lpf(logh.Warning, "warning")
+	if countLevel(logh.Warning) != 1 {
+		t.Errorf("Warning not logged in quiet mode: %v", logged)
+	}
+
+	var summary runSummary
+	summary.add(result, result)
+	summary.DurationMs = 1500
+	// Hashes are counted once across data files.
+	expected := fmt.Sprintf(`{"Files":2,"Rows":%d,"Errors":%d,"Hashes":%d,"DurationMs":1500}`,
+		2*result.outputRows, 2*result.errors, len(result.hashes))
+	if summary.String() != expected {
+		t.Errorf("summary: %s, expected: %s", summary.String(), expected)
+	}
+	if result.outputRows != 7 || len(result.hashes) == 0 {
+		t.Errorf("result rows: %d, hashes: %d", result.outputRows, len(result.hashes))
+	}
+}
+
+// TestParseFile_outputTag verifies the values of Extracts with an OutputTag are written to the file
+// for the tag, and not with the other extracts.
+func TestParseFile_outputTag(t *testing.T) {
+	inputs := testSetup(t)
+	inputs.Extracts = []*parser.Extract{
+		{Columns: []int{4}, RegexString: `\w+`, Token: "{}", OutputTag: "levels"},
+		{Columns: []int{7}, RegexString: `\(([\w:\.]+)\)`, Token: "({})", Submatch: 1, OutputTag: "ids"},
+		{Columns: []int{7}, RegexString: `val[:=](\d+)`, Token: "val={}", Submatch: 1},
+	}
+	flags := flags{uniqueIdRegex: regexp.MustCompile(`serial number:(\w+)`)}
+	if _, err := parseFile(inputs, flags, testDataFilePath); err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+
+	tests := []struct {
+		fileName string
+		expected string
+	}{
+		{filepath.Base(testDataFilePath) + ".levels" + taggedExtractsFileSuffix,
+			"SOME_SERIAL|debug\n" + strings.Repeat("SOME_SERIAL|info\n", 6)},
+		{filepath.Base(testDataFilePath) + ".ids" + taggedExtractsFileSuffix,
+			"SOME_SERIAL|789\nSOME_SERIAL|ABC.123_45\nSOME_SERIAL|DEF.678_90\nSOME_SERIAL|GHI.098_76\n"},
+	}
+	for _, test := range tests {
+		b, err := os.ReadFile(filepath.Join(dataDirectory, test.fileName))
+		if err != nil {
+			t.Fatalf("calling os.ReadFile: %s", err)
+		}
+		if string(b) != test.expected {
+			t.Errorf("file: %s, got:\n%s\nexpected:\n%s", test.fileName, b, test.expected)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dataDirectory, filepath.Base(testDataFilePath)+parsedOutputFileSuffix))
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	var extracts []string
+	for _, row := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		_, rowExtracts, _ := strings.Cut(row, "|EXTRACTS|")
+		extracts = append(extracts, rowExtracts)
+	}
+	if expected := []string{"", "", "", "1", "2", "3", "4"}; !slices.Equal(extracts, expected) {
+		t.Errorf("extracts: %q, expected: %q", extracts, expected)
+	}
+}
+
+// TestParseFile_scanErrorRetries verifies a file that fails to read partway is processed again
+// from the start, discarding the partial output, including the rows for the recent rows output,
+// and that the error is returned without retries.
+func TestParseFile_scanErrorRetries(t *testing.T) {
+	testSetup(t)
+	inputs := &parser.Inputs{
+		ExpectedFieldCount: 2,
+		HashColumns:        []int{1},
+		InputDelimiter:     ",",
+		OutputDelimiter:    "|",
+	}
+	logLines := "a,1\nb,2\nc,3\n"
+	var requests, failures int
+	var requestsMutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsMutex.Lock()
+		requests++
+		fail := requests <= failures
+		requestsMutex.Unlock()
+		w.Header().Set("Content-Length", strconv.Itoa(len(logLines)))
+		if !fail {
+			w.Write([]byte(logLines))
+			return
+		}
+		// Send part of the body, then drop the connection, as a transient read error.
+		w.Write([]byte(logLines[:6]))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("calling Hijack: %s", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+	parsedOutputFilePath := filepath.Join(dataDirectory, "app.log"+parsedOutputFileSuffix)
+
+	requests, failures = 0, 2
+	inputs.ScanErrorRetries = 2
+	recent := newRecentRows(10)
+	result, err := parseFile(inputs, flags{recent: recent}, server.URL+"/app.log")
+	if err != nil {
+		t.Fatalf("calling parseFile: %s", err)
+	}
+	if requests != 3 || result.outputRows != 3 || len(result.hashes) != 3 {
+		t.Errorf("requests: %d, output rows: %d, hashes: %d", requests, result.outputRows, len(result.hashes))
+	}
+	parsed, err := os.ReadFile(parsedOutputFilePath)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	if want := "|a|'0xc4ca4238a0b923820dcc509a6f75849b'|EXTRACTS|\n|b|'0xc81e728d9d4c2f636f067f89cc14862c'|EXTRACTS|\n" +
+		"|c|'0xeccbc87e4b5ce2fe28308fd9f2a7baf3'|EXTRACTS|\n"; string(parsed) != want {
+		t.Errorf("parsed output, got: %q, want: %q", parsed, want)
+	}
+	if rows := recent.recent(10); len(rows) != 3 || rows[0] != "|a|'0xc4ca4238a0b923820dcc509a6f75849b'|EXTRACTS|" {
+		t.Errorf("recent rows of retried attempts not discarded: %q", rows)
+	}
+	if spooled, _ := filepath.Glob(filepath.Join(dataDirectory, "*"+lockedFileSuffix)); len(spooled) > 0 {
+		t.Errorf("spool files not removed: %q", spooled)
+	}
+
+	testSetup(t)
+	parsedOutputFilePath = filepath.Join(dataDirectory, "app.log"+parsedOutputFileSuffix)
+	requests, failures = 0, 1
+	inputs.ScanErrorRetries = 0
+	if _, err := parseFile(inputs, flags{}, server.URL+"/app.log"); !errors.Is(err, parser.ErrScan) {
+		t.Errorf("expected ErrScan, got: %v", err)
+	}
+	if _, err := os.Stat(parsedOutputFilePath); !os.IsNotExist(err) {
+		t.Errorf("partial output not left locked, error: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("requests: %d", requests)
+	}
+}
+
+// TestStableFiles_filter verifies a file whose size is still changing is deferred until its size
+// and modification time are unchanged for the interval, while a file that is not changing is not.
+func TestStableFiles_filter(t *testing.T) {
+	testSetup(t)
+	dir := t.TempDir()
+	growingPath := filepath.Join(dir, "growing.txt")
+	for _, name := range []string{"done.txt", "growing.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("line 1\n"), 0644); err != nil {
+			t.Fatalf("calling os.WriteFile: %s", err)
+		}
+	}
+	names := func(files []fs.DirEntry) []string {
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		return names
+	}
+	readDir := func() []fs.DirEntry {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("calling os.ReadDir: %s", err)
+		}
+		return files
+	}
+
+	interval := time.Minute
+	sf := newStableFiles(interval)
+	now := time.Now()
+	if stable := names(sf.filter(readDir(), now)); len(stable) != 0 {
+		t.Errorf("files stable when first seen: %v", stable)
+	}
+	growingFile, err := os.OpenFile(growingPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("calling os.OpenFile: %s", err)
+	}
+	if _, err := growingFile.WriteString("line 2\n"); err != nil {
+		t.Fatalf("calling WriteString: %s", err)
+	}
+	growingFile.Close()
+	if stable := names(sf.filter(readDir(), now.Add(interval))); !slices.Equal(stable, []string{"done.txt"}) {
+		t.Errorf("growing file not deferred, stable: %v", stable)
+	}
+	if stable := names(sf.filter(readDir(), now.Add(interval+time.Second))); !slices.Equal(stable, []string{"done.txt"}) {
+		t.Errorf("growing file stable before the interval, stable: %v", stable)
+	}
+	if stable := names(sf.filter(readDir(), now.Add(2*interval))); !slices.Equal(stable, []string{"done.txt", "growing.txt"}) {
+		t.Errorf("growing file not stable after the interval, stable: %v", stable)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "done.txt")); err != nil {
+		t.Fatalf("calling os.Remove: %s", err)
+	}
+	sf.filter(readDir(), now.Add(2*interval))
+	if _, ok := sf.seen["done.txt"]; ok || len(sf.seen) != 1 {
+		t.Errorf("removed file not forgotten: %v", sf.seen)
+	}
+}
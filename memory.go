@@ -0,0 +1,124 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/paulfdunn/go-helper/logh"
+	"github.com/paulfdunn/go-parser/parser"
+)
+
+const (
+	// Memory is checked every memoryCheckRows rows, as runtime.ReadMemStats stops the world.
+	memoryCheckRows = 1000
+	// Degradation starts when memory in use reaches this percent of maxmemory.
+	memoryHighWaterPercent = 90
+	// When memory remains high after other degradation actions, reading is paused for up
+	// to memoryPauses intervals of memoryPause.
+	memoryPause  = 100 * time.Millisecond
+	memoryPauses = 10
+
+	// Hashes spilled from memory are written to the hashes output file path with this suffix,
+	// and merged back when the hashes are saved.
+	hashesSpillFileSuffix = ".spill"
+)
+
+var (
+	// memoryInUse returns the bytes of memory in use; replaced in tests.
+	memoryInUse = func() uint64 {
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		return memStats.HeapInuse
+	}
+)
+
+// memoryHigh is true when the memory in use is at least memoryHighWaterPercent of maxMemory MB.
+func memoryHigh(maxMemory int) bool {
+	return memoryInUse() >= uint64(maxMemory)*1e6*memoryHighWaterPercent/100
+}
+
+// degradeMemory is called when memory is high to reduce memory use. In order, hashes are
+// spilled to a file and cleared from memory, output buffers are flushed, memory is returned
+// to the OS, and finally reading is paused until memory is no longer high.
+// The number of hashes spilled is returned.
+func degradeMemory(scnr *parser.Scanner, flags flags, hashesOutputFilePath string, flush func() error) int {
+	spilled := 0
+	if scnr.HashingEnabled() && !flags.dryRun && len(scnr.HashCounts) > 0 {
+		spilled = spillHashes(scnr, hashesOutputFilePath+hashesSpillFileSuffix)
+	}
+	if err := flush(); err != nil {
+		lpf(logh.Error, "calling Flush: %s", err)
+	}
+	debug.FreeOSMemory()
+
+	for i := 0; i < memoryPauses && memoryHigh(flags.maxMemory); i++ {
+		lpf(logh.Warning, "memory high, pausing reading for %s", memoryPause)
+		time.Sleep(memoryPause)
+		debug.FreeOSMemory()
+	}
+	return spilled
+}
+
+// spillHashes appends the scanner hashes to the spill file and clears them from memory.
+// Hashes that are spilled more than once have their counts combined by mergeSpilledHashes.
+// As HashMap is cleared, the HashCollisionPolicy only applies to hashes in memory since the
+// last spill; spilled values are not checked for collisions.
+// The number of hashes spilled is returned; zero if there was an error.
+func spillHashes(scnr *parser.Scanner, spillFilePath string) int {
+	spillFile, err := os.OpenFile(spillFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		lpf(logh.Error, "calling os.OpenFile: %s", err)
+		return 0
+	}
+	defer spillFile.Close()
+	if err := parser.WriteHashes(spillFile, hashesOutputDelimiter, "\n", scnr.HashCounts, scnr.HashMap); err != nil {
+		lpf(logh.Error, "calling WriteHashes: %s", err)
+		return 0
+	}
+
+	spilled := len(scnr.HashCounts)
+	lpf(logh.Warning, "memory high, spilled %d hashes to: %s", spilled, spillFilePath)
+	clear(scnr.HashCounts)
+	clear(scnr.HashMap)
+	return spilled
+}
+
+// mergeSpilledHashes merges any hashes spilled by spillHashes back into the scanner hashes,
+// and removes the spill file. For a hash that is both spilled and in memory, the value in
+// memory is kept, as it is the most recent.
+// On error the scanner hashes are unchanged, the spill file is kept, and the error is returned.
+func mergeSpilledHashes(scnr *parser.Scanner, spillFilePath string) error {
+	spillFile, err := os.Open(spillFilePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		lpf(logh.Error, "calling os.Open: %s", err)
+		return err
+	}
+	hashCounts := make(map[string]int)
+	hashMap := make(map[string]string)
+	err = parser.ReadHashes(spillFile, hashesOutputDelimiter, hashCounts, hashMap)
+	spillFile.Close()
+	if err != nil {
+		lpf(logh.Error, "calling ReadHashes, spill file kept: %s", err)
+		return err
+	}
+
+	for hash, count := range scnr.HashCounts {
+		hashCounts[hash] += count
+		hashMap[hash] = scnr.HashMap[hash]
+	}
+	scnr.HashCounts = hashCounts
+	scnr.HashMap = hashMap
+	if err := os.Remove(spillFilePath); err != nil {
+		lpf(logh.Error, "calling os.Remove: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mergeRow is a row read from one of the files being merged.
+type mergeRow struct {
+	file    int
+	key     string
+	row     string
+	scanner *bufio.Scanner
+}
+
+// mergeHeap is a min heap of the next row from each file being merged, ordered by key, then
+// file, so rows with equal keys are output in file order.
+type mergeHeap []*mergeRow
+
+func (mh mergeHeap) Len() int { return len(mh) }
+func (mh mergeHeap) Less(i, j int) bool {
+	if c := compareMergeKeys(mh[i].key, mh[j].key); c != 0 {
+		return c < 0
+	}
+	return mh[i].file < mh[j].file
+}
+func (mh mergeHeap) Swap(i, j int) { mh[i], mh[j] = mh[j], mh[i] }
+func (mh *mergeHeap) Push(x any)   { *mh = append(*mh, x.(*mergeRow)) }
+func (mh *mergeHeap) Pop() any {
+	old := *mh
+	mr := old[len(old)-1]
+	*mh = old[:len(old)-1]
+	return mr
+}
+
+// compareMergeKeys compares keys numerically when both are numbers (I.E. Unix epoch values),
+// otherwise as strings.
+func compareMergeKeys(a, b string) int {
+	af, aErr := strconv.ParseFloat(a, 64)
+	bf, bErr := strconv.ParseFloat(b, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// mergeSorted performs a k-way merge of the rows in the files at filePaths, which must each be
+// ordered by the key in column (zero index, after splitting on delimiter), writing a single
+// ordered output to w, with each row ending with newline. Only one row per file is held in
+// memory. Rows without the column have an empty key.
+func mergeSorted(filePaths []string, delimiter string, column int, newline string, w io.Writer) error {
+	mergeKey := func(row string) string {
+		fields := strings.Split(row, delimiter)
+		if column < len(fields) {
+			return fields[column]
+		}
+		return ""
+	}
+
+	mh := make(mergeHeap, 0, len(filePaths))
+	for i, filePath := range filePaths {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, maxOutputRowSize)
+		if scanner.Scan() {
+			mh = append(mh, &mergeRow{file: i, key: mergeKey(scanner.Text()), row: scanner.Text(), scanner: scanner})
+		} else if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	heap.Init(&mh)
+
+	writer := bufio.NewWriter(w)
+	for mh.Len() > 0 {
+		mr := mh[0]
+		if _, err := writer.WriteString(mr.row + newline); err != nil {
+			return err
+		}
+		if mr.scanner.Scan() {
+			mr.row = mr.scanner.Text()
+			mr.key = mergeKey(mr.row)
+			heap.Fix(&mh, 0)
+			continue
+		}
+		if err := mr.scanner.Err(); err != nil {
+			return err
+		}
+		heap.Pop(&mh)
+	}
+	return writer.Flush()
+}
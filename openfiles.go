@@ -0,0 +1,64 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"sync"
+)
+
+// openFiles limits the number of files open concurrently across all parseFileEngine workers,
+// so the process does not hit the OS file descriptor limit. Before processing a data file a
+// worker acquires the number of files it will have open, blocking until enough are released.
+// Acquiring all files at once, rather than one at a time, prevents workers from deadlocking
+// while each holds some of the files.
+type openFiles struct {
+	cond  *sync.Cond
+	limit int
+	open  int
+	peak  int
+}
+
+func newOpenFiles(limit int) *openFiles {
+	return &openFiles{cond: sync.NewCond(&sync.Mutex{}), limit: limit}
+}
+
+// acquire blocks until n files can be opened and returns the number acquired, which must be
+// passed to release. n is capped at the limit so a worker can always make progress.
+func (of *openFiles) acquire(n int) int {
+	n = min(n, of.limit)
+	of.cond.L.Lock()
+	defer of.cond.L.Unlock()
+	for of.open+n > of.limit {
+		of.cond.Wait()
+	}
+	of.open += n
+	of.peak = max(of.peak, of.open)
+	return n
+}
+
+// release releases n files acquired with acquire.
+func (of *openFiles) release(n int) {
+	of.cond.L.Lock()
+	of.open -= n
+	of.cond.L.Unlock()
+	of.cond.Broadcast()
+}
+
+// filesPerDataFile returns the maximum number of files open at once while processing a data
+// file: the data file, the parsed output file, the SQL output file in tee mode, the errors file,
+// and the unique ID output files. Hashes and message types files are written after the data file is closed.
+func filesPerDataFile(flags flags) int {
+	n := 2
+	if flags.tee {
+		n++
+	}
+	if flags.errorsFile {
+		n++
+	}
+	if flags.splitUniqueId {
+		n += max(flags.splitUniqueIdOpen, 1)
+	}
+	return n
+}
@@ -10,89 +10,561 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"compress/zlib"
+	"container/list"
 	"crypto/md5"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
+// ColumnAllowlist objects are used to validate data (see Scanner.ValidateColumns). The value of
+// Column (zero index, after Split) must be one of Values.
+type ColumnAllowlist struct {
+	Column int
+	Values []string
+}
+
+// CsvFormatter is a RowFormatter that outputs the unique ID, splits, and extracts as a CSV record.
+type CsvFormatter struct{}
+
+// DelimitedFormatter is the default RowFormatter. It outputs the unique ID and splits separated
+// by Delimiter, followed by "|EXTRACTS|" and the extracts separated by Delimiter.
+type DelimitedFormatter struct {
+	Delimiter string
+}
+
 // Extract objects determine how extractions (Scanner.Extract) occur.
+// Extracts are evaluated, and their values returned, in Priority order, highest first. Extracts with
+// equal Priority (I.E. the default, 0) are evaluated in Inputs.Extracts order. Since each Extract
+// replaces its matches with the Token, an Extract can prevent a lower priority Extract from matching;
+// set Priority so the order does not depend on the order of the Extracts in the inputs file.
 // The RegexString is converted to a regex and is run against the specified data columns (after Split).
 // Submatches is used to index submatches returned from regex.FindAllStringSubmatch(regex,-1) which are
 // returned. The submatches are replaced with Token in the source data.
 // Note on submatch indexing: The first item is the full match, so submatch indeces start at 1
-// not zero (https://pkg.go.dev/regexp#Regexp.FindAllStringSubmatch)
+// not zero (https://pkg.go.dev/regexp#Regexp.FindAllStringSubmatch). Submatch 0 (the default)
+// returns the full match, so regexes without groups need no Submatch; the full match is replaced
+// with the Token.
+// Name is optional; when Inputs.PrefixExtractsWithName is true, extracted values are prefixed
+// with the Name (I.E. "version=1.2.34").
+// When CanonicalizeNumbers is true, extracted values that are numbers are canonicalized; see CanonicalizeNumber.
+// Normalizer is optional and converts extracted values to a common unit; see NORM_DURATION_NS,
+// NORM_TIMESTAMP, and NORM_CIDR. TimestampLayout and TimestampFormat are used with NORM_TIMESTAMP.
+// Mask is optional and partially redacts extracted values (I.E. card or phone numbers); see
+// MASK_KEEP_LAST and MaskKeepLast. The value is masked after it is normalized.
+// Type is optional and coerces extracted values to a type; see EXTRACT_TYPE_NUMBER and EXTRACT_TYPE_BOOL.
+// Typed values are output as JSON numbers or bools by an NdjsonFormatter with a Scanner.
+// JsonType is optional, and like Type, but only changes how values are output by an NdjsonFormatter
+// with a Scanner: values are not coerced, and values that are not a JSON number (EXTRACT_TYPE_NUMBER)
+// or true/false (EXTRACT_TYPE_BOOL) are output as strings, without an error. JsonType takes the
+// same values as Type; EXTRACT_TYPE_STRING, the default, outputs strings. JsonType cannot be used
+// with Type.
+// When EmitTemplate is true, each of the Columns, after all Extracts have replaced matches with
+// tokens, is also returned as an extract value; this is the template for the column. Templates
+// follow all other extracted values, and are not prefixed with the Name.
+// Default is used with Inputs.ExtractFixedColumns; it is output when the Extract does not match.
+// When Json is true, RegexString is not used; the Extract matches JSON objects embedded in the
+// Columns (I.E. `2023-10-07 ERROR {"code":500,"msg":"x"}`) by balancing braces, which a regex cannot do.
+// The JSON object is returned, unless JsonKeys is set, in which case the value of each of the
+// JsonKeys (top level keys) is returned instead; strings are unquoted, other values are JSON.
+// Keys missing from the object return the Default. JsonKeys values are prefixed with the Name and
+// key (I.E. "error.code=500").
+// When Explode is true, a row where the Extract returns N values is output as N rows, each with
+// one of the values and all other columns and extracts duplicated; see Scanner.Explode. Only one
+// Extract can Explode.
+// When Between is set, RegexString is not used; the Extract returns the text between each start
+// marker (Between[0]) and the next end marker (Between[1]) in the Columns (I.E. "[" and "]", or
+// "BEGIN" and "END"). The markers and text are replaced with the Token. Markers are not nested.
+// When FullRow is true, Columns is not used; the regex is run against the row with the columns
+// joined by FULL_ROW_SEPARATOR, so values split across columns by the delimiter can be matched
+// (I.E. "msg=(disk full)" where the input delimiter is whitespace). The Token replaces the match
+// in the column where the match starts; the rest of the match is removed from the following
+// columns, so the number of columns is unchanged. Extracted values are from the column where
+// the submatch starts.
+// When Delta is true, each extracted value, which must be a number, is replaced by the difference
+// from the previous value extracted by the Extract for the same delta key (see SetDeltaKey), I.E.
+// the per row delta of a cumulative counter. The first value for a key has no previous value; the
+// Default is returned. A negative delta indicates the counter was reset. Delta cannot be used with
+// Inputs.ExtractCacheSize, as the result depends on previous rows.
+// When OutputTag is set, the values of the Extract (including the Default and templates) are
+// not returned with the other extracts; they are grouped with the values of other Extracts with
+// the same OutputTag, for output to a separate destination; see Scanner.TaggedExtracts. OutputTag
+// is used in file names, so is limited to letters, numbers, "_", and "-". Explode cannot be used
+// with OutputTag.
 type Extract struct {
-	Columns     []int
-	RegexString string
-	Submatch    int
-	Token       string
-	regex       *regexp.Regexp
+	Between             [2]string
+	CanonicalizeNumbers bool
+	Columns             []int
+	Default             string
+	Delta               bool
+	EmitTemplate        bool
+	Explode             bool
+	FullRow             bool
+	Json                bool
+	JsonKeys            []string
+	JsonType            string
+	Mask                string
+	MaskKeepLast        int
+	Name                string
+	Normalizer          string
+	OutputTag           string
+	Priority            int
+	RegexString         string
+	Submatch            int
+	TimestampFormat     string
+	TimestampLayout     string
+	Token               string
+	Type                string
+	regex               *regexp.Regexp
+	tokenLiteral        string
+}
+
+// ExtractCoverage is the number of rows where an Extract was attempted on a column (the row had
+// the column), and the number of those rows where the Extract matched; see Scanner.ExtractCoverage.
+// Extract is the Extract Name, or "extract" and the index of the Extract when there is no Name.
+// Column is -1 for a FullRow Extract.
+type ExtractCoverage struct {
+	Attempts int
+	Column   int
+	Extract  string
+	Matches  int
+}
+
+// ExtractOverlap is the number of rows where an Extract matched text containing the Token inserted
+// by an earlier Extract (TokenOf) in a column; see Scanner.ExtractOverlaps. Since Extracts replace
+// their matches in place, in order, this is almost always a configuration error: the earlier
+// Extract clobbered the value, or the later Extract extracts the Token. Only the Token text, not
+// submatch references (I.E. "${1}"), is matched. Extract and TokenOf are named as for ExtractCoverage.
+type ExtractOverlap struct {
+	Column  int
+	Extract string
+	Rows    int
+	TokenOf string
+}
+
+// ExtractResult is a value returned by Extract paired with the column it was extracted from; see
+// Scanner.ExtractResults. Column is -1 for an Extract Default, which has no source column.
+type ExtractResult struct {
+	Column int
+	Value  string
+}
+
+// deltaPreviousKey identifies the previous value of an Extract with Delta, for a delta key.
+type deltaPreviousKey struct {
+	extract *Extract
+	key     string
+}
+
+// extractTokens are the indices of the Extracts that inserted their Token into each column of a
+// row, by column; used to detect ExtractOverlaps.
+type extractTokens map[int][]int
+
+// extractCache is a bounded, least recently used, cache of Extract results. Extract results depend
+// only on the values of the Extract columns, so the key is those values; see key.
+type extractCache struct {
+	// allColumns is true when an Extract uses the full row; columns is not used.
+	allColumns bool
+	// columns are the columns used by any Extract, sorted.
+	columns []int
+	entries map[string]*list.Element
+	// order has the most recently used entry at the front.
+	order *list.List
+	size  int
+}
+
+// extractCacheEntry is the result of Extract for a key. columns are the values of the
+// extractCache columns after the matches were replaced with Tokens. coverage has an
+// extractCoverage index, Columns index, and 1 if matched (0 otherwise), for each
+// ExtractCoverage that was attempted. overlaps are the ExtractOverlaps keys for the row.
+type extractCacheEntry struct {
+	columns        []string
+	coverage       [][3]int
+	errors         []error
+	explodeIndices []int
+	extractColumns []int
+	extractTypes   []string
+	extracts       []string
+	key            string
+	matched        bool
+	overlaps       [][3]int
+	taggedExtracts map[string][]string
+}
+
+// FileFormat objects allow a single DataDirectory to contain files of different formats. When a
+// data file name matches Pattern (see filepath.Match), InputDelimiter and ExpectedFieldCount
+// replace the Inputs values for that file; see Inputs.ForFile.
+type FileFormat struct {
+	ExpectedFieldCount int
+	InputDelimiter     string
+	Pattern            string
+}
+
+// Format objects are used by the format router to split inputs that contain rows of more than one
+// format. Split uses the first Format whose MatchRegex matches the row, splitting the row with the
+// Format InputDelimiter and checking the Format ExpectedFieldCount. Rows matching no Format are
+// handled according to Inputs.RouterPolicy, unless Inputs.RouterDefaultFormat names a fallback Format.
+type Format struct {
+	ExpectedFieldCount int
+	InputDelimiter     string
+	MatchRegex         string
+	Name               string
+	inputDelimiter     *regexp.Regexp
+	matchRegex         *regexp.Regexp
 }
 
 // Inputs to parser. This object is just used for unmarshalling inputs from a file.
 // The values are then stored with the scanner; see Scanner for details.
 type Inputs struct {
-	DataDirectory           string
-	ExpectedFieldCount      int
-	Extracts                []*Extract
-	HashColumns             []int
-	InputDelimiter          string
-	NegativeFilter          string
-	OutputDelimiter         string
-	PositiveFilter          string
-	ProcessedInputDirectory string
-	Replacements            []*Replacement
-	SqlQuoteColumns         []int
+	CanonicalizeHashNumbers   bool
+	ColumnAllowlists          []*ColumnAllowlist
+	CompressionLevel          int
+	DataDirectory             string
+	DedupExtractsPerRow       bool
+	ExpectedFieldCount        int
+	ExtractCacheSize          int
+	ExtractFixedColumns       bool
+	Extracts                  []*Extract
+	FieldCountPolicy          FieldCountPolicy
+	FileFormats               []*FileFormat
+	FilterCaseInsensitive     bool
+	Formats                   []*Format
+	HashCollisionPolicy       HashCollisionPolicy
+	HashColumns               []int
+	HashColumnsIndividually   bool
+	HashEntireRow             bool
+	IngestTimestampFormat     string
+	InputCharset              string
+	InputDelimiter            string
+	InputDelimiterCandidates  []string
+	InputDelimiterLiteral     bool
+	LongFieldPolicy           LongFieldPolicy
+	MaxErrors                 int
+	MaxFieldLength            int
+	MaxRowsPerSecond          int
+	MessageTypeIdPrefix       string
+	NegativeFilter            string
+	OutputColumnNames         []string
+	OutputDelimiter           string
+	OutputNewline             string
+	PadTrailingEmptyFields    bool
+	PositiveFilter            string
+	PreProcessors             []string
+	PrefixExtractsWithName    bool
+	ProcessedInputDirectory   string
+	RecordSeparator           string
+	ReorderColumn             int
+	ReorderTimeLayout         string
+	ReorderWindow             int
+	Replacements              []*Replacement
+	RequireExtract            bool
+	RouterDefaultFormat       string
+	RouterPolicy              RouterPolicy
+	RowId                     bool
+	ScanErrorRetries          int
+	SqlProvenance             bool
+	SqlQuoteColumns           []int
+	TrimEmptyEdgeFields       bool
+	TrimQuotes                bool
+	UniqueIdFunc              string
+	WarnUnterminatedFinalLine bool
+}
+
+// NdjsonFormatter is a RowFormatter that outputs each row as a JSON object, for newline
+// delimited JSON output. UniqueId and Hash are omitted when empty. When Scanner is not nil,
+// extracts are output as JSON numbers and bools according to the Extract Type; see
+// Scanner.ExtractTypes. Scanner must be the Scanner that extracted the row.
+// When ColumnNames is not empty (see Scanner.OutputColumnNames), the splits are output as a
+// Columns object, keyed by the ColumnNames in order, instead of a Splits array; splits without a
+// name are keyed by "column" and the index.
+type NdjsonFormatter struct {
+	ColumnNames []string
+	Scanner     *Scanner
+}
+
+// ParseError is used for errors related to the content of a row, as opposed to errors
+// reading data or in the Inputs. Column is -1 for errors about the whole row.
+type ParseError struct {
+	Column  int
+	Message string
+	Value   string
+}
+
+// RateLimiter is a token bucket limiter that paces callers of Wait to a maximum rate, across
+// goroutines. The bucket holds up to RATE_LIMITER_BURST_SECONDS of tokens, so short bursts are
+// not paced one at a time, but the average rate does not exceed the limit; see NewRateLimiter.
+type RateLimiter struct {
+	burst  float64
+	last   time.Time
+	mutex  sync.Mutex
+	rate   float64
+	tokens float64
+}
+
+// reorderWindow holds the rows read ahead by Read, ordered by time then line. last is the time
+// of the last row pushed, which is used for rows without a time.
+type reorderWindow struct {
+	last time.Time
+	line int
+	rows []reorderWindowRow
+}
+
+// reorderWindowRow is a row in a reorderWindow.
+type reorderWindowRow struct {
+	line int
+	row  string
+	time time.Time
 }
 
 // Replacement objects determine how replacements (Scanner.Replacement) occur.
 // The RegexString is converted to a regex and is run against input row (unsplit),
-// with matches being replaced by RegexString.
+// with matches being replaced by RegexString. When GuardRegex is not empty the replacement
+// is only applied to rows matching GuardRegex (I.E. only rows that start with a timestamp), so
+// non-data rows are not mangled.
 type Replacement struct {
+	GuardRegex  string
 	Replacement string
 	RegexString string
+	guardRegex  *regexp.Regexp
 	regex       *regexp.Regexp
 }
 
+// RowFormatter objects format a parsed row for output. splits are the output splits, which
+// include the hash when hashing is enabled (see SplitsExcludeHashColumns), and hash is the
+// row hash or an empty string when hashing is not enabled. The returned string does not
+// include a newline.
+type RowFormatter interface {
+	Format(uniqueId string, splits, extracts []string, hash string) string
+}
+
+// SqlFormatter is a RowFormatter that outputs an SQL INSERT statement; see Scanner.SplitsToSql.
+// The unique ID, when not empty, is the first column.
+type SqlFormatter struct {
+	Columns int
+	Scanner *Scanner
+	Table   string
+}
+
+// Schema describes the output of a Scanner, so output can be self describing. Columns describes
+// the splits after SplitsExcludeHashColumns and AppendIngestTimestamp, in order. Extracts describes
+// the Extracts, in order; each Extract outputs zero or more values per row, or exactly one value
+// when ExtractFixedColumns is true.
+type Schema struct {
+	Columns             []SchemaColumn
+	ExtractFixedColumns bool
+	Extracts            []SchemaColumn
+}
+
+// SchemaColumn describes an output column. SplitColumns are the columns (zero index, after Split)
+// from which the column is output; multiple columns for the hash, and none for columns that are added.
+// Hashed is true for the hash column. Type is "string", "hash", or an Extract Type.
+type SchemaColumn struct {
+	Hashed       bool
+	Name         string
+	SplitColumns []int
+	Type         string
+}
+
 // Scanner is the main object of this package.
+// aborted - Set by AddErrors when maxErrors is exceeded; Read stops reading and does not move the file.
+// canonicalizeHashNumbers - When true, hash column values that are numbers are canonicalized before
+// hashing, so values like "003" and "3" result in the same hash; see CanonicalizeNumber.
+// charset - The charset of the input being read, when inputCharset is not empty; see Charset.
+// checksum - Optional hash the input bytes are written to as they are read; see SetChecksum.
+// closer - Closed by Shutdown; the HTTP response body for OpenUrlScanner.
+// compressionLevel - The gzip compression level of output files, 1 to 9; 0 for no compression.
+// columnAllowlists - ColumnAllowlist objects; used by ValidateColumns.
 // dataDirectory - Directory with input files.
+// dedupExtractsPerRow - When true, Extract removes duplicate values from the extracts for a row,
+// keeping the first; I.E. a value matched by two Extracts is output once.
+// deltaKey - The key for Extract Delta previous values; see SetDeltaKey.
+// deltaPrevious - The previous value of each Extract with Delta, for each deltaKey.
+// errorCount - Number of errors added with AddErrors.
 // expectedFieldCount - Expected number of fields after calling Split.
-// extract - Extract objects; used for extracting values from rows into their own fields.
-// hashColumns - Column indeces (zero index) of Split data used to create the hash.
-// inputDelimiter - Regexp used by Split to split rows of data.
+// explodeIndices - Indeces of the values returned by the last call to Extract from the Extract
+// with Explode set; used by Explode.
+// extract - Extract objects, in Priority order; used for extracting values from rows into their own fields.
+// extractCache - When Inputs.ExtractCacheSize > 0, a bounded LRU cache of Extract results keyed by
+// the values of the Extract columns, so repeated values are not extracted again; nil otherwise.
+// extractColumns - The source column of each value returned by the last call to Extract; used by ExtractResults.
+// extractCoverage - ExtractCoverage for each Extract, for each of the Extract Columns.
+// extractFixedColumns - When true, each Extract outputs exactly one value per row, so extracts are in
+// fixed columns: the first match, or the Extract Default when there is no match. Additional matches
+// are replaced with the Token but not output.
+// extractMatched - True when an Extract matched in the last call to Extract; used by FilterExtracts.
+// extractOverlapKeys - The extract index, TokenOf extract index, and column of each of extractOverlaps.
+// extractOverlaps - ExtractOverlaps for all rows processed by Extract.
+// extractRowOverlaps - The extractOverlapKeys found by the last call to Extract; cached with the result.
+// fieldCountPolicy - Determines how Split handles rows with an unexpected number of fields.
+// formats - Format objects; when present Split routes each row to the first matching Format.
+// hashCollisionPolicy - Determines what is stored in HashMap when different values result in the same hash.
+// hashColumns - Column indeces (zero index) of Split data used to create the hash. When
+// Inputs.HashEntireRow is true, all the columns, so each row is output as just its hash.
+// hashColumnsIndividually - When true, each of the hashColumns is hashed independently and replaced
+// by its own hash, instead of all hashColumns being replaced by one combined hash. The hashes
+// of all columns are in HashCounts and HashMap, so any hash can be decoded, and the hashes of each
+// column are also counted separately in ColumnHashCounts and ColumnHashMap, keyed by column,
+// for per column cardinality analysis. Not used with message type IDs.
+// ingestTimestampFormat - When not empty, a time.Format layout used by AppendIngestTimestamp to
+// add the time each row was parsed as a column.
+// inputCharset - The charset of the input (I.E. CHARSET_LATIN1), or CHARSET_AUTO to detect the
+// charset of each input; empty to read the input unchanged.
+// inputDelimiter - Regexp used by Split to split rows of data. When Inputs.InputDelimiterLiteral
+// is true, Inputs.InputDelimiter is a literal string (I.E. a tab or "||") rather than a regex, so
+// text inside fields that would match a regex delimiter, like consecutive spaces, is preserved.
+// inputDelimiterCandidates - When not empty, Split detects the delimiter for each row from these
+// literal strings, instead of using inputDelimiter. This supports inputs where the delimiter varies
+// per row, like concatenated comma and tab delimited files. The first candidate that splits the row
+// into expectedFieldCount fields is used; otherwise the candidate occurring most in the row is used.
+// longFieldPolicy - Determines how LimitFieldLengths handles fields longer than maxFieldLength.
+// maxErrors - When > 0, the maximum number of errors added with AddErrors before processing is aborted.
+// maxFieldLength - When > 0, the maximum length in bytes of a field; see LimitFieldLengths.
+// messageTypeIdPrefix - When not empty, each unique hash is assigned a sequential message type ID,
+// in order of first appearance, with this prefix (I.E. "MSG-" results in "MSG-0001"). The ID is
+// output as a column after the hash.
 // negativeFilter - Regex used for negative filtering. Rows matching this value are excluded.
+// When Inputs.FilterCaseInsensitive is true, the negativeFilter and positiveFilter are case-insensitive.
 // outDelimiter - String used to delimit parsed output data.
+// outputColumnNames - Names replacing the Schema Column names, in order; see OutputColumnNames.
+// outputNewline - Newline used when writing parsed output: "lf" (default) or "crlf"; see Newline.
+// outputTags - The Extract OutputTags, sorted, without duplicates; see OutputTags.
+// padTrailingEmptyFields - When true, Split pads rows with fewer fields than expected with empty
+// fields, without an error; I.E. CSV-like data where optional trailing columns are omitted.
 // positiveFilter - Regex used for positive filtering. Rows must match to be included.
+// preProcessors - Transformations (I.E. PRE_URLDECODE) applied, in order, by PreProcess to the whole
+// row before any other processing.
+// progress - Optional callback called by Read after each row with the total bytes scanned; see SetProgress.
+// prefixExtractsWithName - When true, extracted values are prefixed with the Extract Name and "=".
 // processedInputDirectory - When Read completes, move the file to this directory; empty string means the file is left in place.
+// recordSeparator - The line terminator of the input (I.E. RECORD_SEPARATOR_CR), or
+// RECORD_SEPARATOR_AUTO to detect it for each input; see OpenIoReaderScanner.
+// reorderColumn - The column, after splitting with inputDelimiter, with the timestamp Read orders
+// rows by, when reorderWindow > 0.
+// reorderTimeLayout - The time.Parse layout of the reorderColumn timestamps.
+// reorderWindow - When > 0, the number of rows Read holds to reorder rows by timestamp; see Read.
 // replace - Replacement values used for performing regex replacements on input data.
+// requireExtract - When true, FilterExtracts drops rows where no Extract matched.
+// routerDefaultFormat - Format used by Split for rows matching no Format; nil to apply routerPolicy.
+// routerPolicy - Determines how Split handles rows matching no Format.
+// rowId - When true, PrependRowId adds a hash of the raw input row as the first column; see PrependRowId.
+// runId - Identifies the run (invocation) that produced the output; see SetRunId.
+// sqlProvenance - When true, SQL output includes provenance columns: source file name, ingest
+// time (when the scanner was opened), and a hash of the inputs.
 // sqlQuoteColumns - When using SQL ouput, these columns will be quoted.
+// taggedExtracts - The values, by OutputTag, of the Extracts with an OutputTag, from the last call
+// to Extract; see TaggedExtracts.
+// trimEmptyEdgeFields - When true, Split drops the empty first/last field that results from a
+// delimiter at the start/end of a row.
+// trimQuotes - When true, Split strips matching leading/trailing quotes (" or ') from each field.
+// uniqueIdFunc - The function registered with RegisterUniqueIdFunc for Inputs.UniqueIdFunc; used by UniqueId.
+// unterminatedFinalLine - Set by the scanner when the final line of the input has no trailing newline.
+// warnUnterminatedFinalLine - When true, Read sends ErrUnterminatedFinalLine when the final line of
+// the input has no trailing newline, which can indicate a truncated file, or a file still being written.
 type Scanner struct {
-	HashColumns     []int
-	HashCounts      map[string]int
-	HashMap         map[string]string
-	OutputDelimiter string
-
-	dataChan                chan string
-	dataDirectory           string
-	errorChan               chan error
-	expectedFieldCount      int
-	extract                 []*Extract
-	file                    *os.File
-	inputDelimiter          *regexp.Regexp
-	negativeFilter          *regexp.Regexp
-	positiveFilter          *regexp.Regexp
-	processedInputDirectory string
-	replace                 []*Replacement
-	scanner                 *bufio.Scanner
-	sqlQuoteColumns         []int
+	ColumnHashCounts map[int]map[string]int
+	ColumnHashMap    map[int]map[string]string
+	HashColumns      []int
+	HashCounts       map[string]int
+	HashMap          map[string]string
+	MessageTypeIds   map[string]string
+	OutputDelimiter  string
+
+	aborted                   atomic.Bool
+	bytesScanned              int64
+	canonicalizeHashNumbers   bool
+	charset                   string
+	checksum                  hash.Hash
+	closer                    io.Closer
+	compressionLevel          int
+	columnAllowlists          []*ColumnAllowlist
+	dataChan                  chan string
+	dataDirectory             string
+	dedupExtractsPerRow       bool
+	deltaKey                  string
+	deltaPrevious             map[deltaPreviousKey]string
+	errorChan                 chan error
+	errorCount                int
+	expectedFieldCount        int
+	explodeIndices            []int
+	extract                   []*Extract
+	extractCache              *extractCache
+	extractColumns            []int
+	extractCoverage           [][]ExtractCoverage
+	extractFixedColumns       bool
+	extractMatched            bool
+	extractOverlapKeys        [][3]int
+	extractOverlaps           []ExtractOverlap
+	extractRowOverlaps        [][3]int
+	extractTypes              []string
+	fieldCountPolicy          FieldCountPolicy
+	file                      *os.File
+	formats                   []*Format
+	hashCollisionPolicy       HashCollisionPolicy
+	hashColumnsIndividually   bool
+	ingestTime                time.Time
+	ingestTimestampFormat     string
+	inputCharset              string
+	inputDelimiter            *regexp.Regexp
+	inputDelimiterCandidates  []string
+	inputsHash                string
+	longFieldPolicy           LongFieldPolicy
+	maxErrors                 int
+	maxFieldLength            int
+	messageTypeHashes         []string
+	messageTypeIdPrefix       string
+	negativeFilter            *regexp.Regexp
+	newline                   string
+	outputColumnNames         []string
+	outputTags                []string
+	padTrailingEmptyFields    bool
+	positiveFilter            *regexp.Regexp
+	preProcessors             []string
+	prefixExtractsWithName    bool
+	processedInputDirectory   string
+	progress                  func(int64)
+	recordSeparator           string
+	reorderColumn             int
+	reorderTimeLayout         string
+	reorderWindow             int
+	replace                   []*Replacement
+	requireExtract            bool
+	routerDefaultFormat       *Format
+	routerPolicy              RouterPolicy
+	rowId                     bool
+	runId                     string
+	scanner                   *bufio.Scanner
+	sourceFile                string
+	sqlProvenance             bool
+	sqlQuoteColumns           []int
+	taggedExtracts            map[string][]string
+	trimEmptyEdgeFields       bool
+	trimQuotes                bool
+	uniqueIdFunc              func(row string) string
+	unterminatedFinalLine     bool
+	warnUnterminatedFinalLine bool
 }
 
 // The hash can be output in a pure string format (I.E. "0xdeadbeef") or a format compatible
@@ -104,43 +576,824 @@ const (
 	HASH_FORMAT_SQL
 )
 
+// HashAlgorithm selects the hash function: HASH_ALGORITHM_MD5 uses Hash, and HASH_ALGORITHM_DJB2 uses Hash8.
+type HashAlgorithm int
+
+const (
+	HASH_ALGORITHM_MD5 HashAlgorithm = iota
+	HASH_ALGORITHM_DJB2
+)
+
+// FieldCountPolicy determines how Split handles rows that do not have the expected number of fields.
+// FIELD_COUNT_ERROR returns the splits and an error; the go-parser application skips the row.
+// FIELD_COUNT_PAD pads short rows with empty fields, and truncates long rows, to the expected number
+// of fields, and returns an error wrapping ErrFieldCountPadded; callers should report the error
+// and process the row. This keeps columns aligned, I.E. with the table columns for SQL output.
+type FieldCountPolicy int
+
+const (
+	FIELD_COUNT_ERROR FieldCountPolicy = iota
+	FIELD_COUNT_PAD
+)
+
+// HashCollisionPolicy determines how SplitsExcludeHashColumns handles a hash that is already in
+// HashMap with a different value; this is more likely with shorter hashes.
+// HASH_COLLISION_LAST_WINS stores the latest value.
+// HASH_COLLISION_FIRST_WINS keeps the value that was stored first.
+// HASH_COLLISION_ERROR returns an error wrapping ErrHashCollision, and the hash is not counted.
+type HashCollisionPolicy int
+
+const (
+	HASH_COLLISION_LAST_WINS HashCollisionPolicy = iota
+	HASH_COLLISION_FIRST_WINS
+	HASH_COLLISION_ERROR
+)
+
+// LongFieldPolicy determines how LimitFieldLengths handles fields longer than Inputs.MaxFieldLength,
+// I.E. a base64 blob, which would bloat output and hashing.
+// LONG_FIELD_TRUNCATE truncates the field to MaxFieldLength bytes, on a UTF-8 character boundary,
+// followed by LONG_FIELD_MARKER.
+// LONG_FIELD_HASH replaces the field with LONG_FIELD_MARKER and the MD5 hash of the field (I.E.
+// "...0xd41d8cd98f00b204e9800998ecf8427e"), so identical long fields can still be identified.
+type LongFieldPolicy int
+
+const (
+	LONG_FIELD_TRUNCATE LongFieldPolicy = iota
+	LONG_FIELD_HASH
+
+	// LONG_FIELD_MARKER marks a field that was limited by LimitFieldLengths.
+	LONG_FIELD_MARKER = "..."
+)
+
+// RouterPolicy determines how Split handles rows that match no Format, when Formats are used.
+// ROUTER_PASSTHROUGH splits the row using Inputs.InputDelimiter and Inputs.ExpectedFieldCount.
+// ROUTER_DROP returns nil splits and a nil error; callers should drop the row.
+// ROUTER_ERROR returns an error wrapping ErrUnmatchedFormat.
+type RouterPolicy int
+
+const (
+	ROUTER_PASSTHROUGH RouterPolicy = iota
+	ROUTER_DROP
+	ROUTER_ERROR
+)
+
+var (
+	// ErrHashCollision is returned by SplitsExcludeHashColumns, for the HASH_COLLISION_ERROR policy,
+	// when different values result in the same hash.
+	ErrHashCollision = errors.New("hash collision")
+	// ErrFieldCountPadded is returned by Split, for the FIELD_COUNT_PAD policy, when a row was padded
+	// or truncated to the expected number of fields.
+	ErrFieldCountPadded = errors.New("field count padded")
+	// ErrUnmatchedFormat is returned by Split, for the ROUTER_ERROR policy, when a row matches no Format.
+	ErrUnmatchedFormat = errors.New("row matches no format")
+	// ErrMaxErrors is returned by AddErrors when more than Inputs.MaxErrors errors have occurred.
+	ErrMaxErrors = errors.New("maximum number of errors exceeded")
+	// ErrScan is sent by Read when reading the input fails (I.E. a transient read error from network
+	// storage); the rows already sent are incomplete, and the file is not moved. Callers can
+	// discard the output and process the file again; see Inputs.ScanErrorRetries. Errors that
+	// reading again cannot fix, like a line longer than the scanner buffer (bufio.ErrTooLong),
+	// are not ErrScan.
+	ErrScan = errors.New("error reading input")
+	// ErrUnterminatedFinalLine is sent by Read, when Inputs.WarnUnterminatedFinalLine is true, when
+	// the final line of the input has no trailing newline. The line is still read.
+	ErrUnterminatedFinalLine = errors.New("final line has no trailing newline")
+
+	// Functions registered with RegisterUniqueIdFunc, by name.
+	uniqueIdFuncs      = make(map[string]func(row string) string)
+	uniqueIdFuncsMutex sync.RWMutex
+
+	// Used by CanonicalizeNumber.
+	decimalNumberRegex = regexp.MustCompile(`^[+-]?\d+$`)
+	hexNumberRegex     = regexp.MustCompile(`^0[xX][0-9a-fA-F]+$`)
+	// Used to remove submatch references (I.E. "${1}") from Extract Tokens, for ExtractOverlaps.
+	tokenReferenceRegex = regexp.MustCompile(`\$(\{\w+\}|\w+)`)
+	// Used to coerce extracts of EXTRACT_TYPE_NUMBER.
+	jsonNumberRegex = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?$`)
+	// Used to validate Extract OutputTags, which are used in file names.
+	outputTagRegex = regexp.MustCompile(`^[\w-]+$`)
+	// Layouts tried, in order, by NORM_TIMESTAMP when Extract.TimestampLayout is empty.
+	timestampLayouts = []string{time.RFC3339Nano, time.DateTime}
+	// Maximum line size for ReadHashes and VerifyHashes; hashed values can be as long as an
+	// output row.
+	hashesLineSize = math.MaxInt32
+)
+
 const (
 	// Replacement regex that match this string will be replaced with unixmicro values to save
 	// storage space.
 	DATE_TIME_REGEX = "(\\d{4}-\\d{2}-\\d{2}[ -]\\d{2}:\\d{2}:\\d{2})"
+
+	// Extract Normalizer that converts Go duration strings (see time.ParseDuration), like "1m30s"
+	// or "500ms", to integer nanoseconds. Values that are not durations are returned unchanged,
+	// with a ParseError.
+	NORM_DURATION_NS = "NORM_DURATION_NS"
+
+	// Extract Normalizer that reformats timestamps, I.E. a message containing
+	// "at 2023-10-07T12:00:00Z", to Extract.TimestampFormat. Values are parsed with the Go time
+	// layout Extract.TimestampLayout; when empty, RFC3339 (with optional fractional seconds) and
+	// time.DateTime (as for DATE_TIME_REGEX) are tried. Timestamps without a time zone are UTC.
+	// TimestampFormat is a Go time layout, and timestamps are formatted in UTC; when empty or
+	// TIMESTAMP_FORMAT_EPOCH, timestamps are formatted as Unix epoch seconds. Values that are not
+	// timestamps are returned unchanged, with a ParseError.
+	NORM_TIMESTAMP         = "NORM_TIMESTAMP"
+	TIMESTAMP_FORMAT_EPOCH = "epoch"
+
+	// Extract Normalizer that validates and canonicalizes CIDR notation, I.E. "10.0.0.5/24", and
+	// returns two values for each: the network address ("10.0.0.0") and the prefix length ("24").
+	// The values are named with the Extract Name and "network" or "prefix" (I.E. "src.network").
+	// Values that are not CIDR are returned unchanged, followed by the Default as the prefix
+	// length, with a ParseError. Not used with Delta, or a Type other than EXTRACT_TYPE_STRING.
+	NORM_CIDR = "NORM_CIDR"
+
+	// Extract Mask that replaces all but the last Extract.MaskKeepLast characters of extracted
+	// values with MASK_CHARACTER, I.E. "************1234". Shorter values are not masked.
+	MASK_KEEP_LAST = "MASK_KEEP_LAST"
+	MASK_CHARACTER = "*"
+
+	// Extract Types. Extracted values are coerced to the type; values that cannot be coerced are
+	// returned unchanged, as a string, with a ParseError. EXTRACT_TYPE_STRING is the default.
+	EXTRACT_TYPE_BOOL   = "bool"
+	EXTRACT_TYPE_NUMBER = "number"
+	EXTRACT_TYPE_STRING = ""
+
+	// FULL_ROW_SEPARATOR joins the columns of a row for an Extract with FullRow.
+	FULL_ROW_SEPARATOR = " "
+
+	// RATE_LIMITER_BURST_SECONDS is the number of seconds of tokens a RateLimiter holds, with a
+	// minimum of one token.
+	RATE_LIMITER_BURST_SECONDS = 0.1
+
+	// Input charsets; see Inputs.InputCharset. CHARSET_AUTO detects the charset of each input from
+	// a UTF-8 byte order mark, or the first CHARSET_SNIFF_BYTES being valid UTF-8, and otherwise
+	// uses CHARSET_LATIN1. A UTF-8 byte order mark is removed. CHARSET_LATIN1 (ISO-8859-1) input is
+	// decoded to UTF-8.
+	CHARSET_AUTO        = "auto"
+	CHARSET_LATIN1      = "latin-1"
+	CHARSET_SNIFF_BYTES = 64 * 1024
+	CHARSET_UTF8        = "utf-8"
+
+	// Input record separators (line terminators); see Inputs.RecordSeparator. RECORD_SEPARATOR_LF,
+	// the default, also splits on "\r\n". RECORD_SEPARATOR_CR splits on a lone "\r", as used by
+	// legacy (old Mac) files. RECORD_SEPARATOR_AUTO uses RECORD_SEPARATOR_CR for an input when its
+	// first line terminator is a "\r" not followed by "\n", and otherwise RECORD_SEPARATOR_LF.
+	RECORD_SEPARATOR_AUTO = "auto"
+	RECORD_SEPARATOR_CR   = "\r"
+	RECORD_SEPARATOR_LF   = "\n"
+
+	// PreProcessors, applied to the whole row before any other processing; see Scanner.PreProcess.
+	// PRE_JSON_UNESCAPE decodes JSON string escapes (I.E. `\"` and `\u00e9`).
+	PRE_JSON_UNESCAPE = "json-unescape"
+	// PRE_UNESCAPE decodes Go/C style backslash escapes (I.E. `\t` and `\x41`).
+	PRE_UNESCAPE = "unescape"
+	// PRE_URLDECODE decodes URL encoding (I.E. "%20" and "+" are decoded to spaces).
+	PRE_URLDECODE = "urldecode"
 )
 
+// AddErrors adds n to the count of errors (I.E. bad field counts from Split, or errors from Extract)
+// that have occurred while processing. When Inputs.MaxErrors is > 0 and the count exceeds it,
+// processing is aborted: ErrMaxErrors is returned, and Read stops reading and does not move the file.
+// Callers decide which errors count; call AddErrors for each row, then stop processing on error.
+func (scnr *Scanner) AddErrors(n int) error {
+	scnr.errorCount += n
+	if scnr.maxErrors > 0 && scnr.errorCount > scnr.maxErrors {
+		scnr.aborted.Store(true)
+		return fmt.Errorf("%w, MaxErrors: %d, errors: %d", ErrMaxErrors, scnr.maxErrors, scnr.errorCount)
+	}
+	return nil
+}
+
+// AppendIngestTimestamp appends the current time, formatted with Inputs.IngestTimestampFormat,
+// to splits. This is the time the row was parsed, not a time from the data. splits are
+// returned unchanged when Inputs.IngestTimestampFormat is empty.
+func (scnr *Scanner) AppendIngestTimestamp(splits []string) []string {
+	if scnr.ingestTimestampFormat == "" {
+		return splits
+	}
+	return append(splits, time.Now().Format(scnr.ingestTimestampFormat))
+}
+
+// AppendRunId appends the run ID (see SetRunId) to splits. splits are returned unchanged when
+// there is no run ID.
+func (scnr *Scanner) AppendRunId(splits []string) []string {
+	if scnr.runId == "" {
+		return splits
+	}
+	return append(splits, scnr.runId)
+}
+
+// Charset returns the charset of the input being read (CHARSET_LATIN1 or CHARSET_UTF8), as
+// configured or detected for CHARSET_AUTO; empty when Inputs.InputCharset is empty.
+func (scnr *Scanner) Charset() string {
+	return scnr.charset
+}
+
+// CompressionLevel returns the gzip compression level (gzip.BestSpeed to gzip.BestCompression)
+// for output files, from Inputs.CompressionLevel; 0 means output is not compressed.
+func (scnr *Scanner) CompressionLevel() int {
+	return scnr.compressionLevel
+}
+
+// CreateTableSql returns an SQL CREATE TABLE statement for a table that can receive the output
+// of SplitsToSql with the same numColumns. All columns are nullable text, named c1 to cN, followed
+// by the provenance columns when Inputs.SqlProvenance is true.
+func (scnr *Scanner) CreateTableSql(numColumns int, table string) string {
+	columns := make([]string, 0, numColumns+4)
+	for i := 1; i <= numColumns; i++ {
+		columns = append(columns, fmt.Sprintf("c%d TEXT", i))
+	}
+	for _, column := range scnr.SqlProvenanceColumns() {
+		columns = append(columns, column+" TEXT")
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s);", table, strings.Join(columns, ", "))
+}
+
+// ErrorCount returns the number of errors added with AddErrors.
+func (scnr *Scanner) ErrorCount() int {
+	return scnr.errorCount
+}
+
 // Extract takes an input row slice (call Split to split a row on scnr.inputDelimiter)
 // and applies the scnr.extract values to extract values from a column.
+// A Submatch that is out of range is reported at most once per Extract per row.
+// The type of each extracted value is available from ExtractTypes until the next call.
+// When Inputs.ExtractCacheSize > 0, rows with the same values in the Extract columns as a
+// cached row reuse the cached result, which is identical to the result of extracting again.
 func (scnr *Scanner) Extract(row []string) ([]string, []error) {
+	if scnr.extractCache == nil {
+		return scnr.extractRow(row)
+	}
+	key := scnr.extractCache.key(row)
+	if entry := scnr.extractCache.get(key); entry != nil {
+		for i, column := range scnr.extractCache.rowColumns(row) {
+			if column < len(row) {
+				row[column] = entry.columns[i]
+			}
+		}
+		for _, cell := range entry.coverage {
+			coverage := &scnr.extractCoverage[cell[0]][cell[1]]
+			coverage.Attempts++
+			if cell[2] == 1 {
+				coverage.Matches++
+			}
+		}
+		scnr.extractColumns = append(scnr.extractColumns[:0], entry.extractColumns...)
+		scnr.extractTypes = append(scnr.extractTypes[:0], entry.extractTypes...)
+		scnr.explodeIndices = append(scnr.explodeIndices[:0], entry.explodeIndices...)
+		scnr.extractMatched = entry.matched
+		scnr.extractRowOverlaps = append(scnr.extractRowOverlaps[:0], entry.overlaps...)
+		scnr.taggedExtracts = maps.Clone(entry.taggedExtracts)
+		for _, key := range entry.overlaps {
+			scnr.addExtractOverlap(key)
+		}
+		return slices.Clone(entry.extracts), slices.Clone(entry.errors)
+	}
+
+	before := make([][]ExtractCoverage, len(scnr.extractCoverage))
+	for i := range scnr.extractCoverage {
+		before[i] = slices.Clone(scnr.extractCoverage[i])
+	}
+	extracts, errors := scnr.extractRow(row)
+	entry := &extractCacheEntry{
+		errors:         slices.Clone(errors),
+		explodeIndices: slices.Clone(scnr.explodeIndices),
+		extractColumns: slices.Clone(scnr.extractColumns),
+		extractTypes:   slices.Clone(scnr.extractTypes),
+		extracts:       slices.Clone(extracts),
+		matched:        scnr.extractMatched,
+		overlaps:       slices.Clone(scnr.extractRowOverlaps),
+		taggedExtracts: maps.Clone(scnr.taggedExtracts),
+	}
+	for _, column := range scnr.extractCache.rowColumns(row) {
+		if column < len(row) {
+			entry.columns = append(entry.columns, row[column])
+		} else {
+			entry.columns = append(entry.columns, "")
+		}
+	}
+	for i := range scnr.extractCoverage {
+		for ec := range scnr.extractCoverage[i] {
+			if scnr.extractCoverage[i][ec].Attempts == before[i][ec].Attempts {
+				continue
+			}
+			matched := 0
+			if scnr.extractCoverage[i][ec].Matches != before[i][ec].Matches {
+				matched = 1
+			}
+			entry.coverage = append(entry.coverage, [3]int{i, ec, matched})
+		}
+	}
+	scnr.extractCache.put(key, entry)
+	return extracts, errors
+}
+
+// extractRow implements Extract, without the cache.
+func (scnr *Scanner) extractRow(row []string) ([]string, []error) {
 	var extracts []string
+	scnr.extractColumns = scnr.extractColumns[:0]
+	scnr.extractTypes = scnr.extractTypes[:0]
+	scnr.explodeIndices = scnr.explodeIndices[:0]
+	scnr.extractMatched = false
+	scnr.extractRowOverlaps = scnr.extractRowOverlaps[:0]
+	scnr.taggedExtracts = nil
+	if len(scnr.outputTags) > 0 {
+		scnr.taggedExtracts = make(map[string][]string, len(scnr.outputTags))
+	}
+	tokens := make(extractTokens)
 	errors := make([]error, 0)
-	for _, extrct := range scnr.extract {
+	// add appends value, of extractType, from column, to the extracts, or to the taggedExtracts
+	// for an Extract with an OutputTag.
+	add := func(extrct *Extract, column int, value string, extractType string) {
+		if extrct.OutputTag != "" {
+			scnr.taggedExtracts[extrct.OutputTag] = append(scnr.taggedExtracts[extrct.OutputTag], value)
+			return
+		}
+		if extrct.Explode {
+			scnr.explodeIndices = append(scnr.explodeIndices, len(extracts))
+		}
+		scnr.extractColumns = append(scnr.extractColumns, column)
+		extracts = append(extracts, value)
+		scnr.extractTypes = append(scnr.extractTypes, extractType)
+	}
+	// emit adds an extracted value, from column, after canonicalizing, normalizing, and
+	// prefixing with name or coercing the value.
+	emit := func(extrct *Extract, name string, column int, value string) {
+		scnr.extractMatched = true
+		// output adds a normalized value, after differencing, masking, and prefixing with name or
+		// coercing the value.
+		output := func(name string, value string) {
+			if extrct.Delta {
+				delta, err := scnr.delta(extrct, value)
+				if err != nil {
+					errors = append(errors, &ParseError{Column: column, Value: value, Message: err.Error()})
+				} else {
+					value = delta
+				}
+			}
+			if extrct.Mask == MASK_KEEP_LAST {
+				value = maskKeepLast(value, extrct.MaskKeepLast)
+			}
+			if scnr.prefixExtractsWithName && name != "" {
+				add(extrct, column, name+"="+value, EXTRACT_TYPE_STRING)
+			} else {
+				value, extractType, err := coerceExtract(value, extrct.Type)
+				if err != nil {
+					errors = append(errors, &ParseError{Column: column, Value: value, Message: err.Error()})
+				}
+				if extrct.JsonType != "" {
+					extractType = jsonExtractType(value, extrct.JsonType)
+				}
+				add(extrct, column, value, extractType)
+			}
+		}
+		if extrct.CanonicalizeNumbers {
+			value = CanonicalizeNumber(value)
+		}
+		if extrct.Normalizer == NORM_DURATION_NS {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				errors = append(errors, &ParseError{Column: column, Value: value,
+					Message: fmt.Sprintf("%s: %s", NORM_DURATION_NS, err)})
+			} else {
+				value = strconv.FormatInt(duration.Nanoseconds(), 10)
+			}
+		}
+		if extrct.Normalizer == NORM_TIMESTAMP {
+			timestamp, err := normalizeTimestamp(value, extrct.TimestampLayout, extrct.TimestampFormat)
+			if err != nil {
+				errors = append(errors, &ParseError{Column: column, Value: value,
+					Message: fmt.Sprintf("%s: %s", NORM_TIMESTAMP, err)})
+			} else {
+				value = timestamp
+			}
+		}
+		if extrct.Normalizer == NORM_CIDR {
+			network, prefixLength, err := normalizeCidr(value)
+			if err != nil {
+				errors = append(errors, &ParseError{Column: column, Value: value,
+					Message: fmt.Sprintf("%s: %s", NORM_CIDR, err)})
+				network, prefixLength = value, extrct.Default
+			}
+			names := cidrNames(name)
+			output(names[0], network)
+			output(names[1], prefixLength)
+			return
+		}
+		output(name, value)
+	}
+	// emitDefault adds the Default, without an error, for an Extract that did not match; once for
+	// each of the values of a NORM_CIDR Extract.
+	emitDefault := func(extrct *Extract, name string) {
+		names := []string{name}
+		if extrct.Normalizer == NORM_CIDR {
+			names = cidrNames(name)
+		}
+		for _, name := range names {
+			if scnr.prefixExtractsWithName && name != "" {
+				add(extrct, -1, name+"="+extrct.Default, EXTRACT_TYPE_STRING)
+			} else {
+				// The Default is validated by NewScanner.
+				value, extractType, _ := coerceExtract(extrct.Default, extrct.Type)
+				if extrct.JsonType != "" {
+					extractType = jsonExtractType(value, extrct.JsonType)
+				}
+				add(extrct, -1, value, extractType)
+			}
+		}
+	}
+
+	for i, extrct := range scnr.extract {
 		// Allow empty Extracts that just have comments
-		if extrct.RegexString == "" {
+		if extrct.empty() {
+			continue
+		}
+		if extrct.FullRow {
+			matched, err := scnr.extractFullRow(i, row, tokens, emit)
+			if err != nil {
+				errors = append(errors, err)
+			}
+			if scnr.extractFixedColumns && !matched {
+				emitDefault(extrct, extrct.Name)
+			}
 			continue
 		}
+		// A misconfigured Submatch fails for every match; only report it once per row.
+		submatchErrorReported := false
+		matched := false
 		for ec := range extrct.Columns {
 			if extrct.Columns[ec] >= len(row) {
 				continue
 			}
+			coverage := &scnr.extractCoverage[i][ec]
+			coverage.Attempts++
+
+			if extrct.Json {
+				objects := findJsonObjects(row[extrct.Columns[ec]])
+				if len(objects) > 0 {
+					coverage.Matches++
+				}
+				for _, object := range objects {
+					jsonString := row[extrct.Columns[ec]][object[0]:object[1]]
+					scnr.checkExtractOverlap(tokens, i, extrct.Columns[ec], jsonString)
+					if scnr.extractFixedColumns && matched {
+						continue
+					}
+					matched = true
+					if len(extrct.JsonKeys) == 0 {
+						emit(extrct, extrct.Name, extrct.Columns[ec], jsonString)
+						continue
+					}
+					values := make(map[string]json.RawMessage)
+					if err := json.Unmarshal([]byte(jsonString), &values); err != nil {
+						errors = append(errors, &ParseError{Column: extrct.Columns[ec], Value: jsonString, Message: err.Error()})
+					}
+					for _, key := range extrct.JsonKeys {
+						value, ok := values[key]
+						if !ok {
+							emitDefault(extrct, extrct.jsonKeyName(key))
+							continue
+						}
+						emit(extrct, extrct.jsonKeyName(key), extrct.Columns[ec], jsonValueString(value))
+					}
+				}
+				row[extrct.Columns[ec]] = replaceSpans(row[extrct.Columns[ec]], objects, extrct.Token)
+				if len(objects) > 0 {
+					tokens.add(i, extrct.Columns[ec])
+				}
+				continue
+			}
+
+			if extrct.Between != [2]string{} {
+				column := row[extrct.Columns[ec]]
+				spans := findBetween(column, extrct.Between[0], extrct.Between[1])
+				if len(spans) > 0 {
+					coverage.Matches++
+				}
+				for _, span := range spans {
+					scnr.checkExtractOverlap(tokens, i, extrct.Columns[ec], column[span[0]:span[1]])
+					if scnr.extractFixedColumns && matched {
+						continue
+					}
+					matched = true
+					emit(extrct, extrct.Name, extrct.Columns[ec], column[span[0]+len(extrct.Between[0]):span[1]-len(extrct.Between[1])])
+				}
+				row[extrct.Columns[ec]] = replaceSpans(column, spans, extrct.Token)
+				if len(spans) > 0 {
+					tokens.add(i, extrct.Columns[ec])
+				}
+				continue
+			}
 
 			sbms := extrct.regex.FindAllStringSubmatch(row[extrct.Columns[ec]], -1)
+			if len(sbms) > 0 {
+				coverage.Matches++
+			}
 			for _, sbm := range sbms {
+				scnr.checkExtractOverlap(tokens, i, extrct.Columns[ec], sbm[0])
 				if extrct.Submatch >= len(sbm) {
-					errors = append(errors, fmt.Errorf("submatch index %d out of range for submatches:%+v, regex: %s",
-						extrct.Submatch, sbm, extrct.RegexString))
+					if !submatchErrorReported {
+						submatchErrorReported = true
+						errors = append(errors, fmt.Errorf("submatch index %d out of range for submatches:%+v, regex: %s",
+							extrct.Submatch, sbm, extrct.RegexString))
+					}
+					continue
+				}
+				if scnr.extractFixedColumns && matched {
 					continue
 				}
-				extracts = append(extracts, sbm[extrct.Submatch])
+				matched = true
+				emit(extrct, extrct.Name, extrct.Columns[ec], sbm[extrct.Submatch])
 			}
 			row[extrct.Columns[ec]] = extrct.regex.ReplaceAllString(row[extrct.Columns[ec]], extrct.Token)
+			if len(sbms) > 0 {
+				tokens.add(i, extrct.Columns[ec])
+			}
+		}
+		if scnr.extractFixedColumns && !matched {
+			if extrct.Json && len(extrct.JsonKeys) > 0 {
+				for _, key := range extrct.JsonKeys {
+					emitDefault(extrct, extrct.jsonKeyName(key))
+				}
+			} else {
+				emitDefault(extrct, extrct.Name)
+			}
+		}
+	}
+
+	// Templates are emitted after all Extracts have replaced matches with tokens.
+	for _, extrct := range scnr.extract {
+		if !extrct.EmitTemplate || extrct.empty() {
+			continue
+		}
+		for _, column := range extrct.Columns {
+			if column >= len(row) {
+				continue
+			}
+			if extrct.OutputTag != "" {
+				scnr.taggedExtracts[extrct.OutputTag] = append(scnr.taggedExtracts[extrct.OutputTag], row[column])
+				continue
+			}
+			extracts = append(extracts, row[column])
+			scnr.extractColumns = append(scnr.extractColumns, column)
+			scnr.extractTypes = append(scnr.extractTypes, EXTRACT_TYPE_STRING)
 		}
 	}
 
+	if scnr.dedupExtractsPerRow {
+		extracts = scnr.dedupExtracts(extracts)
+	}
 	return extracts, errors
 }
 
+// addExtractOverlap counts a row for the extractOverlaps key: the extract index, the TokenOf extract
+// index, and the column.
+func (scnr *Scanner) addExtractOverlap(key [3]int) {
+	index := slices.Index(scnr.extractOverlapKeys, key)
+	if index < 0 {
+		index = len(scnr.extractOverlaps)
+		scnr.extractOverlapKeys = append(scnr.extractOverlapKeys, key)
+		scnr.extractOverlaps = append(scnr.extractOverlaps, ExtractOverlap{Column: key[2],
+			Extract: scnr.extractName(key[0]), TokenOf: scnr.extractName(key[1])})
+	}
+	scnr.extractOverlaps[index].Rows++
+}
+
+// checkExtractOverlap checks whether matched, text matched by the Extract at index in column,
+// contains the Token inserted into the column by an earlier Extract, and counts an ExtractOverlap,
+// once per row, when it does.
+func (scnr *Scanner) checkExtractOverlap(tokens extractTokens, index int, column int, matched string) {
+	for _, tokenOf := range tokens[column] {
+		key := [3]int{index, tokenOf, column}
+		if tokenOf == index || scnr.extract[tokenOf].tokenLiteral == "" || !strings.Contains(matched, scnr.extract[tokenOf].tokenLiteral) ||
+			slices.Contains(scnr.extractRowOverlaps, key) {
+			continue
+		}
+		scnr.extractRowOverlaps = append(scnr.extractRowOverlaps, key)
+		scnr.addExtractOverlap(key)
+	}
+}
+
+// delta returns the difference between value and the previous value of extrct for the deltaKey,
+// or the extrct Default when there is no previous value, and stores value as the previous value.
+// Integers return an integer difference. An error is returned when value is not a number.
+func (scnr *Scanner) delta(extrct *Extract, value string) (string, error) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value, fmt.Errorf("Delta: value is not a number")
+	}
+	key := deltaPreviousKey{extract: extrct, key: scnr.deltaKey}
+	previous, ok := scnr.deltaPrevious[key]
+	scnr.deltaPrevious[key] = value
+	if !ok {
+		return extrct.Default, nil
+	}
+	integer, intErr := strconv.ParseInt(value, 10, 64)
+	previousInteger, previousIntErr := strconv.ParseInt(previous, 10, 64)
+	if intErr == nil && previousIntErr == nil {
+		return strconv.FormatInt(integer-previousInteger, 10), nil
+	}
+	// previous was validated when it was stored.
+	previousNumber, _ := strconv.ParseFloat(previous, 64)
+	return strconv.FormatFloat(number-previousNumber, 'f', -1, 64), nil
+}
+
+// extractFullRow applies the FullRow Extract at index to row, calling emit for each extracted
+// value, and replacing each match with the Token; see Extract. An error is returned for a Submatch
+// that is out of range.
+func (scnr *Scanner) extractFullRow(index int, row []string, tokens extractTokens,
+	emit func(extrct *Extract, name string, column int, value string)) (bool, error) {
+	extrct := scnr.extract[index]
+	coverage := &scnr.extractCoverage[index][0]
+	coverage.Attempts++
+	// offsets are the offset of each column in joined.
+	offsets := make([]int, len(row))
+	for i := range row {
+		if i > 0 {
+			offsets[i] = offsets[i-1] + len(row[i-1]) + len(FULL_ROW_SEPARATOR)
+		}
+	}
+	joined := strings.Join(row, FULL_ROW_SEPARATOR)
+	matches := extrct.regex.FindAllStringSubmatchIndex(joined, -1)
+	if len(matches) == 0 {
+		return false, nil
+	}
+	coverage.Matches++
+
+	var err error
+	matched := false
+	for _, match := range matches {
+		scnr.checkExtractOverlap(tokens, index, fullRowColumn(offsets, match[0]), joined[match[0]:match[1]])
+		if 2*extrct.Submatch+1 >= len(match) {
+			if err == nil {
+				err = fmt.Errorf("submatch index %d out of range for submatches:%d, regex: %s",
+					extrct.Submatch, len(match)/2, extrct.RegexString)
+			}
+			continue
+		}
+		start, end := match[2*extrct.Submatch], match[2*extrct.Submatch+1]
+		// Optional groups that did not participate have no value.
+		if start < 0 || scnr.extractFixedColumns && matched {
+			continue
+		}
+		matched = true
+		emit(extrct, extrct.Name, fullRowColumn(offsets, start), joined[start:end])
+	}
+	// Replace from the last match, so the offsets of earlier matches are unchanged.
+	for m := len(matches) - 1; m >= 0; m-- {
+		start, end := matches[m][0], matches[m][1]
+		token := string(extrct.regex.ExpandString(nil, extrct.Token, joined, matches[m]))
+		first := fullRowColumn(offsets, start)
+		last := first
+		if end > start {
+			last = fullRowColumn(offsets, end-1)
+		}
+		tokens.add(index, first)
+		head := row[first][:min(start-offsets[first], len(row[first]))]
+		if first == last {
+			row[first] = head + token + row[first][min(end-offsets[first], len(row[first])):]
+			continue
+		}
+		row[first] = head + token
+		for column := first + 1; column < last; column++ {
+			row[column] = ""
+		}
+		row[last] = row[last][min(end-offsets[last], len(row[last])):]
+	}
+	return matched, err
+}
+
+// fullRowColumn returns the index of the column containing offset in the joined row, where
+// offsets are the column offsets; an offset in a FULL_ROW_SEPARATOR is in the preceding column.
+func fullRowColumn(offsets []int, offset int) int {
+	column, found := slices.BinarySearch(offsets, offset)
+	if !found {
+		column--
+	}
+	return column
+}
+
+// dedupExtracts removes duplicate values from extracts, keeping the first of each, along with
+// the matching extractColumns, extractTypes, and explodeIndices.
+func (scnr *Scanner) dedupExtracts(extracts []string) []string {
+	seen := make(map[string]bool, len(extracts))
+	kept := extracts[:0]
+	columns := scnr.extractColumns[:0]
+	types := scnr.extractTypes[:0]
+	var explodeIndices []int
+	for i, value := range extracts {
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		if slices.Contains(scnr.explodeIndices, i) {
+			explodeIndices = append(explodeIndices, len(kept))
+		}
+		kept = append(kept, value)
+		columns = append(columns, scnr.extractColumns[i])
+		types = append(types, scnr.extractTypes[i])
+	}
+	scnr.extractColumns = columns
+	scnr.extractTypes = types
+	scnr.explodeIndices = append(scnr.explodeIndices[:0], explodeIndices...)
+	return kept
+}
+
+// Explode returns the extracts returned by the last call to Extract as one set of extracts per
+// value of the Extract with Explode set, so a row representing multiple events can be output
+// as one row per event. Each set has the exploded value in place of all the exploded values, and
+// all other extracts duplicated. When no Extract has Explode set, or it returned no values, the
+// extracts are returned as the only set. ExtractTypes is updated to match the sets, so Explode
+// must be called only once per call to Extract.
+func (scnr *Scanner) Explode(extracts []string) [][]string {
+	if len(scnr.explodeIndices) <= 1 {
+		return [][]string{extracts}
+	}
+	first := scnr.explodeIndices[0]
+	kept := make([]string, 0, len(extracts)-len(scnr.explodeIndices)+1)
+	keptTypes := make([]string, 0, cap(kept))
+	for i := range extracts {
+		if i == first || !slices.Contains(scnr.explodeIndices, i) {
+			kept = append(kept, extracts[i])
+			if i < len(scnr.extractTypes) {
+				keptTypes = append(keptTypes, scnr.extractTypes[i])
+			}
+		}
+	}
+	scnr.extractTypes = keptTypes
+
+	exploded := make([][]string, 0, len(scnr.explodeIndices))
+	for _, index := range scnr.explodeIndices {
+		row := slices.Clone(kept)
+		row[first] = extracts[index]
+		exploded = append(exploded, row)
+	}
+	return exploded
+}
+
+// ExtractCoverage returns the ExtractCoverage for each Extract, for each of the Extract Columns,
+// for all rows processed by Extract. Columns where an Extract was attempted but never matched
+// (Matches == 0) indicate an Extract that needs tuning, or a column where it is not needed.
+func (scnr *Scanner) ExtractCoverage() []ExtractCoverage {
+	coverage := make([]ExtractCoverage, 0, len(scnr.extractCoverage))
+	for i, extrct := range scnr.extract {
+		if extrct.empty() {
+			continue
+		}
+		coverage = append(coverage, scnr.extractCoverage[i]...)
+	}
+	return coverage
+}
+
+// ExtractCoverageReport returns the ExtractCoverage, one per line, with the percent of attempts
+// that matched. Columns where the Extract was attempted but never matched are marked "NEVER MATCHED".
+// Call this after processing the data to tune the Extracts.
+func (scnr *Scanner) ExtractCoverageReport() string {
+	var sb strings.Builder
+	for _, coverage := range scnr.ExtractCoverage() {
+		percent := 0.0
+		if coverage.Attempts > 0 {
+			percent = 100 * float64(coverage.Matches) / float64(coverage.Attempts)
+		}
+		fmt.Fprintf(&sb, "extract: %s, column: %d, attempts: %d, matches: %d, percent: %.1f", coverage.Extract,
+			coverage.Column, coverage.Attempts, coverage.Matches, percent)
+		if coverage.Attempts > 0 && coverage.Matches == 0 {
+			sb.WriteString(", NEVER MATCHED")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// extractName returns the Name of the Extract at index, or "extract" and the index when there is no Name.
+func (scnr *Scanner) extractName(index int) string {
+	if scnr.extract[index].Name == "" {
+		return fmt.Sprintf("extract%d", index)
+	}
+	return scnr.extract[index].Name
+}
+
+// ExtractOverlaps returns the ExtractOverlaps for all rows processed by Extract, in the order they
+// were first found. Any ExtractOverlap likely indicates a configuration error; see ExtractOverlap.
+func (scnr *Scanner) ExtractOverlaps() []ExtractOverlap {
+	return slices.Clone(scnr.extractOverlaps)
+}
+
+// ExtractResults calls Extract and pairs each extracted value with the column it was extracted
+// from, so values from an Extract that runs on multiple columns can be told apart.
+func (scnr *Scanner) ExtractResults(row []string) ([]ExtractResult, []error) {
+	extracts, errors := scnr.Extract(row)
+	results := make([]ExtractResult, len(extracts))
+	for i, value := range extracts {
+		results[i] = ExtractResult{Column: scnr.extractColumns[i], Value: value}
+	}
+	return results, errors
+}
+
+// ExtractTypes returns the type (I.E. EXTRACT_TYPE_NUMBER) of each value returned by the last
+// call to Extract. Values prefixed with the Extract Name are EXTRACT_TYPE_STRING.
+func (scnr *Scanner) ExtractTypes() []string {
+	return scnr.extractTypes
+}
+
 // Filter takes in input row and applies the scnr.negativeFilter and
 // scnr.positiveFilter. True means the row should be filtered (dropped),
 // false means keep the row.
@@ -154,6 +1407,19 @@ func (scnr *Scanner) Filter(row string) bool {
 	return false
 }
 
+// FilterExtracts applies Inputs.RequireExtract after Extract: true means the row should be
+// filtered (dropped) because no Extract matched in the last call to Extract, false means keep the
+// row. Extract Defaults and templates (see Extract.EmitTemplate) are not matches.
+func (scnr *Scanner) FilterExtracts() bool {
+	return scnr.requireExtract && !scnr.extractMatched
+}
+
+// HashColumnsIndividually is true when each hash column is hashed independently; see
+// Inputs.HashColumnsIndividually. There is no combined hash for the row.
+func (scnr *Scanner) HashColumnsIndividually() bool {
+	return scnr.hashColumnsIndividually
+}
+
 // HashingEnabled is true when the inputs are specifying that hashing is to be performed; false otherwise.
 func (scnr *Scanner) HashingEnabled() bool {
 	if scnr.HashColumns != nil && len(scnr.HashColumns) > 0 {
@@ -162,27 +1428,198 @@ func (scnr *Scanner) HashingEnabled() bool {
 	return false
 }
 
-// OpenFileScanner convenience function to open a file based scanner.
-func (scnr *Scanner) OpenFileScanner(filePath string) (err error) {
+// LimitFieldLengths limits the length of each of the splits, in place, to Inputs.MaxFieldLength,
+// according to the Inputs.LongFieldPolicy. Call this after Extract, so values can be extracted
+// from long fields, and before SplitsExcludeHashColumns. The number of fields that were limited
+// is returned.
+func (scnr *Scanner) LimitFieldLengths(splits []string) int {
+	if scnr.maxFieldLength <= 0 {
+		return 0
+	}
+	limited := 0
+	for i, split := range splits {
+		if len(split) <= scnr.maxFieldLength {
+			continue
+		}
+		limited++
+		switch scnr.longFieldPolicy {
+		case LONG_FIELD_HASH:
+			splits[i] = fmt.Sprintf("%s0x%x", LONG_FIELD_MARKER, md5.Sum([]byte(split)))
+		default:
+			end := scnr.maxFieldLength
+			for end > 0 && !utf8.RuneStart(split[end]) {
+				end--
+			}
+			splits[i] = split[:end] + LONG_FIELD_MARKER
+		}
+	}
+	return limited
+}
+
+// MessageTypeIdsEnabled is true when the inputs are specifying that message type IDs are to be
+// assigned to hashes; false otherwise.
+func (scnr *Scanner) MessageTypeIdsEnabled() bool {
+	return scnr.HashingEnabled() && scnr.messageTypeIdPrefix != ""
+}
+
+// Newline returns the newline to use when writing parsed output, hashes, and message type IDs, as
+// specified by Inputs.OutputNewline.
+func (scnr *Scanner) Newline() string {
+	return scnr.newline
+}
+
+// OpenFileScanner convenience function to open a file based scanner. Gzip compressed files are
+// detected and decompressed.
+func (scnr *Scanner) OpenFileScanner(filePath string) (err error) {
 	scnr.file, err = os.Open(filePath)
 	if err != nil {
 		return err
 	}
+	scnr.sourceFile = filepath.Base(filePath)
+
+	reader, err := gunzipReader(scnr.checksumReader(scnr.file))
+	if err != nil {
+		scnr.file.Close()
+		return err
+	}
+	scnr.OpenIoReaderScanner(reader)
+	return nil
+}
+
+// OpenUrlScanner opens a scanner reading the body of an HTTP(S) GET of url, without downloading it
+// first. A body with Content-Encoding gzip or deflate is decompressed, as is a gzip compressed body
+// (I.E. a .gz file). The body is closed by Shutdown. Since there is no file, the processedInputDirectory
+// is not used.
+func (scnr *Scanner) OpenUrlScanner(url string) error {
+	response, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return fmt.Errorf("GET %s: %s", url, response.Status)
+	}
+	scnr.closer = response.Body
+	scnr.sourceFile = path.Base(response.Request.URL.Path)
 
-	scnr.OpenIoReaderScanner(scnr.file)
+	body := scnr.checksumReader(response.Body)
+	// The http.Transport decompresses gzip when it requested it, and then sets Uncompressed.
+	if !response.Uncompressed {
+		switch strings.ToLower(response.Header.Get("Content-Encoding")) {
+		case "gzip":
+			body, err = gzip.NewReader(body)
+		case "deflate":
+			body, err = zlib.NewReader(body)
+		}
+		if err != nil {
+			response.Body.Close()
+			return err
+		}
+	}
+	reader, err := gunzipReader(body)
+	if err != nil {
+		response.Body.Close()
+		return err
+	}
+	scnr.OpenIoReaderScanner(reader)
 	return nil
 }
 
 // OpenIoReaderScanner opens a scanner using the supplied io.Reader. Callers reading
-// from a file should call OpenFileScanner instead of this function.
+// from a file should call OpenFileScanner instead of this function. Rows are split on
+// Inputs.RecordSeparator; for RECORD_SEPARATOR_AUTO the separator is detected from the input.
 func (scnr *Scanner) OpenIoReaderScanner(ior io.Reader) {
+	scnr.charset = ""
+	if scnr.inputCharset != "" {
+		ior = scnr.charsetReader(ior)
+	}
 	scanner := bufio.NewScanner(ior)
+	separator := scnr.recordSeparator
+	// Count the bytes consumed by the scanner, which are uncompressed bytes for compressed input.
+	// At EOF, the split functions return the remaining data, without a terminator, as the final line.
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if separator == RECORD_SEPARATOR_AUTO {
+			detected, ok := detectRecordSeparator(data, atEOF)
+			if !ok {
+				return 0, nil, nil
+			}
+			separator = detected
+		}
+		split, terminator := bufio.ScanLines, byte('\n')
+		if separator == RECORD_SEPARATOR_CR {
+			split, terminator = scanCrLines, '\r'
+		}
+		advance, token, err := split(data, atEOF)
+		scnr.bytesScanned += int64(advance)
+		if atEOF && advance > 0 && advance == len(data) && data[advance-1] != terminator {
+			scnr.unterminatedFinalLine = true
+		}
+		return advance, token, err
+	})
 	scnr.scanner = scanner
+	scnr.bytesScanned = 0
+	scnr.unterminatedFinalLine = false
+	scnr.ingestTime = time.Now()
+}
+
+// ParetoReport returns the top hashes by count, one per line, with the count, percent of the
+// total count, cumulative percent, and the value for the hash. All hashes are included when
+// top <= 0. Call this after processing the data to get the pareto analysis of the hashes.
+func (scnr *Scanner) ParetoReport(top int) string {
+	total := 0
+	for _, count := range scnr.HashCounts {
+		total += count
+	}
+	hashes := SortedHashMapCounts(scnr.HashCounts)
+	if top > 0 && top < len(hashes) {
+		hashes = hashes[:top]
+	}
+
+	var sb strings.Builder
+	cumulative := 0
+	for _, hash := range hashes {
+		count := scnr.HashCounts[hash]
+		cumulative += count
+		fmt.Fprintf(&sb, "hash: %s, count: %d, percent: %.1f, cumulative: %.1f, value: %s\n", hash, count,
+			100*float64(count)/float64(total), 100*float64(cumulative)/float64(total), scnr.HashMap[hash])
+	}
+	return sb.String()
+}
+
+// charsetReader sets scnr.charset to the charset of r, detecting it for CHARSET_AUTO, and returns
+// a reader for r with any UTF-8 byte order mark removed.
+func (scnr *Scanner) charsetReader(r io.Reader) io.Reader {
+	reader := bufio.NewReaderSize(r, CHARSET_SNIFF_BYTES)
+	sniff, err := reader.Peek(CHARSET_SNIFF_BYTES)
+	bom := bytes.HasPrefix(sniff, []byte{0xef, 0xbb, 0xbf})
+	if bom {
+		reader.Discard(3)
+	}
+	scnr.charset = scnr.inputCharset
+	if scnr.inputCharset == CHARSET_AUTO {
+		scnr.charset = CHARSET_LATIN1
+		// The last rune may be cut off when the input is longer than the sniffed bytes.
+		if bom || utf8.Valid(sniff) || (err == nil && validUtf8Prefix(sniff)) {
+			scnr.charset = CHARSET_UTF8
+		}
+	}
+	return reader
 }
 
 // Read starts a Go routine to read data from the input scanner and returns channels from
 // which the caller can pull data and errors. Both data and error channels are buffered with
 // buffer sizes databuffer and errorBuffer.
+// When Inputs.ReorderWindow > 0, rows are held in a read-ahead window of that many rows, and the
+// row with the earliest timestamp is sent when the window is full, so slightly out of order input
+// is output in time order. The timestamp is Inputs.ReorderColumn, after splitting with the
+// InputDelimiter, parsed with Inputs.ReorderTimeLayout. Rows out of order by more than the window
+// are not reordered. Rows without a timestamp (the column is missing, or cannot be parsed) take
+// the timestamp of the previous row, so they stay with it. Reordered rows are not sent in line order,
+// so ReorderWindow cannot be used with Inputs.UniqueIdFunc.
+// A final line without a trailing newline is read; when Inputs.WarnUnterminatedFinalLine is true,
+// ErrUnterminatedFinalLine is also sent on the error channel after the data. When reading the input
+// fails, ErrScan is sent on the error channel and the file is not moved. Other scanner errors (I.E.
+// bufio.ErrTooLong) stop reading, and are sent on the error channel, but the file is moved.
 func (scnr *Scanner) Read(databuffer int, errorBuffer int) (<-chan string, <-chan error) {
 	scnr.dataChan = make(chan string, databuffer)
 	scnr.errorChan = make(chan error, errorBuffer)
@@ -190,21 +1627,59 @@ func (scnr *Scanner) Read(databuffer int, errorBuffer int) (<-chan string, <-cha
 		defer close(scnr.dataChan)
 		defer close(scnr.errorChan)
 
-		for scnr.scanner.Scan() {
+		var window *reorderWindow
+		if scnr.reorderWindow > 0 {
+			window = &reorderWindow{}
+		}
+		for !scnr.aborted.Load() && scnr.scanner.Scan() {
 			row := scnr.scanner.Text()
+			// The final row before a read error is incomplete; the error is sent after reading stops.
 			if err := scnr.scanner.Err(); err != nil {
-				scnr.errorChan <- err
 				continue
 			}
+			if scnr.charset == CHARSET_LATIN1 {
+				row = latin1ToUtf8(row)
+			}
 
-			scnr.dataChan <- row
+			if window == nil {
+				scnr.dataChan <- row
+			} else {
+				window.push(scnr.reorderRow(row, window))
+				if len(window.rows) > scnr.reorderWindow {
+					scnr.dataChan <- window.pop()
+				}
+			}
+			if scnr.progress != nil {
+				scnr.progress(scnr.bytesScanned)
+			}
+		}
+		for window != nil && len(window.rows) > 0 && !scnr.aborted.Load() {
+			scnr.dataChan <- window.pop()
+		}
+		// Scan stops at the first error, so the input was not read to the end. Only errors reading
+		// the input can succeed when the input is read again.
+		scanErr := scnr.scanner.Err()
+		retryable := scanErr != nil && !scannerError(scanErr)
+		if scanErr != nil && !scnr.aborted.Load() {
+			if retryable {
+				scnr.errorChan <- fmt.Errorf("%w: %s, input: %s", ErrScan, scanErr, scnr.sourceFile)
+			} else {
+				scnr.errorChan <- fmt.Errorf("%w, input: %s", scanErr, scnr.sourceFile)
+			}
+		}
+		if scnr.warnUnterminatedFinalLine && scnr.unterminatedFinalLine && !scnr.aborted.Load() {
+			scnr.errorChan <- fmt.Errorf("%w, input: %s", ErrUnterminatedFinalLine, scnr.sourceFile)
 		}
 
-		// The name will not be available after Shutdown()
-		processedFileName := scnr.file.Name()
+		// The name will not be available after Shutdown(). Only files are moved, not readers.
+		var processedFileName string
+		if scnr.file != nil {
+			processedFileName = scnr.file.Name()
+		}
 		scnr.Shutdown()
 
-		if scnr.processedInputDirectory != "" {
+		// Aborted files, and files that could not be read, are left in place, to be processed again.
+		if scnr.processedInputDirectory != "" && processedFileName != "" && !scnr.aborted.Load() && !retryable {
 			err := os.Rename(processedFileName, filepath.Join(scnr.processedInputDirectory, filepath.Base(processedFileName)))
 			if err != nil {
 				scnr.errorChan <- err
@@ -215,10 +1690,90 @@ func (scnr *Scanner) Read(databuffer int, errorBuffer int) (<-chan string, <-cha
 	return scnr.dataChan, scnr.errorChan
 }
 
+// reorderRow returns the reorderWindowRow for row, the next row read into window.
+func (scnr *Scanner) reorderRow(row string, window *reorderWindow) reorderWindowRow {
+	window.line++
+	rr := reorderWindowRow{line: window.line, row: row, time: window.last}
+	splits := scnr.inputDelimiter.Split(row, -1)
+	if scnr.reorderColumn < len(splits) {
+		if t, err := time.Parse(scnr.reorderTimeLayout, strings.TrimSpace(splits[scnr.reorderColumn])); err == nil {
+			rr.time = t
+		}
+	}
+	window.last = rr.time
+	return rr
+}
+
+// push adds rr to the window, in order.
+func (window *reorderWindow) push(rr reorderWindowRow) {
+	index, _ := slices.BinarySearchFunc(window.rows, rr, func(a, b reorderWindowRow) int {
+		if c := a.time.Compare(b.time); c != 0 {
+			return c
+		}
+		return a.line - b.line
+	})
+	window.rows = slices.Insert(window.rows, index, rr)
+}
+
+// pop removes and returns the earliest row in the window.
+func (window *reorderWindow) pop() string {
+	row := window.rows[0].row
+	window.rows = window.rows[1:]
+	return row
+}
+
+// PrependRowId returns the splits with the Hash of the raw input row (the row as returned by Read,
+// before PreProcess) added as the first column, when Inputs.RowId is true; otherwise the splits are
+// returned unchanged. Identical rows always have the same row ID, across runs, so the row ID can be
+// used as a primary key (I.E. with INSERT OR REPLACE) to load the same input more than once without
+// duplicating rows. RowId cannot be used with Extract.Explode, as exploded rows would have the same
+// row ID. Call PrependRowId after all other processing of the splits; column indeces
+// in Inputs.SqlQuoteColumns and Inputs.OutputColumnNames include the row ID.
+func (scnr *Scanner) PrependRowId(splits []string, row string, format HashFormat) ([]string, error) {
+	if !scnr.rowId {
+		return splits, nil
+	}
+	rowId, err := Hash(row, format)
+	if err != nil {
+		return splits, err
+	}
+	return append([]string{rowId}, splits...), nil
+}
+
+// PreProcess applies the scnr.preProcessors, in order, to the supplied input row of data. This is
+// the first stage of processing, before Filter and Replace. When a PreProcessor cannot decode the
+// row, the row is returned as it was before that PreProcessor, with a ParseError.
+func (scnr *Scanner) PreProcess(row string) (string, error) {
+	var errs []error
+	for _, preProcessor := range scnr.preProcessors {
+		var processed string
+		var err error
+		switch preProcessor {
+		case PRE_JSON_UNESCAPE:
+			processed, err = jsonUnescape(row)
+		case PRE_UNESCAPE:
+			processed, err = unescape(row)
+		case PRE_URLDECODE:
+			processed, err = url.QueryUnescape(row)
+		}
+		if err != nil {
+			errs = append(errs, &ParseError{Column: -1, Value: row, Message: fmt.Sprintf("%s: %s", preProcessor, err)})
+			continue
+		}
+		row = processed
+	}
+	return row, errors.Join(errs...)
+}
+
 // Replace applies the scnr.replace values to the supplied input row of data. The special case where
 // RegexString == DATE_TIME_REGEX uses a function to replace a date time string with Unix epoch.
+// A Replacement with a GuardRegex is skipped for rows that do not match the GuardRegex; the guard
+// is checked against the row as modified by any prior Replacements.
 func (scnr *Scanner) Replace(row string) string {
 	for _, rplc := range scnr.replace {
+		if rplc.guardRegex != nil && !rplc.guardRegex.MatchString(row) {
+			continue
+		}
 		if rplc.RegexString == DATE_TIME_REGEX {
 			row = string(rplc.regex.ReplaceAllFunc([]byte(row), dateTimeToUnixEpoch))
 		} else {
@@ -228,41 +1783,306 @@ func (scnr *Scanner) Replace(row string) string {
 	return row
 }
 
+// OutputColumnNames returns the names of the Schema Columns, with the Inputs.OutputColumnNames
+// replacing the default names (I.E. "column0"), or nil when there are no OutputColumnNames. This
+// separates the presentation of the output, I.E. NDJSON keys, from the input column identity.
+func (scnr *Scanner) OutputColumnNames() []string {
+	if len(scnr.outputColumnNames) == 0 {
+		return nil
+	}
+	var names []string
+	for _, column := range scnr.Schema().Columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+// OutputTags returns the Extract OutputTags, sorted, without duplicates; nil when no Extract has
+// an OutputTag.
+func (scnr *Scanner) OutputTags() []string {
+	return scnr.outputTags
+}
+
+// Schema returns the Schema of the Scanner output.
+func (scnr *Scanner) Schema() Schema {
+	schema := Schema{Columns: []SchemaColumn{}, ExtractFixedColumns: scnr.extractFixedColumns, Extracts: []SchemaColumn{}}
+	hashColumns := slices.Clone(scnr.HashColumns)
+	slices.Sort(hashColumns)
+	hashInserted := false
+	if scnr.rowId {
+		schema.Columns = append(schema.Columns, SchemaColumn{Name: "rowId", SplitColumns: []int{}, Type: "hash"})
+	}
+	for i := 0; i < scnr.expectedFieldCount; i++ {
+		if slices.Contains(scnr.HashColumns, i) && scnr.hashColumnsIndividually {
+			schema.Columns = append(schema.Columns, SchemaColumn{Hashed: true, Name: fmt.Sprintf("column%dHash", i),
+				SplitColumns: []int{i}, Type: "hash"})
+			continue
+		}
+		if slices.Contains(scnr.HashColumns, i) {
+			if !hashInserted {
+				hashInserted = true
+				schema.Columns = append(schema.Columns, SchemaColumn{Hashed: true, Name: "hash",
+					SplitColumns: hashColumns, Type: "hash"})
+				if scnr.MessageTypeIdsEnabled() {
+					schema.Columns = append(schema.Columns, SchemaColumn{Name: "messageTypeId", SplitColumns: []int{}, Type: "string"})
+				}
+			}
+			continue
+		}
+		schema.Columns = append(schema.Columns, SchemaColumn{Name: fmt.Sprintf("column%d", i), SplitColumns: []int{i}, Type: "string"})
+	}
+	if scnr.ingestTimestampFormat != "" {
+		schema.Columns = append(schema.Columns, SchemaColumn{Name: "ingestTimestamp", SplitColumns: []int{}, Type: "string"})
+	}
+	if scnr.runId != "" {
+		schema.Columns = append(schema.Columns, SchemaColumn{Name: "runId", SplitColumns: []int{}, Type: "string"})
+	}
+	for i, name := range scnr.outputColumnNames {
+		if i < len(schema.Columns) && name != "" {
+			schema.Columns[i].Name = name
+		}
+	}
+
+	// Extracts with an OutputTag are not output with the other extracts.
+	for i, extrct := range scnr.extract {
+		if extrct.empty() || extrct.OutputTag != "" {
+			continue
+		}
+		name := extrct.Name
+		if name == "" {
+			name = fmt.Sprintf("extract%d", i)
+		}
+		extractType := extrct.Type
+		if extrct.JsonType != "" {
+			extractType = extrct.JsonType
+		}
+		if extractType == EXTRACT_TYPE_STRING || scnr.prefixExtractsWithName && extrct.Name != "" {
+			extractType = "string"
+		}
+		names := []string{name}
+		if extrct.Json && len(extrct.JsonKeys) > 0 {
+			names = names[:0]
+			for _, key := range extrct.JsonKeys {
+				names = append(names, name+"."+key)
+			}
+		}
+		for _, name := range names {
+			if extrct.Normalizer == NORM_CIDR {
+				for _, cidrName := range cidrNames(name) {
+					schema.Extracts = append(schema.Extracts, SchemaColumn{Name: cidrName, SplitColumns: extrct.Columns, Type: extractType})
+				}
+				continue
+			}
+			schema.Extracts = append(schema.Extracts, SchemaColumn{Name: name, SplitColumns: extrct.Columns, Type: extractType})
+		}
+	}
+	for i, extrct := range scnr.extract {
+		if !extrct.EmitTemplate || extrct.empty() || extrct.OutputTag != "" {
+			continue
+		}
+		name := extrct.Name
+		if name == "" {
+			name = fmt.Sprintf("extract%d", i)
+		}
+		for _, column := range extrct.Columns {
+			schema.Extracts = append(schema.Extracts, SchemaColumn{Name: fmt.Sprintf("%sTemplate%d", name, column),
+				SplitColumns: []int{column}, Type: "string"})
+		}
+	}
+	return schema
+}
+
+// SetChecksum sets a hash.Hash (I.E. sha256.New()) that the bytes of the input are written to as
+// they are read, so the checksum of the input is computed without a second read. The bytes are
+// as read from the file or URL; for compressed input the checksum is of the compressed bytes.
+// Call SetChecksum before opening the scanner, and h.Sum after Read completes.
+func (scnr *Scanner) SetChecksum(h hash.Hash) {
+	scnr.checksum = h
+}
+
+// SetDeltaKey sets the key for Extracts with Delta: values are differenced from the previous value
+// for the same key, I.E. the unique ID, so interleaved counters from different sources are
+// differenced separately. Call SetDeltaKey before Extract when the key changes; the default is "".
+func (scnr *Scanner) SetDeltaKey(key string) {
+	scnr.deltaKey = key
+}
+
+// SetRunId sets the ID of the run (invocation) producing the output, for correlating output files,
+// logs, and SQL rows. AppendRunId appends it as a column, and when Inputs.SqlProvenance is true
+// it is the run_id provenance column.
+func (scnr *Scanner) SetRunId(runId string) {
+	scnr.runId = runId
+}
+
+// SetProgress sets a callback that Read calls after each row with the total number of bytes
+// scanned. For compressed input the count is of uncompressed bytes.
+func (scnr *Scanner) SetProgress(progress func(bytesScanned int64)) {
+	scnr.progress = progress
+}
+
+// SqlProvenanceColumns returns the names of the SQL provenance columns, which follow the VALUES of
+// SplitsToSql; none when Inputs.SqlProvenance is false. run_id is included when there is a run ID.
+func (scnr *Scanner) SqlProvenanceColumns() []string {
+	if !scnr.sqlProvenance {
+		return nil
+	}
+	columns := []string{"source_file", "ingest_time", "inputs_hash"}
+	if scnr.runId != "" {
+		columns = append(columns, "run_id")
+	}
+	return columns
+}
+
+// SqlProvenanceEnabled is true when the inputs are specifying that SQL output includes
+// provenance columns; false otherwise. See CreateTableSql.
+func (scnr *Scanner) SqlProvenanceEnabled() bool {
+	return scnr.sqlProvenance
+}
+
 // Shutdown performs an orderly shutdown on the scanner and is automatically called
 // when Read completes. Callers should call shutdown if a scanner is created but not used.
 func (scnr *Scanner) Shutdown() {
 	if scnr.file != nil {
 		scnr.file.Close()
 	}
+	if scnr.closer != nil {
+		scnr.closer.Close()
+	}
 }
 
 // Split uses the scnr.inputDelimiter to split the input data row. An error is returned if the
 // resulting number of splits is not equal to Inputs.ExpectedFieldCount. But the data is
-// returned and callers can choose to ignore the error if that is appropriate.
+// returned and callers can choose to ignore the error if that is appropriate. With the
+// FIELD_COUNT_PAD Inputs.FieldCountPolicy the data is padded or truncated to the expected count.
+// When Inputs.TrimEmptyEdgeFields is true, empty edge fields are dropped before the count is checked.
+// When Inputs.TrimQuotes is true, matching leading/trailing quotes are stripped from each field.
+// When Inputs.PadTrailingEmptyFields is true, rows with fewer fields than expected are padded
+// with empty fields, without an error, whatever the FieldCountPolicy; rows with more fields than
+// expected are still handled by the FieldCountPolicy.
+// When Inputs.InputDelimiterCandidates are used the delimiter is detected for each row.
+// When Formats are used the row is split according to the first matching Format; rows matching
+// no Format are handled according to the RouterPolicy. A nil slice and nil error mean the row was
+// dropped by the router.
 func (scnr *Scanner) Split(row string) ([]string, error) {
-	splt := scnr.inputDelimiter.Split(row, -1)
-	if len(splt) != scnr.expectedFieldCount {
-		return splt, fmt.Errorf("Split expectedFieldCount: %d, actual: %d", scnr.expectedFieldCount, len(splt))
+	inputDelimiter := scnr.inputDelimiter
+	expectedFieldCount := scnr.expectedFieldCount
+	routed := false
+	if len(scnr.formats) > 0 {
+		frmt := scnr.route(row)
+		if frmt == nil {
+			switch scnr.routerPolicy {
+			case ROUTER_DROP:
+				return nil, nil
+			case ROUTER_ERROR:
+				return nil, fmt.Errorf("Split %w: %s", ErrUnmatchedFormat, row)
+			}
+		} else {
+			inputDelimiter = frmt.inputDelimiter
+			expectedFieldCount = frmt.ExpectedFieldCount
+			routed = true
+		}
+	}
+
+	var splt []string
+	if len(scnr.inputDelimiterCandidates) > 0 && !routed {
+		splt = strings.Split(row, scnr.detectDelimiter(row))
+	} else {
+		splt = inputDelimiter.Split(row, -1)
+	}
+	if scnr.trimEmptyEdgeFields {
+		if len(splt) > 0 && splt[0] == "" {
+			splt = splt[1:]
+		}
+		if len(splt) > 0 && splt[len(splt)-1] == "" {
+			splt = splt[:len(splt)-1]
+		}
+	}
+	if scnr.trimQuotes {
+		for i := range splt {
+			splt[i] = trimQuotes(splt[i])
+		}
+	}
+	if scnr.padTrailingEmptyFields {
+		for len(splt) < expectedFieldCount {
+			splt = append(splt, "")
+		}
+	}
+	if len(splt) != expectedFieldCount {
+		if scnr.fieldCountPolicy == FIELD_COUNT_PAD {
+			actual := len(splt)
+			for len(splt) < expectedFieldCount {
+				splt = append(splt, "")
+			}
+			splt = splt[:expectedFieldCount]
+			return splt, fmt.Errorf("Split %w, expectedFieldCount: %d, actual: %d", ErrFieldCountPadded, expectedFieldCount, actual)
+		}
+		return splt, fmt.Errorf("Split expectedFieldCount: %d, actual: %d", expectedFieldCount, len(splt))
 	}
 	return splt, nil
 }
 
+// SplitAnnotated is a diagnostic for finding inconsistent delimiting. The row is returned with
+// each delimiter match, as used by Split, wrapped in "«" and "»"; I.E. "a  b" split on `\s\s+`
+// returns "a«  »b".
+func (scnr *Scanner) SplitAnnotated(row string) string {
+	inputDelimiter := scnr.inputDelimiter
+	if len(scnr.formats) > 0 {
+		if frmt := scnr.route(row); frmt != nil {
+			inputDelimiter = frmt.inputDelimiter
+		}
+	} else if len(scnr.inputDelimiterCandidates) > 0 {
+		inputDelimiter = regexp.MustCompile(regexp.QuoteMeta(scnr.detectDelimiter(row)))
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, match := range inputDelimiter.FindAllStringIndex(row, -1) {
+		sb.WriteString(row[last:match[0]])
+		sb.WriteString("«" + row[match[0]:match[1]] + "»")
+		last = match[1]
+	}
+	sb.WriteString(row[last:])
+	return sb.String()
+}
+
 // SplitsExcludeHashColumns creates a version of Split data that doesn't included the hash columns.
 // It also calculates the hash of splits and adds the hash to hashMap and hashCount
+// When Inputs.HashColumnsIndividually is true, each hash column is instead replaced by its own hash.
 func (scnr *Scanner) SplitsExcludeHashColumns(splits []string, hashFormat HashFormat) ([]string, error) {
+	if scnr.hashColumnsIndividually {
+		return scnr.splitsHashColumnsIndividually(splits, hashFormat)
+	}
+
 	// Create the hash
 	sortedHashColumns := sort.IntSlice(scnr.HashColumns)
 	hashSplits := make([]string, 0, len(sortedHashColumns))
 	for _, v := range sortedHashColumns {
-		hashSplits = append(hashSplits, splits[v])
+		if scnr.canonicalizeHashNumbers {
+			hashSplits = append(hashSplits, CanonicalizeNumber(splits[v]))
+		} else {
+			hashSplits = append(hashSplits, splits[v])
+		}
 	}
 	hashString := strings.Join(hashSplits, scnr.OutputDelimiter)
 	hash, err := Hash(hashString, hashFormat)
 	if err != nil {
 		return nil, err
 	}
+	if existing, ok := scnr.HashMap[hash]; ok && existing != hashString {
+		switch scnr.hashCollisionPolicy {
+		case HASH_COLLISION_FIRST_WINS:
+			hashString = existing
+		case HASH_COLLISION_ERROR:
+			return nil, fmt.Errorf("SplitsExcludeHashColumns %w, hash: %s, existing: %s, value: %s",
+				ErrHashCollision, hash, existing, hashString)
+		}
+	}
 	scnr.HashMap[hash] = hashString
 	scnr.HashCounts[hash] += 1
+	var messageTypeId string
+	if scnr.MessageTypeIdsEnabled() {
+		messageTypeId = scnr.messageTypeId(hash)
+	}
 
 	// Create a version of splits that doesn't included the hash columns.
 	// The idea is to substitute multiple columns with the hash.
@@ -270,7 +2090,7 @@ func (scnr *Scanner) SplitsExcludeHashColumns(splits []string, hashFormat HashFo
 	// that don't include hash columns.
 	shc := make([]int, len(sortedHashColumns))
 	copy(shc, sortedHashColumns)
-	splitsExcludeHashColumns := make([]string, 0, len(splits)-len(sortedHashColumns)+1)
+	splitsExcludeHashColumns := make([]string, 0, len(splits)-len(sortedHashColumns)+2)
 	hashInserted := false
 	for i := range splits {
 		if len(shc) > 0 {
@@ -281,6 +2101,9 @@ func (scnr *Scanner) SplitsExcludeHashColumns(splits []string, hashFormat HashFo
 				if !hashInserted {
 					hashInserted = true
 					splitsExcludeHashColumns = append(splitsExcludeHashColumns, hash)
+					if messageTypeId != "" {
+						splitsExcludeHashColumns = append(splitsExcludeHashColumns, messageTypeId)
+					}
 				}
 				shc = shc[1:]
 				continue
@@ -297,6 +2120,7 @@ func (scnr *Scanner) SplitsExcludeHashColumns(splits []string, hashFormat HashFo
 // The table should be created with nullable text columns to receive as many extracts as
 // might be produced. If the length of splits exceeds numColumns, the VALUES will be truncated.
 // splits will be padded according to Scanner.SqlQuoteColumns, all extracts are quoted.
+// When Inputs.SqlProvenance is true the provenance columns follow the numColumns of VALUES.
 func (scnr *Scanner) SplitsToSql(numColumns int, table string, splits []string, extracts []string) string {
 	out := fmt.Sprintf("INSERT OR IGNORE INTO %s VALUES(", table)
 	sliceIn := append(splits, extracts...)
@@ -320,10 +2144,92 @@ func (scnr *Scanner) SplitsToSql(numColumns int, table string, splits []string,
 		}
 		out += "," + strings.Join(pad, ",")
 	}
+	if scnr.sqlProvenance {
+		out += "," + strings.Join(scnr.provenance(), ",")
+	}
 	out += ");"
 	return out
 }
 
+// TaggedExtracts returns the values of the Extracts with an OutputTag, by OutputTag, from the last
+// call to Extract. Tags without values are not in the map; the map is nil when no Extract has an
+// OutputTag.
+func (scnr *Scanner) TaggedExtracts() map[string][]string {
+	return scnr.taggedExtracts
+}
+
+// UniqueId returns the unique ID for row from the Inputs.UniqueIdFunc, or an empty string when
+// the row has no unique ID or no UniqueIdFunc is configured.
+func (scnr *Scanner) UniqueId(row string) string {
+	if scnr.uniqueIdFunc == nil {
+		return ""
+	}
+	return scnr.uniqueIdFunc(row)
+}
+
+// UniqueIdFuncEnabled is true when Inputs.UniqueIdFunc is configured; false otherwise.
+func (scnr *Scanner) UniqueIdFuncEnabled() bool {
+	return scnr.uniqueIdFunc != nil
+}
+
+// ValidateColumns checks splits against the Inputs.ColumnAllowlists and returns a ParseError for
+// each column with a value that is not in the allowlist. Columns that are not in splits are not checked.
+func (scnr *Scanner) ValidateColumns(splits []string) []error {
+	errs := make([]error, 0)
+	for _, allowlist := range scnr.columnAllowlists {
+		if allowlist.Column >= len(splits) {
+			continue
+		}
+		if !slices.Contains(allowlist.Values, splits[allowlist.Column]) {
+			errs = append(errs, &ParseError{Column: allowlist.Column, Value: splits[allowlist.Column],
+				Message: "value not in allowlist"})
+		}
+	}
+	return errs
+}
+
+// WriteMessageTypeIds writes one line per message type ID, in order of first appearance, as
+// ID, hash, and the hashed value separated by OutputDelimiter, ending with Newline.
+func (scnr *Scanner) WriteMessageTypeIds(w io.Writer) error {
+	for _, hash := range scnr.messageTypeHashes {
+		_, err := io.WriteString(w, strings.Join([]string{scnr.MessageTypeIds[hash], hash, scnr.HashMap[hash]}, scnr.OutputDelimiter)+scnr.Newline())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CanonicalizeNumber returns a canonical form of value when it is a decimal or hexadecimal
+// integer, so semantically equal numbers compare equal. Leading zeros and a "+" sign are
+// removed from decimal integers (I.E. "003" becomes "3"), and hexadecimal integers have
+// leading zeros removed and are lower cased (I.E. "0X01A" becomes "0x1a"). Other values
+// are returned unchanged.
+func CanonicalizeNumber(value string) string {
+	if hexNumberRegex.MatchString(value) {
+		digits := strings.TrimLeft(strings.ToLower(value[2:]), "0")
+		if digits == "" {
+			digits = "0"
+		}
+		return "0x" + digits
+	}
+	if decimalNumberRegex.MatchString(value) {
+		sign := ""
+		if value[0] == '-' || value[0] == '+' {
+			if value[0] == '-' {
+				sign = "-"
+			}
+			value = value[1:]
+		}
+		digits := strings.TrimLeft(value, "0")
+		if digits == "" {
+			return "0"
+		}
+		return sign + digits
+	}
+	return value
+}
+
 // Hash returns the hex string of the MD5 hash of the input. Call this on fields where
 // values have been extracted in order to perform pareto analysis on the resulting hashes.
 // This can also be used to reduce storage space when storing in a database by replacing
@@ -365,6 +2271,57 @@ func Hash8(input string, format HashFormat) (string, error) {
 	return out, nil
 }
 
+// ForFile returns a copy of the Inputs for processing the data file at filePath. The first
+// FileFormat with a Pattern matching the file name replaces InputDelimiter and ExpectedFieldCount.
+// The Inputs are returned unchanged if no FileFormat matches.
+func (inputs Inputs) ForFile(filePath string) (Inputs, error) {
+	for _, fileFormat := range inputs.FileFormats {
+		match, err := filepath.Match(fileFormat.Pattern, filepath.Base(filePath))
+		if err != nil {
+			return inputs, err
+		}
+		if match {
+			inputs.InputDelimiter = fileFormat.InputDelimiter
+			inputs.ExpectedFieldCount = fileFormat.ExpectedFieldCount
+			return inputs, nil
+		}
+	}
+	return inputs, nil
+}
+
+// Error implements the error interface.
+func (pe *ParseError) Error() string {
+	if pe.Column < 0 {
+		return fmt.Sprintf("value: %s, %s", pe.Value, pe.Message)
+	}
+	return fmt.Sprintf("column %d, value: %s, %s", pe.Column, pe.Value, pe.Message)
+}
+
+// Hash returns the hex string of the MD5 hash of the JSON encoding of the Inputs. This is used
+// to identify the configuration used to produce output.
+func (inputs Inputs) Hash() (string, error) {
+	b, err := json.Marshal(inputs)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", md5.Sum(b)), nil
+}
+
+// MarshalResolved returns the Inputs as indented JSON, which can be reloaded with NewInputs.
+// This is used to see the Inputs that are actually in use, for debugging and reproducibility.
+func (inputs Inputs) MarshalResolved() ([]byte, error) {
+	return json.MarshalIndent(inputs, "", "    ")
+}
+
+// Newline returns the newline for Inputs.OutputNewline, "\r\n" for crlf, otherwise "\n"; the
+// value is validated by NewScanner. See Scanner.Newline.
+func (inputs Inputs) Newline() string {
+	if inputs.OutputNewline == "crlf" {
+		return "\r\n"
+	}
+	return "\n"
+}
+
 // NewInputs unmarshalls a JSON file into a new Inputs object.
 func NewInputs(filePath string) (*Inputs, error) {
 	inputBytes, err := os.ReadFile(filePath)
@@ -380,66 +2337,425 @@ func NewInputs(filePath string) (*Inputs, error) {
 	return &inputs, nil
 }
 
+// NewRateLimiter returns a RateLimiter allowing at most ratePerSecond calls to Wait per second,
+// I.E. Inputs.MaxRowsPerSecond, used to pace output to a rate limited database or API.
+func NewRateLimiter(ratePerSecond int) *RateLimiter {
+	burst := max(1, float64(ratePerSecond)*RATE_LIMITER_BURST_SECONDS)
+	return &RateLimiter{burst: burst, last: time.Now(), rate: float64(ratePerSecond), tokens: burst}
+}
+
+// Wait blocks until a token is available, then takes it. Tokens are reserved in the order Wait is
+// called, so concurrent callers are paced fairly.
+func (rl *RateLimiter) Wait() {
+	rl.mutex.Lock()
+	now := time.Now()
+	rl.tokens = min(rl.burst, rl.tokens+now.Sub(rl.last).Seconds()*rl.rate)
+	rl.last = now
+	rl.tokens--
+	tokens := rl.tokens
+	rl.mutex.Unlock()
+	if tokens < 0 {
+		time.Sleep(time.Duration(-tokens / rl.rate * float64(time.Second)))
+	}
+}
+
 // NewScanner is a constuctor for Scanners. See the Scanner definition for
 // a description of inputs.
 func NewScanner(inputs Inputs) (*Scanner, error) {
 	hashMap := make(map[string]string)
 	hashCounts := make(map[string]int)
+	messageTypeIds := make(map[string]string)
 
-	rgx, err := regexp.Compile(inputs.InputDelimiter)
+	inputDelimiter := inputs.InputDelimiter
+	if inputs.InputDelimiterLiteral {
+		inputDelimiter = regexp.QuoteMeta(inputDelimiter)
+	}
+	rgx, err := regexp.Compile(inputDelimiter)
 	if err != nil {
 		return nil, err
 	}
 	scnr := &Scanner{
-		HashColumns:        inputs.HashColumns,
-		HashCounts:         hashCounts,
-		HashMap:            hashMap,
-		OutputDelimiter:    inputs.OutputDelimiter,
-		dataDirectory:      inputs.DataDirectory,
-		inputDelimiter:     rgx,
-		expectedFieldCount: inputs.ExpectedFieldCount,
-		sqlQuoteColumns:    inputs.SqlQuoteColumns,
+		ColumnHashCounts:          make(map[int]map[string]int),
+		ColumnHashMap:             make(map[int]map[string]string),
+		HashColumns:               inputs.HashColumns,
+		canonicalizeHashNumbers:   inputs.CanonicalizeHashNumbers,
+		compressionLevel:          inputs.CompressionLevel,
+		columnAllowlists:          inputs.ColumnAllowlists,
+		HashCounts:                hashCounts,
+		HashMap:                   hashMap,
+		MessageTypeIds:            messageTypeIds,
+		OutputDelimiter:           inputs.OutputDelimiter,
+		dataDirectory:             inputs.DataDirectory,
+		dedupExtractsPerRow:       inputs.DedupExtractsPerRow,
+		deltaPrevious:             make(map[deltaPreviousKey]string),
+		inputDelimiter:            rgx,
+		inputDelimiterCandidates:  inputs.InputDelimiterCandidates,
+		expectedFieldCount:        inputs.ExpectedFieldCount,
+		extractFixedColumns:       inputs.ExtractFixedColumns,
+		fieldCountPolicy:          inputs.FieldCountPolicy,
+		hashCollisionPolicy:       inputs.HashCollisionPolicy,
+		hashColumnsIndividually:   inputs.HashColumnsIndividually,
+		ingestTimestampFormat:     inputs.IngestTimestampFormat,
+		inputCharset:              inputs.InputCharset,
+		longFieldPolicy:           inputs.LongFieldPolicy,
+		maxErrors:                 inputs.MaxErrors,
+		maxFieldLength:            inputs.MaxFieldLength,
+		messageTypeIdPrefix:       inputs.MessageTypeIdPrefix,
+		outputColumnNames:         inputs.OutputColumnNames,
+		padTrailingEmptyFields:    inputs.PadTrailingEmptyFields,
+		preProcessors:             inputs.PreProcessors,
+		prefixExtractsWithName:    inputs.PrefixExtractsWithName,
+		recordSeparator:           inputs.RecordSeparator,
+		reorderColumn:             inputs.ReorderColumn,
+		reorderTimeLayout:         inputs.ReorderTimeLayout,
+		reorderWindow:             inputs.ReorderWindow,
+		requireExtract:            inputs.RequireExtract,
+		rowId:                     inputs.RowId,
+		sqlQuoteColumns:           inputs.SqlQuoteColumns,
+		trimEmptyEdgeFields:       inputs.TrimEmptyEdgeFields,
+		trimQuotes:                inputs.TrimQuotes,
+		warnUnterminatedFinalLine: inputs.WarnUnterminatedFinalLine,
+	}
+
+	switch inputs.OutputNewline {
+	case "", "lf", "crlf":
+		scnr.newline = inputs.Newline()
+	default:
+		return nil, fmt.Errorf("OutputNewline must be lf or crlf: %s", inputs.OutputNewline)
+	}
+
+	if inputs.DedupExtractsPerRow && inputs.ExtractFixedColumns {
+		return nil, fmt.Errorf("DedupExtractsPerRow cannot be used with ExtractFixedColumns")
+	}
+	if inputs.HashColumnsIndividually {
+		if inputs.MessageTypeIdPrefix != "" {
+			return nil, fmt.Errorf("HashColumnsIndividually cannot be used with MessageTypeIdPrefix")
+		}
+		for _, column := range inputs.HashColumns {
+			scnr.ColumnHashCounts[column] = make(map[string]int)
+			scnr.ColumnHashMap[column] = make(map[string]string)
+		}
+	}
+
+	explodes := 0
+	for _, extrct := range inputs.Extracts {
+		if extrct.Explode {
+			explodes++
+		}
+	}
+	if explodes > 1 {
+		return nil, fmt.Errorf("only one Extract can Explode, found: %d", explodes)
+	}
+	// Exploded rows are from the same input row, so would have the same row ID.
+	if explodes > 0 && inputs.RowId {
+		return nil, fmt.Errorf("RowId is not valid with an Extract that can Explode")
+	}
+
+	for _, preProcessor := range inputs.PreProcessors {
+		switch preProcessor {
+		case PRE_JSON_UNESCAPE, PRE_UNESCAPE, PRE_URLDECODE:
+		default:
+			return nil, fmt.Errorf("PreProcessor is not valid: %s", preProcessor)
+		}
+	}
+	switch inputs.InputCharset {
+	case "", CHARSET_AUTO, CHARSET_LATIN1, CHARSET_UTF8:
+	default:
+		return nil, fmt.Errorf("InputCharset is not valid: %s", inputs.InputCharset)
+	}
+	switch inputs.RecordSeparator {
+	case "", RECORD_SEPARATOR_AUTO, RECORD_SEPARATOR_CR, RECORD_SEPARATOR_LF:
+	default:
+		return nil, fmt.Errorf("RecordSeparator is not valid: %q", inputs.RecordSeparator)
+	}
+	switch inputs.LongFieldPolicy {
+	case LONG_FIELD_TRUNCATE, LONG_FIELD_HASH:
+	default:
+		return nil, fmt.Errorf("LongFieldPolicy is not valid: %d", inputs.LongFieldPolicy)
+	}
+	for i, name := range inputs.OutputColumnNames {
+		if name != "" && slices.Contains(inputs.OutputColumnNames[:i], name) {
+			return nil, fmt.Errorf("OutputColumnNames is not valid, duplicate name: %s", name)
+		}
+	}
+	if inputs.ReorderWindow < 0 || inputs.ReorderWindow > 0 && (inputs.ReorderColumn < 0 || inputs.ReorderTimeLayout == "") {
+		return nil, fmt.Errorf("ReorderWindow is not valid: %d, ReorderColumn: %d, ReorderTimeLayout: %q",
+			inputs.ReorderWindow, inputs.ReorderColumn, inputs.ReorderTimeLayout)
+	}
+	// A unique ID applies to the rows following the row it is found in, which are not the
+	// following rows of the input once reordered.
+	if inputs.ReorderWindow > 0 && inputs.UniqueIdFunc != "" {
+		return nil, fmt.Errorf("ReorderWindow is not valid: %d, with UniqueIdFunc: %s", inputs.ReorderWindow, inputs.UniqueIdFunc)
+	}
+	if inputs.HashEntireRow {
+		if len(inputs.HashColumns) > 0 || inputs.HashColumnsIndividually || len(inputs.Formats) > 0 || inputs.ExpectedFieldCount <= 0 {
+			return nil, fmt.Errorf("HashEntireRow requires ExpectedFieldCount > 0, and cannot be used with HashColumns, " +
+				"HashColumnsIndividually, or Formats")
+		}
+		scnr.HashColumns = make([]int, inputs.ExpectedFieldCount)
+		for i := range scnr.HashColumns {
+			scnr.HashColumns[i] = i
+		}
+	}
+	if inputs.ScanErrorRetries < 0 {
+		return nil, fmt.Errorf("ScanErrorRetries is not valid: %d", inputs.ScanErrorRetries)
+	}
+	if inputs.MaxRowsPerSecond < 0 {
+		return nil, fmt.Errorf("MaxRowsPerSecond is not valid: %d", inputs.MaxRowsPerSecond)
+	}
+	if inputs.CompressionLevel < 0 || inputs.CompressionLevel > gzip.BestCompression {
+		return nil, fmt.Errorf("CompressionLevel must be 0 (no compression) or %d to %d: %d", gzip.BestSpeed,
+			gzip.BestCompression, inputs.CompressionLevel)
+	}
+
+	if slices.Contains(inputs.InputDelimiterCandidates, "") {
+		return nil, fmt.Errorf("InputDelimiterCandidates cannot contain an empty string")
 	}
 
-	err = scnr.setFilter(false, inputs.NegativeFilter)
+	err = scnr.setFilter(false, inputs.NegativeFilter, inputs.FilterCaseInsensitive)
 	if err != nil {
 		return nil, err
 	}
-	err = scnr.setFilter(true, inputs.PositiveFilter)
+	err = scnr.setFilter(true, inputs.PositiveFilter, inputs.FilterCaseInsensitive)
 	if err != nil {
 		return nil, err
 	}
 
+	// Replacements are copied, as the Inputs may be shared by scanners in other Go routines.
 	scnr.replace = make([]*Replacement, len(inputs.Replacements))
 	for index := range inputs.Replacements {
-		scnr.replace[index] = inputs.Replacements[index]
+		replacement := *inputs.Replacements[index]
+		scnr.replace[index] = &replacement
 		rgx, err := regexp.Compile(inputs.Replacements[index].RegexString)
 		if err != nil {
 			return nil, err
 		}
 		scnr.replace[index].regex = rgx
+		if inputs.Replacements[index].GuardRegex != "" {
+			rgx, err := regexp.Compile(inputs.Replacements[index].GuardRegex)
+			if err != nil {
+				return nil, err
+			}
+			scnr.replace[index].guardRegex = rgx
+		}
 	}
 
+	// Extracts are copied, as the Inputs may be shared by scanners in other Go routines, and are
+	// evaluated in Priority order, highest first; equal priorities in Inputs order.
 	scnr.extract = make([]*Extract, len(inputs.Extracts))
 	for index := range inputs.Extracts {
-		scnr.extract[index] = inputs.Extracts[index]
-		rgx, err := regexp.Compile(inputs.Extracts[index].RegexString)
+		extrct := *inputs.Extracts[index]
+		scnr.extract[index] = &extrct
+	}
+	slices.SortStableFunc(scnr.extract, func(a, b *Extract) int { return cmp.Compare(b.Priority, a.Priority) })
+	for index := range scnr.extract {
+		rgx, err := regexp.Compile(scnr.extract[index].RegexString)
 		if err != nil {
 			return nil, err
 		}
 		scnr.extract[index].regex = rgx
+		// The Token without references, on the scanner copy of the Extract; see checkExtractOverlap.
+		scnr.extract[index].tokenLiteral = tokenReferenceRegex.ReplaceAllString(scnr.extract[index].Token, "")
+		name := scnr.extractName(index)
+		coverage := make([]ExtractCoverage, len(scnr.extract[index].Columns))
+		for ec, column := range scnr.extract[index].Columns {
+			coverage[ec] = ExtractCoverage{Column: column, Extract: name}
+		}
+		if scnr.extract[index].FullRow {
+			if scnr.extract[index].RegexString == "" || scnr.extract[index].Json || scnr.extract[index].Between != [2]string{} {
+				return nil, fmt.Errorf("Extract FullRow requires RegexString, without Json or Between")
+			}
+			coverage = []ExtractCoverage{{Column: -1, Extract: name}}
+		}
+		scnr.extractCoverage = append(scnr.extractCoverage, coverage)
+		switch scnr.extract[index].Normalizer {
+		case "", NORM_DURATION_NS, NORM_TIMESTAMP:
+		case NORM_CIDR:
+			if scnr.extract[index].Delta || scnr.extract[index].Type != EXTRACT_TYPE_STRING {
+				return nil, fmt.Errorf("Extract Normalizer %s cannot be used with Delta, or Type: %s", NORM_CIDR,
+					scnr.extract[index].Type)
+			}
+		default:
+			return nil, fmt.Errorf("Extract Normalizer is not valid: %s", scnr.extract[index].Normalizer)
+		}
+		if (scnr.extract[index].TimestampLayout != "" || scnr.extract[index].TimestampFormat != "") &&
+			scnr.extract[index].Normalizer != NORM_TIMESTAMP {
+			return nil, fmt.Errorf("Extract TimestampLayout and TimestampFormat require Normalizer %s", NORM_TIMESTAMP)
+		}
+		if mask := scnr.extract[index].Mask; mask != "" && mask != MASK_KEEP_LAST || scnr.extract[index].MaskKeepLast < 0 {
+			return nil, fmt.Errorf("Extract Mask is not valid: %s, MaskKeepLast: %d", mask, scnr.extract[index].MaskKeepLast)
+		}
+		switch scnr.extract[index].Type {
+		case EXTRACT_TYPE_BOOL, EXTRACT_TYPE_NUMBER, EXTRACT_TYPE_STRING:
+		default:
+			return nil, fmt.Errorf("Extract Type is not valid: %s", scnr.extract[index].Type)
+		}
+		switch jsonType := scnr.extract[index].JsonType; jsonType {
+		case EXTRACT_TYPE_BOOL, EXTRACT_TYPE_NUMBER, EXTRACT_TYPE_STRING:
+			if jsonType != EXTRACT_TYPE_STRING && scnr.extract[index].Type != EXTRACT_TYPE_STRING {
+				return nil, fmt.Errorf("Extract JsonType cannot be used with Type: %s", scnr.extract[index].Type)
+			}
+		default:
+			return nil, fmt.Errorf("Extract JsonType is not valid: %s", jsonType)
+		}
+		if len(scnr.extract[index].JsonKeys) > 0 && !scnr.extract[index].Json {
+			return nil, fmt.Errorf("Extract JsonKeys requires Json")
+		}
+		if between := scnr.extract[index].Between; between != [2]string{} && (between[0] == "" || between[1] == "") {
+			return nil, fmt.Errorf("Extract Between requires start and end markers: %q", between)
+		}
+		if tag := scnr.extract[index].OutputTag; tag != "" {
+			if !outputTagRegex.MatchString(tag) || scnr.extract[index].Explode {
+				return nil, fmt.Errorf("Extract OutputTag is not valid: %q, it must be letters, numbers, _, or -, "+
+					"and cannot be used with Explode", tag)
+			}
+			if !slices.Contains(scnr.outputTags, tag) {
+				scnr.outputTags = append(scnr.outputTags, tag)
+			}
+		}
+		if dflt := scnr.extract[index].Default; dflt != "" {
+			if _, _, err := coerceExtract(dflt, scnr.extract[index].Type); err != nil {
+				return nil, fmt.Errorf("Extract Default: %s, is %s", dflt, err)
+			}
+		}
+	}
+	slices.Sort(scnr.outputTags)
+	if inputs.ExtractCacheSize > 0 {
+		if slices.ContainsFunc(scnr.extract, func(extrct *Extract) bool { return extrct.Delta }) {
+			return nil, fmt.Errorf("Extract Delta cannot be used with ExtractCacheSize")
+		}
+		scnr.extractCache = newExtractCache(inputs.ExtractCacheSize, scnr.extract)
+	}
+
+	// Formats are copied, as the Inputs may be shared by scanners in other Go routines.
+	scnr.formats = make([]*Format, len(inputs.Formats))
+	for index := range inputs.Formats {
+		format := *inputs.Formats[index]
+		scnr.formats[index] = &format
+		rgx, err := regexp.Compile(inputs.Formats[index].InputDelimiter)
+		if err != nil {
+			return nil, err
+		}
+		scnr.formats[index].inputDelimiter = rgx
+		rgx, err = regexp.Compile(inputs.Formats[index].MatchRegex)
+		if err != nil {
+			return nil, err
+		}
+		scnr.formats[index].matchRegex = rgx
+		if inputs.RouterDefaultFormat != "" && inputs.Formats[index].Name == inputs.RouterDefaultFormat {
+			scnr.routerDefaultFormat = scnr.formats[index]
+		}
+	}
+	if inputs.RouterDefaultFormat != "" && scnr.routerDefaultFormat == nil {
+		return nil, fmt.Errorf("RouterDefaultFormat does not name a Format: %s", inputs.RouterDefaultFormat)
+	}
+	scnr.routerPolicy = inputs.RouterPolicy
+
+	if inputs.UniqueIdFunc != "" {
+		uniqueIdFuncsMutex.RLock()
+		scnr.uniqueIdFunc = uniqueIdFuncs[inputs.UniqueIdFunc]
+		uniqueIdFuncsMutex.RUnlock()
+		if scnr.uniqueIdFunc == nil {
+			return nil, fmt.Errorf("UniqueIdFunc is not registered: %s", inputs.UniqueIdFunc)
+		}
+	}
+
+	if inputs.SqlProvenance {
+		scnr.sqlProvenance = true
+		scnr.inputsHash, err = inputs.Hash()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if _, err := os.Stat(inputs.ProcessedInputDirectory); inputs.ProcessedInputDirectory != "" && os.IsNotExist(err) {
 		return nil, fmt.Errorf("processedInputDirectory does not exist, error: %+v", err)
 	}
+	// Files moved to a ProcessedInputDirectory in the DataDirectory would be processed again, forever.
+	if inputs.ProcessedInputDirectory != "" && inputs.DataDirectory != "" &&
+		directoryWithin(inputs.ProcessedInputDirectory, inputs.DataDirectory) {
+		return nil, fmt.Errorf("ProcessedInputDirectory is not valid: %s, it is the DataDirectory, or inside the DataDirectory: %s",
+			inputs.ProcessedInputDirectory, inputs.DataDirectory)
+	}
 	scnr.processedInputDirectory = inputs.ProcessedInputDirectory
 
 	return scnr, nil
 }
 
+// ReadHashes reads hashes written by WriteHashes and merges them into hashCounts and hashMap;
+// counts are added to any existing counts. This allows hash counts to accumulate across runs.
+func ReadHashes(r io.Reader, delimiter string, hashCounts map[string]int, hashMap map[string]string) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, hashesLineSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		// The value is last as it may contain the delimiter.
+		fields := strings.SplitN(line, delimiter, 3)
+		if len(fields) != 3 {
+			return fmt.Errorf("ReadHashes invalid line: %s", line)
+		}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return fmt.Errorf("ReadHashes invalid count, line: %s, error: %+v", line, err)
+		}
+		hashCounts[fields[0]] += count
+		hashMap[fields[0]] = fields[2]
+	}
+	return scanner.Err()
+}
+
+// MergeHashFiles merges the hashes files (written by WriteHashes with a "|" delimiter) at paths,
+// I.E. from runs on different machines, into one hashes file at output, summing the counts for
+// each hash. Files are read a line at a time, so only the distinct hashes are held in memory. The
+// output is sorted by count, as written by WriteHashes.
+func MergeHashFiles(paths []string, output string) error {
+	hashCounts := make(map[string]int)
+	hashMap := make(map[string]string)
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = ReadHashes(file, "|", hashCounts, hashMap)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("MergeHashFiles file: %s, error: %w", path, err)
+		}
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := WriteHashes(w, "|", "\n", hashCounts, hashMap); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// RegisterUniqueIdFunc registers fn, by name, for use as Inputs.UniqueIdFunc, for when deriving
+// the unique ID needs logic (I.E. combining fields, decoding) rather than a single regex capture.
+// fn returns the unique ID for a row, or an empty string when the row has no unique ID.
+// Registering a name again replaces the function. Functions must be registered before NewScanner
+// is called.
+func RegisterUniqueIdFunc(name string, fn func(row string) string) {
+	uniqueIdFuncsMutex.Lock()
+	defer uniqueIdFuncsMutex.Unlock()
+	uniqueIdFuncs[name] = fn
+}
+
 // Convenience function to sort a map of hashes based on counts. Used to help develop
-// extracts and hashes in order to reduce the total number of hashes.
+// extracts and hashes in order to reduce the total number of hashes. Hashes with equal
+// counts are sorted by hash so the order is repeatable.
 func SortedHashMapCounts(inputMap map[string]int) []string {
 	hashes := make([]string, 0, len(inputMap))
 
@@ -447,23 +2763,718 @@ func SortedHashMapCounts(inputMap map[string]int) []string {
 		hashes = append(hashes, hash)
 	}
 	sort.SliceStable(hashes, func(i, j int) bool {
+		if inputMap[hashes[i]] == inputMap[hashes[j]] {
+			return hashes[i] < hashes[j]
+		}
 		return inputMap[hashes[i]] > inputMap[hashes[j]]
 	})
 
 	return hashes
 }
 
+// VerifyHashes reads hashes written by WriteHashValues or WriteHashes, with a "|" delimiter,
+// recomputes the hash of each value with format and algo, and returns a description of each line
+// where the computed hash does not match the stored hash. This detects corruption, or hashes
+// created with a different format or algorithm. An error is returned for lines that cannot be read.
+func VerifyHashes(r io.Reader, format HashFormat, algo HashAlgorithm) ([]string, error) {
+	var mismatches []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, hashesLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if scanner.Text() == "" {
+			continue
+		}
+		hash, value, ok := strings.Cut(scanner.Text(), "|")
+		if !ok {
+			return mismatches, fmt.Errorf("VerifyHashes invalid line %d: %s", line, scanner.Text())
+		}
+		computed, err := verifyHash(value, format, algo)
+		if err != nil {
+			return mismatches, err
+		}
+		// Lines written by WriteHashes have a count before the value; the value may contain the
+		// delimiter, so the count is only skipped when the hash does not match the whole value.
+		if count, countValue, ok := strings.Cut(value, "|"); computed != hash && ok {
+			if _, err := strconv.Atoi(count); err == nil {
+				value = countValue
+				if computed, err = verifyHash(value, format, algo); err != nil {
+					return mismatches, err
+				}
+			}
+		}
+		if computed != hash {
+			mismatches = append(mismatches, fmt.Sprintf("line: %d, hash: %s, computed: %s, value: %s",
+				line, hash, computed, value))
+		}
+	}
+	return mismatches, scanner.Err()
+}
+
+// WriteHashValues writes one line per hash, sorted by count, as hash and value separated by
+// delimiter, without the counts, ending each line with newline (I.E. Scanner.Newline). This is the
+// default layout of the hashes output file.
+func WriteHashValues(w io.Writer, delimiter string, newline string, hashCounts map[string]int, hashMap map[string]string) error {
+	for _, hash := range SortedHashMapCounts(hashCounts) {
+		_, err := io.WriteString(w, strings.Join([]string{hash, hashMap[hash]}, delimiter)+newline)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteHashes writes one line per hash, sorted by count, as hash, count, and value separated
+// by delimiter, ending each line with newline (I.E. Scanner.Newline). The output can be read back
+// with ReadHashes.
+func WriteHashes(w io.Writer, delimiter string, newline string, hashCounts map[string]int, hashMap map[string]string) error {
+	for _, hash := range SortedHashMapCounts(hashCounts) {
+		_, err := io.WriteString(w, strings.Join([]string{hash, strconv.Itoa(hashCounts[hash]), hashMap[hash]}, delimiter)+newline)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Format implements RowFormatter.
+func (cf CsvFormatter) Format(uniqueId string, splits, extracts []string, hash string) string {
+	record := make([]string, 0, len(splits)+len(extracts)+1)
+	record = append(record, uniqueId)
+	record = append(record, splits...)
+	record = append(record, extracts...)
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	w.Write(record)
+	w.Flush()
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Format implements RowFormatter.
+func (df DelimitedFormatter) Format(uniqueId string, splits, extracts []string, hash string) string {
+	return uniqueId + df.Delimiter + strings.Join(splits, df.Delimiter) + "|EXTRACTS|" + strings.Join(extracts, df.Delimiter)
+}
+
+// Format implements RowFormatter.
+func (nf NdjsonFormatter) Format(uniqueId string, splits, extracts []string, hash string) string {
+	var extractTypes []string
+	if nf.Scanner != nil {
+		extractTypes = nf.Scanner.ExtractTypes()
+	}
+	typedExtracts := make([]any, len(extracts))
+	for i, extract := range extracts {
+		typedExtracts[i] = extract
+		if i >= len(extractTypes) {
+			continue
+		}
+		switch extractTypes[i] {
+		case EXTRACT_TYPE_BOOL:
+			typedExtracts[i] = extract == "true"
+		case EXTRACT_TYPE_NUMBER:
+			typedExtracts[i] = json.Number(extract)
+		}
+	}
+	if len(nf.ColumnNames) > 0 {
+		row := struct {
+			UniqueId string `json:",omitempty"`
+			Hash     string `json:",omitempty"`
+			Columns  json.RawMessage
+			Extracts []any
+		}{uniqueId, hash, namedColumnsJson(nf.ColumnNames, splits), typedExtracts}
+		// Marshalling cannot fail; numbers are validated by Extract.
+		b, _ := json.Marshal(row)
+		return string(b)
+	}
+	row := struct {
+		UniqueId string `json:",omitempty"`
+		Hash     string `json:",omitempty"`
+		Splits   []string
+		Extracts []any
+	}{uniqueId, hash, splits, typedExtracts}
+	// Marshalling cannot fail; numbers are validated by Extract.
+	b, _ := json.Marshal(row)
+	return string(b)
+}
+
+// maskKeepLast returns value with all but the last keep characters replaced with MASK_CHARACTER.
+func maskKeepLast(value string, keep int) string {
+	runes := []rune(value)
+	if len(runes) <= keep {
+		return value
+	}
+	return strings.Repeat(MASK_CHARACTER, len(runes)-keep) + string(runes[len(runes)-keep:])
+}
+
+// namedColumnsJson returns a JSON object of splits keyed by names, in order; a map would be
+// output in key order. Splits without a name are keyed by "column" and the index.
+func namedColumnsJson(names []string, splits []string) json.RawMessage {
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i, split := range splits {
+		name := fmt.Sprintf("column%d", i)
+		if i < len(names) {
+			name = names[i]
+		}
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		key, _ := json.Marshal(name)
+		value, _ := json.Marshal(split)
+		sb.Write(key)
+		sb.WriteString(":")
+		sb.Write(value)
+	}
+	sb.WriteString("}")
+	return json.RawMessage(sb.String())
+}
+
+// Format implements RowFormatter.
+func (sf SqlFormatter) Format(uniqueId string, splits, extracts []string, hash string) string {
+	if uniqueId != "" {
+		splits = append([]string{uniqueId}, splits...)
+	}
+	return sf.Scanner.SplitsToSql(sf.Columns, sf.Table, splits, extracts)
+}
+
+// coerceExtract coerces value to extractType, returning the coerced value and its type. When
+// the value cannot be coerced, it is returned unchanged as EXTRACT_TYPE_STRING with an error.
+func coerceExtract(value string, extractType string) (string, string, error) {
+	switch extractType {
+	case EXTRACT_TYPE_BOOL:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return value, EXTRACT_TYPE_STRING, fmt.Errorf("not a %s", EXTRACT_TYPE_BOOL)
+		}
+		return strconv.FormatBool(b), EXTRACT_TYPE_BOOL, nil
+	case EXTRACT_TYPE_NUMBER:
+		if jsonNumberRegex.MatchString(value) {
+			return value, EXTRACT_TYPE_NUMBER, nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return value, EXTRACT_TYPE_STRING, fmt.Errorf("not a %s", EXTRACT_TYPE_NUMBER)
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), EXTRACT_TYPE_NUMBER, nil
+	}
+	return value, EXTRACT_TYPE_STRING, nil
+}
+
+// jsonExtractType returns jsonType when value is a JSON number (EXTRACT_TYPE_NUMBER) or true/false
+// (EXTRACT_TYPE_BOOL), as the NdjsonFormatter outputs the value unchanged; otherwise EXTRACT_TYPE_STRING.
+func jsonExtractType(value string, jsonType string) string {
+	switch {
+	case jsonType == EXTRACT_TYPE_NUMBER && jsonNumberRegex.MatchString(value),
+		jsonType == EXTRACT_TYPE_BOOL && (value == "true" || value == "false"):
+		return jsonType
+	}
+	return EXTRACT_TYPE_STRING
+}
+
+// directoryWithin is true when directory is parent, or is inside parent. Paths are compared after
+// making them absolute and resolving symbolic links, when the directories exist.
+func directoryWithin(directory string, parent string) bool {
+	resolve := func(path string) string {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		return path
+	}
+	directory, parent = resolve(directory), resolve(parent)
+	if directoryInfo, err := os.Stat(directory); err == nil {
+		if parentInfo, err := os.Stat(parent); err == nil && os.SameFile(directoryInfo, parentInfo) {
+			return true
+		}
+	}
+	rel, err := filepath.Rel(parent, directory)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// gunzipReader returns a reader that decompresses r when r is gzip compressed, detected by
+// checking for the gzip magic number, otherwise a reader of r.
+func gunzipReader(r io.Reader) (io.Reader, error) {
+	reader := bufio.NewReader(r)
+	magic, _ := reader.Peek(2)
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(reader)
+	}
+	return reader, nil
+}
+
+// detectRecordSeparator returns RECORD_SEPARATOR_CR when the first line terminator in data is a
+// "\r" not followed by "\n", and otherwise RECORD_SEPARATOR_LF. ok is false when more data is
+// needed to decide.
+func detectRecordSeparator(data []byte, atEOF bool) (separator string, ok bool) {
+	i := bytes.IndexAny(data, "\r\n")
+	switch {
+	case i == -1 || (data[i] == '\r' && i == len(data)-1):
+		if !atEOF {
+			return "", false
+		}
+		if i == -1 {
+			return RECORD_SEPARATOR_LF, true
+		}
+		return RECORD_SEPARATOR_CR, true
+	case data[i] == '\r' && data[i+1] != '\n':
+		return RECORD_SEPARATOR_CR, true
+	}
+	return RECORD_SEPARATOR_LF, true
+}
+
+// scannerError is true when err is from a bufio.Scanner itself (I.E. bufio.ErrTooLong), rather than
+// from reading the input; these errors occur every time the input is read.
+func scannerError(err error) bool {
+	return errors.Is(err, bufio.ErrTooLong) || errors.Is(err, bufio.ErrNegativeAdvance) ||
+		errors.Is(err, bufio.ErrAdvanceTooFar) || errors.Is(err, bufio.ErrBadReadCount)
+}
+
+// scanCrLines is a bufio.SplitFunc like bufio.ScanLines, for lines terminated by a lone "\r".
+func scanCrLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\r'); i >= 0 {
+		return i + 1, data[0:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
 // dateTimeToUnixEpoch is used to convert strings that match DATE_TIME_REGEX into Unix epoch
 func dateTimeToUnixEpoch(input []byte) []byte {
 	t, _ := time.Parse(time.DateTime, string(input))
 	return []byte(fmt.Sprint(t.Unix()))
 }
 
+// cidrNames returns the names of the network address and prefix length values of a NORM_CIDR
+// Extract: name and "network" or "prefix" separated by a period, or without name when it is empty.
+func cidrNames(name string) []string {
+	if name == "" {
+		return []string{"network", "prefix"}
+	}
+	return []string{name + ".network", name + ".prefix"}
+}
+
+// normalizeCidr returns the canonical network address and the prefix length of value, which is in
+// CIDR notation; see NORM_CIDR.
+func normalizeCidr(value string) (string, string, error) {
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return "", "", err
+	}
+	return prefix.Masked().Addr().String(), strconv.Itoa(prefix.Bits()), nil
+}
+
+// normalizeTimestamp parses value with layout, or the timestampLayouts when layout is empty, and
+// returns the timestamp in format; see NORM_TIMESTAMP.
+func normalizeTimestamp(value string, layout string, format string) (string, error) {
+	layouts := timestampLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	var t time.Time
+	var err error
+	for _, l := range layouts {
+		if t, err = time.Parse(l, value); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return value, err
+	}
+	if format == "" || format == TIMESTAMP_FORMAT_EPOCH {
+		return strconv.FormatInt(t.Unix(), 10), nil
+	}
+	return t.UTC().Format(format), nil
+}
+
+// latin1ToUtf8 decodes s, which is ISO-8859-1 encoded, to UTF-8. Each byte is the code point.
+func latin1ToUtf8(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		sb.WriteRune(rune(s[i]))
+	}
+	return sb.String()
+}
+
+// jsonUnescape decodes the JSON string escapes in s. Unescaped quotes and control characters,
+// which are not valid in a JSON string, are left unchanged.
+func jsonUnescape(s string) (string, error) {
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	escaped := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted.WriteByte('\\')
+		case s[i] < 0x20:
+			fmt.Fprintf(&quoted, "\\u%04x", s[i])
+			continue
+		}
+		quoted.WriteByte(s[i])
+	}
+	quoted.WriteByte('"')
+	var unescaped string
+	err := json.Unmarshal([]byte(quoted.String()), &unescaped)
+	return unescaped, err
+}
+
+// verifyHash returns the hash of value with format and algo, for VerifyHashes.
+func verifyHash(value string, format HashFormat, algo HashAlgorithm) (string, error) {
+	switch algo {
+	case HASH_ALGORITHM_MD5:
+		return Hash(value, format)
+	case HASH_ALGORITHM_DJB2:
+		return Hash8(value, format)
+	default:
+		return "", fmt.Errorf("VerifyHashes invalid HashAlgorithm: %d", algo)
+	}
+}
+
+// validUtf8Prefix is true when b is valid UTF-8, except for an incomplete rune at the end.
+func validUtf8Prefix(b []byte) bool {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			return !utf8.FullRune(b[i:]) && utf8.Valid(b[:i])
+		}
+	}
+	return false
+}
+
+// replaceSpans returns s with each of the spans, start and end offsets in order, replaced by token.
+func replaceSpans(s string, spans [][2]int, token string) string {
+	// Replace from the end so earlier offsets remain valid.
+	for i := len(spans) - 1; i >= 0; i-- {
+		s = s[:spans[i][0]] + token + s[spans[i][1]:]
+	}
+	return s
+}
+
+// trimQuotes returns field without the leading and trailing quote when field starts and ends
+// with the same quote character (" or '); otherwise field is returned unchanged.
+func trimQuotes(field string) string {
+	if len(field) >= 2 && (field[0] == '"' || field[0] == '\'') && field[len(field)-1] == field[0] {
+		return field[1 : len(field)-1]
+	}
+	return field
+}
+
+// unescape decodes the Go/C style backslash escapes in s; see strconv.UnquoteChar.
+func unescape(s string) (string, error) {
+	var unescaped strings.Builder
+	for len(s) > 0 {
+		if s[0] != '\\' {
+			_, size := utf8.DecodeRuneInString(s)
+			unescaped.WriteString(s[:size])
+			s = s[size:]
+			continue
+		}
+		if strings.HasPrefix(s, `\'`) {
+			unescaped.WriteByte('\'')
+			s = s[2:]
+			continue
+		}
+		value, multibyte, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return "", err
+		}
+		if multibyte {
+			unescaped.WriteRune(value)
+		} else {
+			unescaped.WriteByte(byte(value))
+		}
+		s = tail
+	}
+	return unescaped.String(), nil
+}
+
+// newExtractCache returns an extractCache holding at most size entries, for extracts.
+func newExtractCache(size int, extracts []*Extract) *extractCache {
+	var columns []int
+	allColumns := false
+	for _, extrct := range extracts {
+		allColumns = allColumns || extrct.FullRow
+		for _, column := range extrct.Columns {
+			if !slices.Contains(columns, column) {
+				columns = append(columns, column)
+			}
+		}
+	}
+	slices.Sort(columns)
+	return &extractCache{allColumns: allColumns, columns: columns, entries: make(map[string]*list.Element), order: list.New(), size: size}
+}
+
+// get returns the entry for key, and marks it most recently used, or nil when key is not cached.
+func (cache *extractCache) get(key string) *extractCacheEntry {
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil
+	}
+	cache.order.MoveToFront(element)
+	return element.Value.(*extractCacheEntry)
+}
+
+// key returns the cache key for row: the length and value of each of the cache columns, so the
+// key is unique for any values. Columns not in row are marked, as Extract skips them.
+func (cache *extractCache) key(row []string) string {
+	var sb strings.Builder
+	if cache.allColumns {
+		sb.WriteString(strconv.Itoa(len(row)))
+		sb.WriteString(";")
+	}
+	for _, column := range cache.rowColumns(row) {
+		if column >= len(row) {
+			sb.WriteString("-;")
+			continue
+		}
+		sb.WriteString(strconv.Itoa(len(row[column])))
+		sb.WriteString(":")
+		sb.WriteString(row[column])
+	}
+	return sb.String()
+}
+
+// rowColumns returns the cache columns for row: all columns of row when allColumns is true.
+func (cache *extractCache) rowColumns(row []string) []int {
+	if !cache.allColumns {
+		return cache.columns
+	}
+	columns := make([]int, len(row))
+	for i := range columns {
+		columns[i] = i
+	}
+	return columns
+}
+
+// put adds entry for key, evicting the least recently used entry when the cache is full.
+func (cache *extractCache) put(key string, entry *extractCacheEntry) {
+	entry.key = key
+	cache.entries[key] = cache.order.PushFront(entry)
+	if cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*extractCacheEntry).key)
+	}
+}
+
+// findBetween returns the start and end offsets of each start marker, the text following it,
+// and the next end marker, in s. Markers are not nested; searching resumes after the end marker.
+func findBetween(s, start, end string) [][2]int {
+	var spans [][2]int
+	for offset := 0; offset < len(s); {
+		open := strings.Index(s[offset:], start)
+		if open < 0 {
+			break
+		}
+		open += offset
+		closing := strings.Index(s[open+len(start):], end)
+		if closing < 0 {
+			break
+		}
+		closing += open + len(start) + len(end)
+		spans = append(spans, [2]int{open, closing})
+		offset = closing
+	}
+	return spans
+}
+
+// findJsonObjects returns the start and end offsets of the JSON objects embedded in s. Braces are
+// balanced, ignoring braces in JSON strings, so nested objects are part of the enclosing object.
+// Balanced text that is not valid JSON is skipped, and searching resumes after its opening brace.
+func findJsonObjects(s string) [][2]int {
+	var objects [][2]int
+	for start := 0; start < len(s); {
+		open := strings.IndexByte(s[start:], '{')
+		if open < 0 {
+			break
+		}
+		open += start
+		end := balancedBraceEnd(s, open)
+		if end > 0 && json.Valid([]byte(s[open:end])) {
+			objects = append(objects, [2]int{open, end})
+			start = end
+			continue
+		}
+		start = open + 1
+	}
+	return objects
+}
+
+// balancedBraceEnd returns the offset after the brace that closes the brace at s[open], or -1
+// if the brace is not closed.
+func balancedBraceEnd(s string, open int) int {
+	depth := 0
+	inString := false
+	escaped := false
+	for i := open; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			inString = !inString
+		case inString:
+		case s[i] == '{':
+			depth++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// jsonValueString returns JSON strings unquoted, and other JSON values as compact JSON.
+func jsonValueString(value json.RawMessage) string {
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		return str
+	}
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, value); err != nil {
+		return string(value)
+	}
+	return buffer.String()
+}
+
+// empty is true for Extracts that just have comments.
+func (extrct *Extract) empty() bool {
+	return extrct.RegexString == "" && !extrct.Json && extrct.Between == [2]string{}
+}
+
+// add records that the Extract at index inserted its Token into column.
+func (tokens extractTokens) add(index int, column int) {
+	if !slices.Contains(tokens[column], index) {
+		tokens[column] = append(tokens[column], index)
+	}
+}
+
+// jsonKeyName returns the name of values of a JsonKeys key: the Extract Name and key
+// separated by a period (I.E. "error.code"), or the key if there is no Name.
+func (extrct *Extract) jsonKeyName(key string) string {
+	if extrct.Name == "" {
+		return key
+	}
+	return extrct.Name + "." + key
+}
+
+// checksumReader returns a reader that writes the bytes read from r to the checksum hash, or
+// r when there is no checksum; see SetChecksum.
+func (scnr *Scanner) checksumReader(r io.Reader) io.Reader {
+	if scnr.checksum == nil {
+		return r
+	}
+	return io.TeeReader(r, scnr.checksum)
+}
+
+// detectDelimiter returns the first inputDelimiterCandidates value that splits the row into
+// expectedFieldCount fields, or the candidate occurring most in the row if none do.
+func (scnr *Scanner) detectDelimiter(row string) string {
+	best := scnr.inputDelimiterCandidates[0]
+	bestCount := -1
+	for _, candidate := range scnr.inputDelimiterCandidates {
+		count := strings.Count(row, candidate)
+		if count+1 == scnr.expectedFieldCount {
+			return candidate
+		}
+		if count > bestCount {
+			best = candidate
+			bestCount = count
+		}
+	}
+	return best
+}
+
+// messageTypeId returns the message type ID for the hash, assigning the next sequential ID
+// if the hash has not been seen before.
+func (scnr *Scanner) messageTypeId(hash string) string {
+	if id, ok := scnr.MessageTypeIds[hash]; ok {
+		return id
+	}
+	scnr.messageTypeHashes = append(scnr.messageTypeHashes, hash)
+	id := fmt.Sprintf("%s%04d", scnr.messageTypeIdPrefix, len(scnr.messageTypeHashes))
+	scnr.MessageTypeIds[hash] = id
+	return id
+}
+
+// provenance returns the quoted SQL values for the provenance columns.
+func (scnr *Scanner) provenance() []string {
+	values := []string{
+		fmt.Sprintf("'%s'", strings.ReplaceAll(scnr.sourceFile, "'", "''")),
+		fmt.Sprintf("'%s'", scnr.ingestTime.Format(time.RFC3339)),
+		fmt.Sprintf("'%s'", scnr.inputsHash),
+	}
+	if scnr.runId != "" {
+		values = append(values, fmt.Sprintf("'%s'", strings.ReplaceAll(scnr.runId, "'", "''")))
+	}
+	return values
+}
+
+// splitsHashColumnsIndividually returns a copy of splits with each hash column replaced by the
+// hash of its value. Each hash is added to HashMap and HashCounts, and to the ColumnHashMap and
+// ColumnHashCounts for the column.
+func (scnr *Scanner) splitsHashColumnsIndividually(splits []string, hashFormat HashFormat) ([]string, error) {
+	hashedSplits := slices.Clone(splits)
+	for _, column := range scnr.HashColumns {
+		value := splits[column]
+		if scnr.canonicalizeHashNumbers {
+			value = CanonicalizeNumber(value)
+		}
+		hash, err := Hash(value, hashFormat)
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := scnr.HashMap[hash]; ok && existing != value {
+			switch scnr.hashCollisionPolicy {
+			case HASH_COLLISION_FIRST_WINS:
+				value = existing
+			case HASH_COLLISION_ERROR:
+				return nil, fmt.Errorf("SplitsExcludeHashColumns %w, hash: %s, existing: %s, value: %s",
+					ErrHashCollision, hash, existing, value)
+			}
+		}
+		scnr.HashMap[hash] = value
+		scnr.HashCounts[hash] += 1
+		scnr.ColumnHashMap[column][hash] = value
+		scnr.ColumnHashCounts[column][hash] += 1
+		hashedSplits[column] = hash
+	}
+	return hashedSplits, nil
+}
+
+// route returns the first Format whose MatchRegex matches the row, the routerDefaultFormat
+// if no Format matches, or nil if there is no routerDefaultFormat.
+func (scnr *Scanner) route(row string) *Format {
+	for _, frmt := range scnr.formats {
+		if frmt.matchRegex.MatchString(row) {
+			return frmt
+		}
+	}
+	return scnr.routerDefaultFormat
+}
+
 // setFilter is a convenience function to set the Scanner filters from inputs.
-func (scnr *Scanner) setFilter(positive bool, regex string) error {
+// When caseInsensitive is true the regex is compiled with the case-insensitive flag.
+func (scnr *Scanner) setFilter(positive bool, regex string, caseInsensitive bool) error {
 	if regex == "" {
 		return nil
 	}
+	if caseInsensitive {
+		regex = "(?i)" + regex
+	}
 
 	rgx, err := regexp.Compile(regex)
 	if err != nil {
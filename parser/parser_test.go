@@ -5,12 +5,23 @@
 package parser
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 var (
@@ -87,6 +98,239 @@ func ExampleScanner_Read() {
 	// 2023-10-07 12:00:00.02 MDT  1         002       status        info           alphanumeric value  sw_a          Message with alphanumberic value abc123def
 }
 
+// TestScanner_Read_reorderWindow verifies rows that are out of order by less than the ReorderWindow
+// are read in timestamp order, that a row without a timestamp stays with the previous row, and
+// that a row out of order by more than the window is not reordered.
+func TestScanner_Read_reorderWindow(t *testing.T) {
+	input := []string{"12:00:01|a", "12:00:03|b", "12:00:02|c", "12:00:04|d", "continued|e", "12:00:06|f",
+		"12:00:05|g", "12:00:07|h", "12:00:09|i", "12:00:08|j", "12:00:00|late", "12:00:10|k"}
+	expected := []string{"12:00:01|a", "12:00:02|c", "12:00:03|b", "12:00:04|d", "continued|e", "12:00:05|g",
+		"12:00:06|f", "12:00:00|late", "12:00:07|h", "12:00:08|j", "12:00:09|i", "12:00:10|k"}
+	inputs := Inputs{ExpectedFieldCount: 2, InputDelimiter: `\|`, ReorderColumn: 0, ReorderTimeLayout: "15:04:05",
+		ReorderWindow: 3}
+	scnr, err := NewScanner(inputs)
+	if err != nil {
+		t.Fatalf("calling NewScanner: %s", err)
+	}
+	scnr.OpenIoReaderScanner(strings.NewReader(strings.Join(input, "\n")))
+	dataChan, errorChan := scnr.Read(100, 100)
+	var rows []string
+	for row := range dataChan {
+		rows = append(rows, row)
+	}
+	for err := range errorChan {
+		t.Errorf("calling Read: %s", err)
+	}
+	if !slices.Equal(rows, expected) {
+		t.Errorf("\nrows:     %q\nexpected: %q", rows, expected)
+	}
+
+	inputs.UniqueIdFunc = "reorderWindow"
+	RegisterUniqueIdFunc(inputs.UniqueIdFunc, func(row string) string { return "" })
+	if _, err := NewScanner(inputs); err == nil {
+		t.Errorf("expected ReorderWindow error with UniqueIdFunc")
+	}
+	inputs.UniqueIdFunc = ""
+	inputs.ReorderTimeLayout = ""
+	if _, err := NewScanner(inputs); err == nil {
+		t.Errorf("expected ReorderWindow error")
+	}
+}
+
+// TestScanner_Read_unterminatedFinalLine verifies a final line without a trailing newline is read,
+// and ErrUnterminatedFinalLine is sent only when the final line is unterminated and
+// WarnUnterminatedFinalLine is true.
+func TestScanner_Read_unterminatedFinalLine(t *testing.T) {
+	tests := []struct {
+		input string
+		warn  bool
+		err   bool
+	}{
+		{"line 1\nline 2", true, true},
+		{"line 1\r\nline 2", true, true},
+		{"line 1\nline 2\n", true, false},
+		{"line 1\r\nline 2\r\n", true, false},
+		{"line 1\nline 2", false, false},
+	}
+	for _, test := range tests {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.WarnUnterminatedFinalLine = test.warn
+		scnr, _ := NewScanner(*defaultInputs)
+		scnr.OpenIoReaderScanner(strings.NewReader(test.input))
+		dataChan, errorChan := scnr.Read(100, 100)
+		var rows []string
+		for row := range dataChan {
+			rows = append(rows, row)
+		}
+		var errs []error
+		for err := range errorChan {
+			errs = append(errs, err)
+		}
+		if !slices.Equal(rows, []string{"line 1", "line 2"}) {
+			t.Errorf("input: %q, rows: %q", test.input, rows)
+		}
+		if test.err != (len(errs) == 1 && errors.Is(errs[0], ErrUnterminatedFinalLine)) || (!test.err && len(errs) > 0) {
+			t.Errorf("input: %q, warn: %t, errors: %v", test.input, test.warn, errs)
+		}
+	}
+}
+
+// TestScanner_Read_recordSeparator verifies rows are split on the RecordSeparator, including CR-only
+// line endings, and that RECORD_SEPARATOR_AUTO detects the separator.
+func TestScanner_Read_recordSeparator(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+	tests := []struct {
+		separator string
+		input     string
+		expected  []string
+	}{
+		{"", "line 1\rline 2\rline 3\r", []string{"line 1\rline 2\rline 3"}},
+		{RECORD_SEPARATOR_LF, "line 1\r\nline 2\nline 3", []string{"line 1", "line 2", "line 3"}},
+		{RECORD_SEPARATOR_CR, "line 1\rline 2\rline 3\r", []string{"line 1", "line 2", "line 3"}},
+		{RECORD_SEPARATOR_CR, "line 1\rline 2\r\rline 3", []string{"line 1", "line 2", "", "line 3"}},
+		{RECORD_SEPARATOR_AUTO, "line 1\rline 2\rline 3\r", []string{"line 1", "line 2", "line 3"}},
+		{RECORD_SEPARATOR_AUTO, "line 1\r\nline 2\r\nline 3", []string{"line 1", "line 2", "line 3"}},
+		{RECORD_SEPARATOR_AUTO, "line 1\nline 2\nline 3\n", []string{"line 1", "line 2", "line 3"}},
+		{RECORD_SEPARATOR_AUTO, "line 1", []string{"line 1"}},
+		{RECORD_SEPARATOR_AUTO, "line 1\r", []string{"line 1"}},
+		{RECORD_SEPARATOR_AUTO, long + "\rline 2", []string{long, "line 2"}},
+	}
+	for _, test := range tests {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.RecordSeparator = test.separator
+		scnr, err := NewScanner(*defaultInputs)
+		if err != nil {
+			t.Fatalf("calling NewScanner: %s", err)
+		}
+		scnr.OpenIoReaderScanner(strings.NewReader(test.input))
+		dataChan, errorChan := scnr.Read(100, 100)
+		var rows []string
+		for row := range dataChan {
+			rows = append(rows, row)
+		}
+		for err := range errorChan {
+			t.Errorf("input: %q, error: %s", test.input, err)
+		}
+		if !slices.Equal(rows, test.expected) {
+			t.Errorf("separator: %q, input: %.40q, rows: %.80q", test.separator, test.input, rows)
+		}
+	}
+
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.RecordSeparator = "\t"
+	if _, err := NewScanner(*defaultInputs); err == nil {
+		t.Errorf("expected RecordSeparator error")
+	}
+}
+
+// TestScanner_Read_scanError verifies ErrScan is sent when reading the input fails, and the
+// incomplete final row is not sent, but not for errors that reading again cannot fix.
+func TestScanner_Read_scanError(t *testing.T) {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	scnr, _ := NewScanner(*defaultInputs)
+	readErr := errors.New("transient read error")
+	scnr.OpenIoReaderScanner(io.MultiReader(strings.NewReader("line 1\nline 2\nli"), iotest.ErrReader(readErr)))
+	dataChan, errorChan := scnr.Read(100, 100)
+	var rows []string
+	for row := range dataChan {
+		rows = append(rows, row)
+	}
+	var errs []error
+	for err := range errorChan {
+		errs = append(errs, err)
+	}
+	if !slices.Equal(rows, []string{"line 1", "line 2"}) {
+		t.Errorf("rows: %q", rows)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrScan) || !strings.Contains(errs[0].Error(), readErr.Error()) {
+		t.Errorf("errors: %v", errs)
+	}
+
+	// A line longer than the scanner buffer fails every time the input is read, so it is not ErrScan.
+	scnr.OpenIoReaderScanner(strings.NewReader("line 1\n" + strings.Repeat("x", bufio.MaxScanTokenSize+1) + "\n"))
+	dataChan, errorChan = scnr.Read(100, 100)
+	for range dataChan {
+	}
+	errs = nil
+	for err := range errorChan {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errors.Is(errs[0], ErrScan) || !errors.Is(errs[0], bufio.ErrTooLong) {
+		t.Errorf("errors: %v", errs)
+	}
+}
+
+// TestNewScanner_processedInputDirectory verifies an error when the ProcessedInputDirectory is the
+// DataDirectory, or inside it, as processed files would be processed again.
+func TestNewScanner_processedInputDirectory(t *testing.T) {
+	dataDirectory := t.TempDir()
+	inside := filepath.Join(dataDirectory, "processed")
+	outside := t.TempDir()
+	link := filepath.Join(outside, "link")
+	if err := os.Mkdir(inside, 0755); err != nil {
+		t.Fatalf("calling os.Mkdir: %s", err)
+	}
+	if err := os.Symlink(dataDirectory, link); err != nil {
+		t.Fatalf("calling os.Symlink: %s", err)
+	}
+
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.DataDirectory = dataDirectory
+	tests := []struct {
+		processedInputDirectory string
+		valid                   bool
+	}{
+		{dataDirectory, false},
+		{dataDirectory + string(filepath.Separator), false},
+		{filepath.Join(inside, ".."), false},
+		{inside, false},
+		{link, false},
+		{outside, true},
+	}
+	for _, test := range tests {
+		inputs := *defaultInputs
+		inputs.ProcessedInputDirectory = test.processedInputDirectory
+		_, err := NewScanner(inputs)
+		if (err == nil) != test.valid {
+			t.Errorf("ProcessedInputDirectory: %s, valid: %t, error: %v", test.processedInputDirectory, test.valid, err)
+		}
+	}
+}
+
+// TestNewScanner_sharedInputs verifies NewScanner does not modify the Extracts, Replacements, and
+// Formats of the Inputs, so scanners can be created from the same Inputs in concurrent Go routines
+// while other scanners are processing rows.
+func TestNewScanner_sharedInputs(t *testing.T) {
+	inputs := Inputs{
+		ExpectedFieldCount: 2,
+		Extracts:           []*Extract{{Columns: []int{1}, RegexString: `id=(\d+)`, Token: "id={}", Submatch: 1}},
+		Formats:            []*Format{{ExpectedFieldCount: 2, InputDelimiter: ",", MatchRegex: ",", Name: "csv"}},
+		InputDelimiter:     `\|`,
+		Replacements:       []*Replacement{{GuardRegex: "id", RegexString: "ID", Replacement: "id"}},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scnr, err := NewScanner(inputs)
+			if err != nil {
+				t.Errorf("calling NewScanner: %s", err)
+				return
+			}
+			splits, _ := scnr.Split(scnr.Replace("a|ID=1 id=2"))
+			scnr.Extract(splits)
+		}()
+	}
+	wg.Wait()
+
+	if inputs.Extracts[0].regex != nil || inputs.Extracts[0].tokenLiteral != "" ||
+		inputs.Replacements[0].regex != nil || inputs.Replacements[0].guardRegex != nil ||
+		inputs.Formats[0].inputDelimiter != nil || inputs.Formats[0].matchRegex != nil {
+		t.Errorf("NewScanner modified the Inputs")
+	}
+}
+
 // ExampleScanner_Read_move shows how to read data and move the file when when processing is complete.
 func TestScanner_Read_move(t *testing.T) {
 	// Duplicate the existing test file in a temp dir so we can test moving the file on completion.
@@ -256,6 +500,23 @@ func ExampleScanner_Replace() {
 	// 1696680000  01  MDT  0  000  class poor delimiting  debug embedded values  sw_a  Message with embedded hex flag=0x01 and integer flag = 003
 }
 
+// ExampleScanner_Replace_guardRegex shows how a GuardRegex limits a Replacement to data rows,
+// here rows that start with a timestamp, leaving other rows unchanged.
+func ExampleScanner_Replace_guardRegex() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Replacements = []*Replacement{
+		{GuardRegex: `^\d{4}-\d{2}-\d{2} `, RegexString: `\s{3,}`, Replacement: "  "},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range []string{"2023-10-07 12:00:00    info     message", "banner:    version     1.2"} {
+		fmt.Printf("%q\n", scnr.Replace(row))
+	}
+
+	// Output:
+	// "2023-10-07 12:00:00  info  message"
+	// "banner:    version     1.2"
+}
+
 // ExampleScanner_Split shows how to use the Split function. In this case the data is then
 // Join'ed back together just for output purposed.
 // Note that the call to Split drops the error that ExpectedFieldCount was incorrect.
@@ -493,3 +754,1455 @@ func ExampleScanner_Extract_andHash() {
 	// INSERT OR IGNORE INTO parsed VALUES('2023-10-07 12:00:00.05 MDT',1,005,'0x1b7739c1e24d3a837e7821ecfb9a1be1','sw_a','4.ef','3');
 	// INSERT OR IGNORE INTO parsed VALUES('2023-10-07 12:00:00.06 MDT',1,006,'0x1b7739c1e24d3a837e7821ecfb9a1be1','sw_a','5.gh','4');
 }
+
+// TestMergeHashFiles verifies the counts of hashes in more than one file are summed, and
+// hashes in one file are kept, in the merged file.
+func TestMergeHashFiles(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		"a.hashes.txt": "'0xaa'|3|value a\n'0xbb'|1|value b\n",
+		"b.hashes.txt": "'0xaa'|2|value a\n'0xcc'|5|value c|with delimiter\n",
+	}
+	var paths []string
+	for name, data := range files {
+		paths = append(paths, filepath.Join(directory, name))
+		if err := os.WriteFile(paths[len(paths)-1], []byte(data), 0644); err != nil {
+			t.Fatalf("calling os.WriteFile: %s", err)
+		}
+	}
+	output := filepath.Join(directory, "merged.hashes.txt")
+
+	if err := MergeHashFiles(paths, output); err != nil {
+		t.Fatalf("calling MergeHashFiles: %s", err)
+	}
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("calling os.ReadFile: %s", err)
+	}
+	expected := "'0xaa'|5|value a\n'0xcc'|5|value c|with delimiter\n'0xbb'|1|value b\n"
+	if string(b) != expected {
+		t.Errorf("merged:\n%s\nexpected:\n%s", b, expected)
+	}
+
+	if err := MergeHashFiles(append(paths, filepath.Join(directory, "missing.hashes.txt")), output); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+// TestWriteHashes_append shows how hashes can accumulate across runs by reading an existing
+// hash file with ReadHashes before calling WriteHashes.
+func TestWriteHashes_append(t *testing.T) {
+	hashesFilePath := filepath.Join(t.TempDir(), "test_extract.txt.hashes.txt")
+	runCounts := []map[string]int{}
+	for run := 0; run < 2; run++ {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.InputDelimiter = `\s\s+`
+		defaultInputs.NegativeFilter = `serial number`
+		defaultInputs.OutputDelimiter = "|"
+		defaultInputs.HashColumns = []int{3, 4, 5}
+		scnr := openFileScanner(filepath.Join(testDataDirectory, "test_extract.txt"), *defaultInputs)
+		dataChan, errorChan := scnr.Read(100, 100)
+		for row := range dataChan {
+			if scnr.Filter(row) {
+				continue
+			}
+			splits, _ := scnr.Split(row)
+			if _, err := scnr.SplitsExcludeHashColumns(splits, HASH_FORMAT_STRING); err != nil {
+				t.Errorf("calling SplitsExcludeHashColumns: %s", err)
+			}
+		}
+		for err := range errorChan {
+			t.Errorf("calling Read: %s", err)
+		}
+		runCounts = append(runCounts, scnr.HashCounts)
+
+		if existing, err := os.Open(hashesFilePath); err == nil {
+			err = ReadHashes(existing, "|", scnr.HashCounts, scnr.HashMap)
+			existing.Close()
+			if err != nil {
+				t.Errorf("calling ReadHashes: %s", err)
+			}
+		}
+		var buf bytes.Buffer
+		if err := WriteHashes(&buf, "|", "\n", scnr.HashCounts, scnr.HashMap); err != nil {
+			t.Errorf("calling WriteHashes: %s", err)
+		}
+		if err := os.WriteFile(hashesFilePath, buf.Bytes(), 0644); err != nil {
+			t.Errorf("calling os.WriteFile: %s", err)
+		}
+	}
+
+	hashesFile, err := os.Open(hashesFilePath)
+	if err != nil {
+		t.Fatalf("calling os.Open: %s", err)
+	}
+	defer hashesFile.Close()
+	hashCounts := make(map[string]int)
+	hashMap := make(map[string]string)
+	if err := ReadHashes(hashesFile, "|", hashCounts, hashMap); err != nil {
+		t.Errorf("calling ReadHashes: %s", err)
+	}
+	if len(hashCounts) != 3 {
+		t.Errorf("wrong number of hashes: %d", len(hashCounts))
+	}
+	// The second run's counts include the first run's counts.
+	for hash, count := range hashCounts {
+		if count != 2*runCounts[0][hash] || runCounts[0][hash] == 0 {
+			t.Errorf("hash: %s, count: %d, first run count: %d", hash, count, runCounts[0][hash])
+		}
+		if !strings.Contains(hashMap[hash], "|") {
+			t.Errorf("value should contain the delimiter: %s", hashMap[hash])
+		}
+	}
+}
+
+// ExampleScanner_Split_router shows how to use Formats to split rows with different delimiters,
+// and how rows matching no Format are handled for each RouterPolicy.
+func ExampleScanner_Split_router() {
+	rows := []string{"csv,a,b", "tsv\ta\tb", "unmatched a b"}
+	for _, policy := range []RouterPolicy{ROUTER_PASSTHROUGH, ROUTER_DROP, ROUTER_ERROR} {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.InputDelimiter = `\s`
+		defaultInputs.ExpectedFieldCount = 3
+		defaultInputs.Formats = []*Format{
+			{Name: "csv", MatchRegex: `^csv,`, InputDelimiter: `,`, ExpectedFieldCount: 3},
+			{Name: "tsv", MatchRegex: `^tsv\t`, InputDelimiter: `\t`, ExpectedFieldCount: 3},
+		}
+		defaultInputs.RouterPolicy = policy
+		scnr, err := NewScanner(*defaultInputs)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("policy: %d\n", policy)
+		for _, row := range rows {
+			splits, err := scnr.Split(row)
+			fmt.Printf("splits: %q, error: %v, unmatched: %t\n", splits, err, errors.Is(err, ErrUnmatchedFormat))
+		}
+	}
+
+	// A default Format is used for rows matching no Format.
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Formats = []*Format{
+		{Name: "csv", MatchRegex: `^csv,`, InputDelimiter: `,`, ExpectedFieldCount: 3},
+		{Name: "space", MatchRegex: `^space `, InputDelimiter: ` `, ExpectedFieldCount: 4},
+	}
+	defaultInputs.RouterDefaultFormat = "space"
+	defaultInputs.RouterPolicy = ROUTER_ERROR
+	scnr, _ := NewScanner(*defaultInputs)
+	splits, err := scnr.Split(rows[2])
+	fmt.Printf("default format splits: %q, error: %v\n", splits, err)
+
+	// Output:
+	// policy: 0
+	// splits: ["csv" "a" "b"], error: <nil>, unmatched: false
+	// splits: ["tsv" "a" "b"], error: <nil>, unmatched: false
+	// splits: ["unmatched" "a" "b"], error: <nil>, unmatched: false
+	// policy: 1
+	// splits: ["csv" "a" "b"], error: <nil>, unmatched: false
+	// splits: ["tsv" "a" "b"], error: <nil>, unmatched: false
+	// splits: [], error: <nil>, unmatched: false
+	// policy: 2
+	// splits: ["csv" "a" "b"], error: <nil>, unmatched: false
+	// splits: ["tsv" "a" "b"], error: <nil>, unmatched: false
+	// splits: [], error: Split row matches no format: unmatched a b, unmatched: true
+	// default format splits: ["unmatched" "a" "b"], error: Split expectedFieldCount: 4, actual: 3
+}
+
+// ExampleScanner_WriteMessageTypeIds shows how to assign sequential message type IDs to hashes.
+// IDs are assigned in order of first appearance, and are output as a column after the hash.
+func ExampleScanner_WriteMessageTypeIds() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.InputDelimiter = `\s\s+`
+	defaultInputs.OutputDelimiter = "|"
+	defaultInputs.NegativeFilter = `serial number`
+	defaultInputs.HashColumns = []int{3, 4, 5}
+	defaultInputs.MessageTypeIdPrefix = "MSG-"
+	scnr := openFileScanner(filepath.Join(testDataDirectory, "test_extract.txt"), *defaultInputs)
+	dataChan, errorChan := scnr.Read(100, 100)
+	for row := range dataChan {
+		if scnr.Filter(row) {
+			continue
+		}
+		splits, _ := scnr.Split(row)
+		sehc, _ := scnr.SplitsExcludeHashColumns(splits, HASH_FORMAT_STRING)
+		fmt.Println(strings.Join(sehc[2:5], "|"))
+	}
+	for err := range errorChan {
+		fmt.Println(err)
+	}
+
+	fmt.Println("\nMessage type IDs:")
+	scnr.WriteMessageTypeIds(os.Stdout)
+
+	// Output:
+	// 0|'0x43b9244c08df01a40a99429008b91478'|MSG-0001
+	// 001|'0x374e2ab71d9d3d5ee7076dee11c8910f'|MSG-0002
+	// 002|'0x155e6b93abc4112c81be9921f6c4c90d'|MSG-0003
+	// 003|'0x155e6b93abc4112c81be9921f6c4c90d'|MSG-0003
+	// 004|'0x155e6b93abc4112c81be9921f6c4c90d'|MSG-0003
+	// 005|'0x155e6b93abc4112c81be9921f6c4c90d'|MSG-0003
+	// 006|'0x155e6b93abc4112c81be9921f6c4c90d'|MSG-0003
+	//
+	// Message type IDs:
+	// MSG-0001|'0x43b9244c08df01a40a99429008b91478'|notification|debug|multi word type
+	// MSG-0002|'0x374e2ab71d9d3d5ee7076dee11c8910f'|notification|info|SingleWordType
+	// MSG-0003|'0x155e6b93abc4112c81be9921f6c4c90d'|status|info|alphanumeric value
+}
+
+// ExampleScanner_SplitsExcludeHashColumns_collision shows how each HashCollisionPolicy handles
+// different values with the same hash. The collision is forced by storing a different value
+// for the hash in HashMap.
+func ExampleScanner_SplitsExcludeHashColumns_collision() {
+	splits := []string{"a", "b", "c"}
+	hash, _ := Hash("b|c", HASH_FORMAT_STRING)
+	for _, policy := range []HashCollisionPolicy{HASH_COLLISION_LAST_WINS, HASH_COLLISION_FIRST_WINS, HASH_COLLISION_ERROR} {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.OutputDelimiter = "|"
+		defaultInputs.HashColumns = []int{1, 2}
+		defaultInputs.HashCollisionPolicy = policy
+		scnr, _ := NewScanner(*defaultInputs)
+		scnr.HashMap[hash] = "first|value"
+		scnr.HashCounts[hash] = 1
+
+		_, err := scnr.SplitsExcludeHashColumns(splits, HASH_FORMAT_STRING)
+		fmt.Printf("policy: %d, value: %s, count: %d, collision error: %t\n",
+			policy, scnr.HashMap[hash], scnr.HashCounts[hash], errors.Is(err, ErrHashCollision))
+	}
+
+	// Output:
+	// policy: 0, value: b|c, count: 2, collision error: false
+	// policy: 1, value: first|value, count: 2, collision error: false
+	// policy: 2, value: first|value, count: 1, collision error: true
+}
+
+// TestScanner_SplitsToSql_provenance verifies the provenance columns are present and populated.
+func TestScanner_SplitsToSql_provenance(t *testing.T) {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.SqlProvenance = true
+	defaultInputs.SqlQuoteColumns = []int{0}
+	scnr := openFileScanner(filepath.Join(testDataDirectory, "test_read.txt"), *defaultInputs)
+	defer scnr.Shutdown()
+	inputsHash, err := defaultInputs.Hash()
+	if err != nil {
+		t.Errorf("calling Hash: %s", err)
+	}
+
+	create := scnr.CreateTableSql(3, "parsed")
+	if create != "CREATE TABLE IF NOT EXISTS parsed (c1 TEXT, c2 TEXT, c3 TEXT, source_file TEXT, ingest_time TEXT, inputs_hash TEXT);" {
+		t.Errorf("wrong CREATE TABLE: %s", create)
+	}
+
+	sql := scnr.SplitsToSql(3, "parsed", []string{"a", "1"}, []string{"x"})
+	rgx := regexp.MustCompile(`^INSERT OR IGNORE INTO parsed VALUES\('a',1,'x','test_read.txt','([^']+)','([0-9a-f]{32})'\);$`)
+	match := rgx.FindStringSubmatch(sql)
+	if match == nil {
+		t.Fatalf("provenance missing: %s", sql)
+	}
+	if _, err := time.Parse(time.RFC3339, match[1]); err != nil {
+		t.Errorf("ingest time not parsable: %s", err)
+	}
+	if match[2] != inputsHash {
+		t.Errorf("inputs hash: %s, expected: %s", match[2], inputsHash)
+	}
+}
+
+// TestScanner_SetProgress_gzip verifies progress for gzip compressed input is reported in
+// uncompressed bytes.
+func TestScanner_SetProgress_gzip(t *testing.T) {
+	testFileBytes, err := os.ReadFile(filepath.Join(testDataDirectory, "test_read.txt"))
+	if err != nil {
+		t.Errorf("calling os.ReadFile: %s", err)
+	}
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write(testFileBytes)
+	gzipWriter.Close()
+	gzipFilePath := filepath.Join(t.TempDir(), "test_read.txt.gz")
+	err = os.WriteFile(gzipFilePath, compressed.Bytes(), 0644)
+	if err != nil {
+		t.Errorf("calling os.WriteFile: %s", err)
+	}
+
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	scnr := openFileScanner(gzipFilePath, *defaultInputs)
+	var progress []int64
+	scnr.SetProgress(func(bytesScanned int64) {
+		progress = append(progress, bytesScanned)
+	})
+	dataChan, errorChan := scnr.Read(100, 100)
+	rows := 0
+	for range dataChan {
+		rows++
+	}
+	for err := range errorChan {
+		t.Errorf("calling Read: %s", err)
+	}
+
+	if rows != 3 || len(progress) != rows {
+		t.Fatalf("rows: %d, progress calls: %d", rows, len(progress))
+	}
+	if progress[len(progress)-1] != int64(len(testFileBytes)) {
+		t.Errorf("progress: %d, uncompressed size: %d, compressed size: %d",
+			progress[len(progress)-1], len(testFileBytes), compressed.Len())
+	}
+}
+
+// ExampleScanner_Extract_prefixWithName shows how extracted values can be prefixed with the
+// name of the Extract that produced them.
+func ExampleScanner_Extract_prefixWithName() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.InputDelimiter = `\s\s+`
+	defaultInputs.NegativeFilter = `serial number`
+	defaultInputs.PrefixExtractsWithName = true
+	defaultInputs.Extracts = []*Extract{
+		{
+			Columns:     []int{7},
+			Name:        "version",
+			RegexString: `(version = )([\d\.]+)`,
+			Token:       "${1}{}",
+			Submatch:    2,
+		},
+		{
+			Columns:     []int{7},
+			Name:        "release",
+			RegexString: `(release=)([\w\.]+)`,
+			Token:       "${1}{}",
+			Submatch:    2,
+		},
+		{
+			// Extracts without a Name are not prefixed.
+			Columns:     []int{7},
+			RegexString: `(\()(\d+)(\))`,
+			Token:       "${1}{}${3}",
+			Submatch:    2,
+		},
+	}
+	scnr := openFileScanner(filepath.Join(testDataDirectory, "test_extract.txt"), *defaultInputs)
+	dataChan, errorChan := scnr.Read(100, 100)
+	for row := range dataChan {
+		if scnr.Filter(row) {
+			continue
+		}
+		splits, _ := scnr.Split(row)
+		extracts, _ := scnr.Extract(splits)
+		if len(extracts) > 0 {
+			fmt.Println(splits[7] + "|EXTRACTS|" + strings.Join(extracts, "|"))
+		}
+	}
+	for err := range errorChan {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// Unit 12.Ab.34 message ({})|EXTRACTS|789
+	// Info SW version = {} release={}|EXTRACTS|version=1.2.34|release=a.1.1
+}
+
+// TestScanner_AppendIngestTimestamp verifies the ingest timestamp column is appended and parsable.
+func TestScanner_AppendIngestTimestamp(t *testing.T) {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.InputDelimiter = `\s\s+`
+	defaultInputs.ExpectedFieldCount = 8
+	defaultInputs.IngestTimestampFormat = time.RFC3339Nano
+	scnr := openFileScanner(filepath.Join(testDataDirectory, "test_read.txt"), *defaultInputs)
+	start := time.Now()
+	dataChan, errorChan := scnr.Read(100, 100)
+	for row := range dataChan {
+		splits, err := scnr.Split(row)
+		if err != nil {
+			t.Errorf("calling Split: %s", err)
+		}
+		splits = scnr.AppendIngestTimestamp(splits)
+		if len(splits) != 9 {
+			t.Fatalf("ingest timestamp not appended: %q", splits)
+		}
+		ingestTime, err := time.Parse(time.RFC3339Nano, splits[8])
+		if err != nil {
+			t.Errorf("ingest timestamp not parsable: %s", err)
+		}
+		if ingestTime.Before(start.Truncate(time.Second)) || ingestTime.After(time.Now()) {
+			t.Errorf("ingest timestamp: %s, not in range starting at: %s", ingestTime, start)
+		}
+	}
+	for err := range errorChan {
+		t.Errorf("calling Read: %s", err)
+	}
+
+	// No column is added without a format.
+	defaultInputs.IngestTimestampFormat = ""
+	scnr, _ = NewScanner(*defaultInputs)
+	if splits := scnr.AppendIngestTimestamp([]string{"a"}); len(splits) != 1 {
+		t.Errorf("column appended without a format: %q", splits)
+	}
+}
+
+// ExampleScanner_Split_trimEmptyEdgeFields shows how TrimEmptyEdgeFields drops the empty
+// fields that result from delimiters at the start or end of a row.
+func ExampleScanner_Split_trimEmptyEdgeFields() {
+	row := "  a  b  c  "
+	for _, trim := range []bool{false, true} {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.InputDelimiter = `\s\s+`
+		defaultInputs.ExpectedFieldCount = 3
+		defaultInputs.TrimEmptyEdgeFields = trim
+		scnr, _ := NewScanner(*defaultInputs)
+		splits, err := scnr.Split(row)
+		fmt.Printf("trim: %t, splits: %q, error: %v\n", trim, splits, err)
+	}
+
+	// Output:
+	// trim: false, splits: ["" "a" "b" "c" ""], error: Split expectedFieldCount: 3, actual: 5
+	// trim: true, splits: ["a" "b" "c"], error: <nil>
+}
+
+// ExampleScanner_Split_padTrailingEmptyFields shows how PadTrailingEmptyFields preserves
+// trailing empty fields up to the expected count, I.E. when optional trailing columns are
+// omitted or an empty last field is trimmed, while rows with too many fields are still errors.
+func ExampleScanner_Split_padTrailingEmptyFields() {
+	for _, pad := range []bool{false, true} {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.InputDelimiter = `,`
+		defaultInputs.ExpectedFieldCount = 5
+		defaultInputs.PadTrailingEmptyFields = pad
+		defaultInputs.TrimEmptyEdgeFields = true
+		scnr, _ := NewScanner(*defaultInputs)
+		for _, row := range []string{"a,b,c,,", "a,b", "a,b,c,d,e,f"} {
+			splits, err := scnr.Split(row)
+			fmt.Printf("pad: %t, splits: %q, error: %v\n", pad, splits, err)
+		}
+	}
+
+	// Output:
+	// pad: false, splits: ["a" "b" "c" ""], error: Split expectedFieldCount: 5, actual: 4
+	// pad: false, splits: ["a" "b"], error: Split expectedFieldCount: 5, actual: 2
+	// pad: false, splits: ["a" "b" "c" "d" "e" "f"], error: Split expectedFieldCount: 5, actual: 6
+	// pad: true, splits: ["a" "b" "c" "" ""], error: <nil>
+	// pad: true, splits: ["a" "b" "" "" ""], error: <nil>
+	// pad: true, splits: ["a" "b" "c" "d" "e" "f"], error: Split expectedFieldCount: 5, actual: 6
+}
+
+// ExampleScanner_Split_trimQuotes shows how TrimQuotes strips matching quotes from each field,
+// leaving unmatched quotes in place.
+func ExampleScanner_Split_trimQuotes() {
+	row := `"value",'single',"unmatched',plain`
+	for _, trim := range []bool{false, true} {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.InputDelimiter = `,`
+		defaultInputs.ExpectedFieldCount = 4
+		defaultInputs.TrimQuotes = trim
+		scnr, _ := NewScanner(*defaultInputs)
+		splits, err := scnr.Split(row)
+		fmt.Printf("trim: %t, splits: %q, error: %v\n", trim, splits, err)
+	}
+
+	// Output:
+	// trim: false, splits: ["\"value\"" "'single'" "\"unmatched'" "plain"], error: <nil>
+	// trim: true, splits: ["value" "single" "\"unmatched'" "plain"], error: <nil>
+}
+
+// ExampleScanner_LimitFieldLengths shows how a field longer than MaxFieldLength is truncated,
+// or replaced by its hash, according to the LongFieldPolicy.
+func ExampleScanner_LimitFieldLengths() {
+	for _, policy := range []LongFieldPolicy{LONG_FIELD_TRUNCATE, LONG_FIELD_HASH} {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.MaxFieldLength = 8
+		defaultInputs.LongFieldPolicy = policy
+		scnr, _ := NewScanner(*defaultInputs)
+		splits := []string{"short", "aGVsbG8gd29ybGQgYmxvYg==", "exactly8", "héllo wörld"}
+		limited := scnr.LimitFieldLengths(splits)
+		fmt.Printf("policy: %d, limited: %d, splits: %q\n", policy, limited, splits)
+	}
+
+	// Output:
+	// policy: 0, limited: 2, splits: ["short" "aGVsbG8g..." "exactly8" "héllo w..."]
+	// policy: 1, limited: 2, splits: ["short" "...0x72069336d9e7cd93fd30e8ac532ac793" "exactly8" "...0xed0c22cc110ede12327851863c078138"]
+}
+
+// ExampleScanner_ValidateColumns shows how to use ColumnAllowlists to flag rows with
+// unexpected values.
+func ExampleScanner_ValidateColumns() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.InputDelimiter = `\s\s+`
+	defaultInputs.ColumnAllowlists = []*ColumnAllowlist{
+		{Column: 4, Values: []string{"debug", "info", "warn", "error"}},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	rows := []string{
+		"2023-10-07 12:00:00.00 MDT  0  0  notification  debug  multi word type  sw_a  Debug SW message",
+		"2023-10-07 12:00:00.01 MDT  1  001  notification  critical  SingleWordType  sw_b  Info SW message",
+	}
+	for _, row := range rows {
+		splits, _ := scnr.Split(row)
+		for _, err := range scnr.ValidateColumns(splits) {
+			var parseError *ParseError
+			fmt.Printf("%s, is ParseError: %t\n", err, errors.As(err, &parseError))
+		}
+	}
+
+	// Output:
+	// column 4, value: critical, value not in allowlist, is ParseError: true
+}
+
+// ExampleScanner_Split_literalDelimiter shows how InputDelimiterLiteral splits on a literal
+// string, preserving consecutive spaces inside fields.
+func ExampleScanner_Split_literalDelimiter() {
+	row := "2023-10-07 12:00:00.00 MDT||multi word  type||Message   with   spaces"
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.InputDelimiter = "||"
+	defaultInputs.InputDelimiterLiteral = true
+	defaultInputs.ExpectedFieldCount = 3
+	scnr, _ := NewScanner(*defaultInputs)
+	splits, err := scnr.Split(row)
+	fmt.Printf("splits: %q, error: %v\n", splits, err)
+
+	// Output:
+	// splits: ["2023-10-07 12:00:00.00 MDT" "multi word  type" "Message   with   spaces"], error: <nil>
+}
+
+// ExampleScanner_Extract_submatchError shows a misconfigured Submatch is reported once per row,
+// even when the regex matches multiple times.
+func ExampleScanner_Extract_submatchError() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, RegexString: `(\d+)`, Token: "{}", Submatch: 2},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	splits := []string{"values 1 2 3 4"}
+	extracts, errs := scnr.Extract(splits)
+	fmt.Printf("extracts: %q, errors: %d\n%s\n", extracts, len(errs), errs[0])
+
+	// Output:
+	// extracts: [], errors: 1
+	// submatch index 2 out of range for submatches:[1 1], regex: (\d+)
+}
+
+// TestInputs_MarshalResolved verifies the resolved Inputs reload into equivalent Inputs.
+func TestInputs_MarshalResolved(t *testing.T) {
+	inputs, err := NewInputs("../inputs/exampleInputWithHashing.json")
+	if err != nil {
+		t.Fatalf("calling NewInputs: %s", err)
+	}
+	inputs.Formats = []*Format{{Name: "csv", MatchRegex: `,`, InputDelimiter: `,`, ExpectedFieldCount: 3}}
+	inputs.RouterPolicy = ROUTER_ERROR
+	b, err := inputs.MarshalResolved()
+	if err != nil {
+		t.Fatalf("calling MarshalResolved: %s", err)
+	}
+	resolvedFilePath := filepath.Join(t.TempDir(), "resolved.json")
+	if err := os.WriteFile(resolvedFilePath, b, 0644); err != nil {
+		t.Fatalf("calling os.WriteFile: %s", err)
+	}
+	reloaded, err := NewInputs(resolvedFilePath)
+	if err != nil {
+		t.Fatalf("calling NewInputs: %s", err)
+	}
+	if !reflect.DeepEqual(inputs, reloaded) {
+		t.Errorf("reloaded inputs not equal:\n%+v\n%+v", inputs, reloaded)
+	}
+	if _, err := NewScanner(*reloaded); err != nil {
+		t.Errorf("calling NewScanner: %s", err)
+	}
+}
+
+// ExampleScanner_SplitsExcludeHashColumns_canonicalizeHashNumbers shows how CanonicalizeHashNumbers
+// gives hash columns with the same number, written differently, the same hash.
+func ExampleScanner_SplitsExcludeHashColumns_canonicalizeHashNumbers() {
+	for _, canonicalize := range []bool{false, true} {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.OutputDelimiter = "|"
+		defaultInputs.HashColumns = []int{1, 2}
+		defaultInputs.CanonicalizeHashNumbers = canonicalize
+		scnr, _ := NewScanner(*defaultInputs)
+
+		scnr.SplitsExcludeHashColumns([]string{"a", "code", "003"}, HASH_FORMAT_STRING)
+		scnr.SplitsExcludeHashColumns([]string{"b", "code", "3"}, HASH_FORMAT_STRING)
+		fmt.Printf("canonicalize: %t, hashes: %d\n", canonicalize, len(scnr.HashCounts))
+	}
+
+	// Output:
+	// canonicalize: false, hashes: 2
+	// canonicalize: true, hashes: 1
+}
+
+// ExampleCanonicalizeNumber shows decimal and hex integers with leading zeros and signs
+// canonicalized; other values are returned unchanged.
+func ExampleCanonicalizeNumber() {
+	for _, value := range []string{"003", "3", "-007", "+5", "000", "0x01", "0X1A", "0x00", "1.05", "abc"} {
+		fmt.Printf("%s -> %s\n", value, CanonicalizeNumber(value))
+	}
+
+	// Output:
+	// 003 -> 3
+	// 3 -> 3
+	// -007 -> -7
+	// +5 -> 5
+	// 000 -> 0
+	// 0x01 -> 0x1
+	// 0X1A -> 0x1a
+	// 0x00 -> 0x0
+	// 1.05 -> 1.05
+	// abc -> abc
+}
+
+// ExampleScanner_Extract_normalizeDuration shows durations normalized to nanoseconds with
+// NORM_DURATION_NS; a value that is not a duration is kept, and an error is returned.
+func ExampleScanner_Extract_normalizeDuration() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, RegexString: `latency=(\S+)`, Token: "latency={}", Submatch: 1, Normalizer: NORM_DURATION_NS},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	splits := []string{"latency=1m30s latency=500ms latency=2h latency=fast"}
+	extracts, errs := scnr.Extract(splits)
+	fmt.Printf("extracts: %q, errors: %d\n%s\n", extracts, len(errs), errs[0])
+
+	// Output:
+	// extracts: ["90000000000" "500000000" "7200000000000" "fast"], errors: 1
+	// column 0, value: fast, NORM_DURATION_NS: time: invalid duration "fast"
+}
+
+// ExampleScanner_Extract_normalizeTimestamp shows timestamps normalized with NORM_TIMESTAMP, with
+// the default layout and format, and with a TimestampLayout and TimestampFormat.
+func ExampleScanner_Extract_normalizeTimestamp() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{1}, RegexString: `at (\S+)`, Token: "at {}", Submatch: 1, Normalizer: NORM_TIMESTAMP},
+		{Columns: []int{2}, RegexString: `since (\S+ \S+)`, Token: "since {}", Submatch: 1, Normalizer: NORM_TIMESTAMP,
+			TimestampLayout: "01/02/2006 15:04", TimestampFormat: time.RFC3339},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	splits := []string{"2023-10-07", "disk full at 2023-10-07T12:00:00Z on sda", "retrying since 10/07/2023 11:30"}
+	extracts, errs := scnr.Extract(splits)
+	fmt.Printf("extracts: %q, errors: %d\nsplits: %q\n", extracts, len(errs), splits)
+	extracts, errs = scnr.Extract([]string{"2023-10-07", "disk full at noon", ""})
+	fmt.Printf("extracts: %q, errors: %d\n%s\n", extracts, len(errs), errs[0])
+
+	// Output:
+	// extracts: ["1696680000" "2023-10-07T11:30:00Z"], errors: 0
+	// splits: ["2023-10-07" "disk full at {} on sda" "retrying since {}"]
+	// extracts: ["noon"], errors: 1
+	// column 1, value: noon, NORM_TIMESTAMP: parsing time "noon" as "2006-01-02 15:04:05": cannot parse "noon" as "2006"
+}
+
+// ExampleScanner_Extract_normalizeCidr shows how NORM_CIDR splits a CIDR into the network and
+// prefix, as two extracts; an invalid CIDR is kept, and an error is returned.
+func ExampleScanner_Extract_normalizeCidr() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, Name: "blocked", RegexString: `\S+/\d+`, Token: "{}", Normalizer: NORM_CIDR},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	splits := []string{"blocked 10.0.0.5/24 and 2001:DB8::1/32 and 300.1.1.1/8"}
+	extracts, errs := scnr.Extract(splits)
+	fmt.Printf("extracts: %q, errors: %d\n%s\n", extracts, len(errs), errs[0])
+	for _, extract := range scnr.Schema().Extracts {
+		fmt.Println(extract.Name)
+	}
+
+	// Output:
+	// extracts: ["10.0.0.0" "24" "2001:db8::" "32" "300.1.1.1/8" ""], errors: 1
+	// column 0, value: 300.1.1.1/8, NORM_CIDR: netip.ParsePrefix("300.1.1.1/8"): ParseAddr("300.1.1.1"): IPv4 field has value >255
+	// blocked.network
+	// blocked.prefix
+}
+
+// ExampleScanner_ParetoReport shows the most frequent hashes, with the percent of all rows and
+// the cumulative percent.
+func ExampleScanner_ParetoReport() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.OutputDelimiter = "|"
+	defaultInputs.HashColumns = []int{1}
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, value := range []string{"error", "warning", "error", "info", "error", "warning", "error", "info", "warning", "debug"} {
+		scnr.SplitsExcludeHashColumns([]string{"2023-10-07", value}, HASH_FORMAT_STRING)
+	}
+	fmt.Print(scnr.ParetoReport(2))
+
+	// Output:
+	// hash: '0xcb5e100e5a9a3e7f6d1fd97512215282', count: 4, percent: 40.0, cumulative: 40.0, value: error
+	// hash: '0x7b83d3f08fa392b79e3f553b585971cd', count: 3, percent: 30.0, cumulative: 70.0, value: warning
+}
+
+// ExampleRowFormatter shows the same row output by each RowFormatter.
+func ExampleRowFormatter() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.SqlQuoteColumns = []int{0}
+	scnr, _ := NewScanner(*defaultInputs)
+	splits := []string{"2023-10-07", "'0xabcd'", "a \"quoted\" value, with comma"}
+	extracts := []string{"1.2.34", "789"}
+	formatters := []RowFormatter{
+		DelimitedFormatter{Delimiter: "|"},
+		CsvFormatter{},
+		NdjsonFormatter{},
+		SqlFormatter{Columns: 6, Scanner: scnr, Table: "parsed"},
+	}
+	for _, formatter := range formatters {
+		fmt.Println(formatter.Format("SN1", splits, extracts, "'0xabcd'"))
+	}
+
+	// Output:
+	// SN1|2023-10-07|'0xabcd'|a "quoted" value, with comma|EXTRACTS|1.2.34|789
+	// SN1,2023-10-07,'0xabcd',"a ""quoted"" value, with comma",1.2.34,789
+	// {"UniqueId":"SN1","Hash":"'0xabcd'","Splits":["2023-10-07","'0xabcd'","a \"quoted\" value, with comma"],"Extracts":["1.2.34","789"]}
+	// INSERT OR IGNORE INTO parsed VALUES('SN1',2023-10-07,'0xabcd',a "quoted" value, with comma,'1.2.34','789');
+}
+
+// ExampleScanner_Split_delimiterCandidates shows rows split with the first of the
+// InputDelimiterCandidates that gives the ExpectedFieldCount.
+func ExampleScanner_Split_delimiterCandidates() {
+	rows := []string{
+		"2023-10-07,info,message one",
+		"2023-10-07\twarning\tmessage, with comma",
+		"2023-10-07,error,message three",
+	}
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.InputDelimiterCandidates = []string{",", "\t"}
+	defaultInputs.ExpectedFieldCount = 3
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range rows {
+		splits, err := scnr.Split(row)
+		fmt.Printf("splits: %q, error: %v\n", splits, err)
+	}
+
+	// Output:
+	// splits: ["2023-10-07" "info" "message one"], error: <nil>
+	// splits: ["2023-10-07" "warning" "message, with comma"], error: <nil>
+	// splits: ["2023-10-07" "error" "message three"], error: <nil>
+}
+
+// ExampleNdjsonFormatter_typedExtracts shows typed extracts output as JSON numbers and booleans;
+// a value that does not match the type is output as a string, and an error is returned.
+func ExampleNdjsonFormatter_typedExtracts() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, RegexString: `count=(\S+)`, Token: "count={}", Submatch: 1, Type: EXTRACT_TYPE_NUMBER},
+		{Columns: []int{0}, RegexString: `enabled=(\S+)`, Token: "enabled={}", Submatch: 1, Type: EXTRACT_TYPE_BOOL},
+		{Columns: []int{0}, RegexString: `version=(\S+)`, Token: "version={}", Submatch: 1},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	splits := []string{"count=42 enabled=TRUE version=1.2.34 count=many"}
+	extracts, errs := scnr.Extract(splits)
+	fmt.Println(NdjsonFormatter{Scanner: scnr}.Format("", splits, extracts, ""))
+	fmt.Println(errs)
+
+	// Output:
+	// {"Splits":["count={} enabled={} version={} count={}"],"Extracts":[42,"many",true,"1.2.34"]}
+	// [column 0, value: many, not a number]
+}
+
+// ExampleNdjsonFormatter_jsonType shows JsonType outputting extracts as JSON numbers and bools,
+// without changing the extracted values; values that are not of the JsonType are output as strings,
+// without an error.
+func ExampleNdjsonFormatter_jsonType() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, RegexString: `count=(\S+)`, Token: "count={}", Submatch: 1, JsonType: EXTRACT_TYPE_NUMBER},
+		{Columns: []int{0}, RegexString: `enabled=(\S+)`, Token: "enabled={}", Submatch: 1, JsonType: EXTRACT_TYPE_BOOL},
+		{Columns: []int{0}, RegexString: `version=(\S+)`, Token: "version={}", Submatch: 1, JsonType: EXTRACT_TYPE_STRING},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	splits := []string{"count=42 count=1.50 count=+5 enabled=true enabled=TRUE version=1.2"}
+	extracts, errs := scnr.Extract(splits)
+	fmt.Printf("%q\n", extracts)
+	fmt.Println(NdjsonFormatter{Scanner: scnr}.Format("", splits, extracts, ""))
+	fmt.Println(errs)
+
+	defaultInputs.Extracts[0].Type = EXTRACT_TYPE_NUMBER
+	_, err := NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	defaultInputs.Extracts[0].Type = EXTRACT_TYPE_STRING
+	defaultInputs.Extracts[2].JsonType = "string"
+	_, err = NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	// Output:
+	// ["42" "1.50" "+5" "true" "TRUE" "1.2"]
+	// {"Splits":["count={} count={} count={} enabled={} enabled={} version={}"],"Extracts":[42,1.50,"+5",true,"TRUE","1.2"]}
+	// []
+	// Extract JsonType cannot be used with Type: number
+	// Extract JsonType is not valid: string
+}
+
+// ExampleNdjsonFormatter_outputColumnNames shows how OutputColumnNames rename the output
+// columns, in the Schema and as the NDJSON keys, independent of the input columns. Columns
+// without a name keep the default name.
+func ExampleNdjsonFormatter_outputColumnNames() {
+	inputs := Inputs{ExpectedFieldCount: 3, IngestTimestampFormat: time.RFC3339,
+		OutputColumnNames: []string{"time", "", "message", "ingested"}}
+	scnr, _ := NewScanner(inputs)
+	fmt.Println(scnr.OutputColumnNames())
+	formatter := NdjsonFormatter{ColumnNames: scnr.OutputColumnNames(), Scanner: scnr}
+	fmt.Println(formatter.Format("serial1", []string{"12:00", "INFO", "started", "2023-10-07T12:00:00Z"}, nil, ""))
+
+	inputs.OutputColumnNames = []string{"time", "time"}
+	_, err := NewScanner(inputs)
+	fmt.Println(err)
+
+	// Output:
+	// [time column1 message ingested]
+	// {"UniqueId":"serial1","Columns":{"time":"12:00","column1":"INFO","message":"started","ingested":"2023-10-07T12:00:00Z"},"Extracts":[]}
+	// OutputColumnNames is not valid, duplicate name: time
+}
+
+// TestVerifyHashes verifies a corrupted value, or hashes computed with a different algorithm, are
+// reported as mismatches, for hashes files with and without counts.
+func TestVerifyHashes(t *testing.T) {
+	hashCounts := make(map[string]int)
+	hashMap := make(map[string]string)
+	for i, value := range []string{"status|info|val={}", "notification|debug|Unit {}", "status|info|other {}"} {
+		hash, _ := Hash(value, HASH_FORMAT_STRING)
+		hashCounts[hash] = i + 1
+		hashMap[hash] = value
+	}
+	var sb strings.Builder
+	if err := WriteHashes(&sb, "|", "\n", hashCounts, hashMap); err != nil {
+		t.Fatalf("calling WriteHashes: %s", err)
+	}
+	corrupted := strings.Replace(sb.String(), "Unit {}", "Unit  {}", 1)
+
+	mismatches, err := VerifyHashes(strings.NewReader(corrupted), HASH_FORMAT_STRING, HASH_ALGORITHM_MD5)
+	if err != nil {
+		t.Fatalf("calling VerifyHashes: %s", err)
+	}
+	if len(mismatches) != 1 || !strings.Contains(mismatches[0], "value: notification|debug|Unit  {}") {
+		t.Errorf("wrong mismatches: %q", mismatches)
+	}
+
+	// All hashes mismatch with a different algorithm.
+	mismatches, err = VerifyHashes(strings.NewReader(sb.String()), HASH_FORMAT_STRING, HASH_ALGORITHM_DJB2)
+	if err != nil || len(mismatches) != 3 {
+		t.Errorf("wrong mismatches with djb2: %q, error: %v", mismatches, err)
+	}
+
+	// Hashes files without counts are verified the same way.
+	sb.Reset()
+	if err := WriteHashValues(&sb, "|", "\n", hashCounts, hashMap); err != nil {
+		t.Fatalf("calling WriteHashValues: %s", err)
+	}
+	corrupted = strings.Replace(sb.String(), "Unit {}", "Unit  {}", 1)
+	mismatches, err = VerifyHashes(strings.NewReader(corrupted), HASH_FORMAT_STRING, HASH_ALGORITHM_MD5)
+	if err != nil || len(mismatches) != 1 || !strings.Contains(mismatches[0], "value: notification|debug|Unit  {}") {
+		t.Errorf("wrong mismatches without counts: %q, error: %v", mismatches, err)
+	}
+}
+
+// ExampleScanner_SplitAnnotated shows the delimiters matched by the InputDelimiter, marked in the
+// row, to help develop the InputDelimiter.
+func ExampleScanner_SplitAnnotated() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.InputDelimiter = `\s\s+`
+	scnr, _ := NewScanner(*defaultInputs)
+	fmt.Println(scnr.SplitAnnotated("2023-10-07 12:00:00.00 MDT  0    notification  multi word type   message"))
+
+	// Output:
+	// 2023-10-07 12:00:00.00 MDT«  »0«    »notification«  »multi word type«   »message
+}
+
+// ExampleScanner_Extract_emitTemplate shows how EmitTemplate adds the tokenized column as an
+// extract, after the other extracts.
+func ExampleScanner_Extract_emitTemplate() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{1}, RegexString: `(version = )(\S+)`, Token: "${1}{}", Submatch: 2},
+		{Columns: []int{1}, RegexString: `(release=)(\S+)`, Token: "${1}{}", Submatch: 2, EmitTemplate: true},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	splits := []string{"sw_b", "Info SW version = 1.2.34 release=a.1.1"}
+	extracts, _ := scnr.Extract(splits)
+	fmt.Printf("extracts: %q\nsplits: %q\n", extracts, splits)
+
+	// Output:
+	// extracts: ["1.2.34" "a.1.1" "Info SW version = {} release={}"]
+	// splits: ["sw_b" "Info SW version = {} release={}"]
+}
+
+// ExampleScanner_Filter_caseInsensitive shows how FilterCaseInsensitive makes the PositiveFilter
+// match regardless of case.
+func ExampleScanner_Filter_caseInsensitive() {
+	rows := []string{"2023-10-07 ERROR disk full", "2023-10-07 info started", "2023-10-07 Error retrying"}
+	for _, caseInsensitive := range []bool{false, true} {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.PositiveFilter = `error`
+		defaultInputs.FilterCaseInsensitive = caseInsensitive
+		scnr, _ := NewScanner(*defaultInputs)
+		kept := []string{}
+		for _, row := range rows {
+			if !scnr.Filter(row) {
+				kept = append(kept, row)
+			}
+		}
+		fmt.Printf("case insensitive: %t, kept: %q\n", caseInsensitive, kept)
+	}
+
+	// Output:
+	// case insensitive: false, kept: []
+	// case insensitive: true, kept: ["2023-10-07 ERROR disk full" "2023-10-07 Error retrying"]
+}
+
+// ExampleScanner_Extract_fixedColumnsDefault shows how ExtractFixedColumns outputs one value per
+// Extract, the first match, with the Default when the Extract does not match.
+func ExampleScanner_Extract_fixedColumnsDefault() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.ExtractFixedColumns = true
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, RegexString: `(version=)(\S+)`, Token: "${1}{}", Submatch: 2, Default: "unknown"},
+		{Columns: []int{0}, RegexString: `(count=)(\d+)`, Token: "${1}{}", Submatch: 2, Default: "0"},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range []string{"start version=1.2.34 count=3 count=4", "start count=7", "start"} {
+		extracts, _ := scnr.Extract([]string{row})
+		fmt.Printf("%q\n", extracts)
+	}
+
+	// Output:
+	// ["1.2.34" "3"]
+	// ["unknown" "7"]
+	// ["unknown" "0"]
+}
+
+// ExampleScanner_Extract_json shows JSON objects embedded in a column extracted, either whole or
+// as the values of JsonKeys, with nested braces and braces in strings handled.
+func ExampleScanner_Extract_json() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, Json: true, JsonKeys: []string{"code", "msg"}, Name: "error", Token: "{json}", Type: EXTRACT_TYPE_STRING},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	row := []string{`2023-10-07 ERROR {"code":500,"msg":"x {not json}","detail":{"retry":true}} done`}
+	extracts, errs := scnr.Extract(row)
+	fmt.Printf("%q %q %v\n", extracts, row[0], errs)
+
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, Json: true, JsonKeys: []string{"code"}, Token: "{json}", Type: EXTRACT_TYPE_NUMBER},
+	}
+	scnr, _ = NewScanner(*defaultInputs)
+	extracts, _ = scnr.Extract([]string{`2023-10-07 ERROR {"code":500,"msg":"x"}`})
+	fmt.Printf("%q %q\n", extracts, scnr.ExtractTypes())
+
+	defaultInputs.Extracts = []*Extract{{Columns: []int{0}, Json: true, Token: "{json}"}}
+	scnr, _ = NewScanner(*defaultInputs)
+	extracts, _ = scnr.Extract([]string{`{unbalanced {"a": "}"} {"b":[1, 2]}`})
+	fmt.Printf("%q\n", extracts)
+
+	// Output:
+	// ["500" "x {not json}"] "2023-10-07 ERROR {json} done" []
+	// ["500"] ["number"]
+	// ["{\"a\": \"}\"}" "{\"b\":[1, 2]}"]
+}
+
+// ExampleScanner_PreProcess shows rows URL decoded and unescaped by the PreProcessors before
+// splitting; a row that cannot be decoded is kept, and an error is returned.
+func ExampleScanner_PreProcess() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.InputDelimiter = " "
+	defaultInputs.ExpectedFieldCount = 4
+	defaultInputs.PreProcessors = []string{PRE_URLDECODE}
+	scnr, _ := NewScanner(*defaultInputs)
+	row, err := scnr.PreProcess("GET /search?q=caf%C3%A9+menu%21 200")
+	splits, _ := scnr.Split(scnr.Replace(row))
+	fmt.Printf("%q %v\n", splits, err)
+
+	row, err = scnr.PreProcess("bad %zz encoding")
+	fmt.Printf("%q %v\n", row, err)
+
+	defaultInputs.PreProcessors = []string{PRE_UNESCAPE, PRE_JSON_UNESCAPE}
+	scnr, _ = NewScanner(*defaultInputs)
+	row, _ = scnr.PreProcess(`tab:\t hex:\x41 quote:\' \\u00e9 "bare"`)
+	fmt.Printf("%q\n", row)
+
+	defaultInputs.PreProcessors = []string{"base64"}
+	_, err = NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	// Output:
+	// ["GET" "/search?q=café" "menu!" "200"] <nil>
+	// "bad %zz encoding" value: bad %zz encoding, urldecode: invalid URL escape "%zz"
+	// "tab:\t hex:A quote:' é \"bare\""
+	// PreProcessor is not valid: base64
+}
+
+// ExampleScanner_Explode shows a row exploded into one row per match of the Extract with
+// Explode, and that only one Extract can Explode, without RowId.
+func ExampleScanner_Explode() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, RegexString: `(host=)(\w+)`, Token: "${1}{}", Submatch: 2},
+		{Columns: []int{0}, Explode: true, RegexString: `(id=)(\d+)`, Token: "${1}{}", Submatch: 2, Type: EXTRACT_TYPE_NUMBER},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	extracts, _ := scnr.Extract([]string{"batch id=1 id=2 id=3 host=a"})
+	fmt.Printf("%q %q\n", scnr.Explode(extracts), scnr.ExtractTypes())
+
+	extracts, _ = scnr.Extract([]string{"batch host=b"})
+	fmt.Printf("%q\n", scnr.Explode(extracts))
+
+	defaultInputs.RowId = true
+	_, err := NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	defaultInputs.RowId = false
+	defaultInputs.Extracts[0].Explode = true
+	_, err = NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	// Output:
+	// [["a" "1"] ["a" "2"] ["a" "3"]] ["" "number"]
+	// [["b"]]
+	// RowId is not valid with an Extract that can Explode
+	// only one Extract can Explode, found: 2
+}
+
+// ExampleScanner_Extract_fullMatch shows how Submatch 0 returns the full match, including text
+// matched outside of any group, and the full match is replaced with the Token.
+func ExampleScanner_Extract_fullMatch() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0}, RegexString: `(user|uid)=\w+`, Submatch: 0, Token: "{}"},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	row := []string{"login user=bob from uid=42"}
+	extracts, errors := scnr.Extract(row)
+	fmt.Printf("extracts: %q, row: %q, errors: %v\n", extracts, row, errors)
+
+	// Output:
+	// extracts: ["user=bob" "uid=42"], row: ["login {} from {}"], errors: []
+}
+
+// ExampleScanner_Extract_between shows how Between extracts the text between markers, without a
+// regex, and replaces the markers and text with the Token.
+func ExampleScanner_Extract_between() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Between: [2]string{"[", "]"}, Columns: []int{1}, Token: "[{}]"},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range [][]string{{"12:00", "worker [pool-1] started [job 7]"}, {"12:01", "no markers ] ["}} {
+		extracts, errors := scnr.Extract(row)
+		fmt.Printf("extracts: %q, row: %q, errors: %v\n", extracts, row, errors)
+	}
+
+	defaultInputs.Extracts = []*Extract{{Between: [2]string{"[", ""}, Columns: []int{1}}}
+	_, err := NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	// Output:
+	// extracts: ["pool-1" "job 7"], row: ["12:00" "worker [{}] started [{}]"], errors: []
+	// extracts: [], row: ["12:01" "no markers ] ["], errors: []
+	// Extract Between requires start and end markers: ["[" ""]
+}
+
+// ExampleScanner_Extract_fullRow shows how a FullRow Extract matches a value that the input
+// delimiter split across columns, replacing it with the Token in the column where it starts.
+func ExampleScanner_Extract_fullRow() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{FullRow: true, Name: "msg", RegexString: `msg=(\w+ \w+)`, Submatch: 1, Token: "msg={}"},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range [][]string{
+		{"12:00", "ERROR", "msg=disk", "full", "on", "sda1"},
+		{"12:01", "INFO", "msg=disk ok"},
+		{"12:02", "INFO", "started"},
+	} {
+		results, errors := scnr.ExtractResults(row)
+		fmt.Printf("results: %+v, row: %q, errors: %v\n", results, row, errors)
+	}
+	fmt.Printf("%+v\n", scnr.ExtractCoverage())
+
+	defaultInputs.Extracts = []*Extract{{FullRow: true, Json: true}}
+	_, err := NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	// Output:
+	// results: [{Column:2 Value:disk full}], row: ["12:00" "ERROR" "msg={}" "" "on" "sda1"], errors: []
+	// results: [{Column:2 Value:disk ok}], row: ["12:01" "INFO" "msg={}"], errors: []
+	// results: [], row: ["12:02" "INFO" "started"], errors: []
+	// [{Attempts:3 Column:-1 Extract:msg Matches:2}]
+	// Extract FullRow requires RegexString, without Json or Between
+}
+
+// ExampleScanner_ExtractOverlaps shows how an Extract matching the Token inserted by an earlier
+// Extract is reported: the "kv" Extract tokenizes "count=3" before the "count" Extract runs, so
+// "count" extracts the Token instead of the value.
+func ExampleScanner_ExtractOverlaps() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{1}, Name: "kv", RegexString: `(\w+=)(\w+)`, Submatch: 2, Token: "${1}<KV>"},
+		{Columns: []int{1}, Name: "count", RegexString: `count=(\S+)`, Submatch: 1, Token: "count={}"},
+		{Columns: []int{1}, Name: "ip", RegexString: `\d+\.\d+\.\d+\.\d+`, Token: "<IP>"},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range [][]string{{"12:00", "retry count=3 user=bob for 10.0.0.3"}, {"12:01", "retry count=4"},
+		{"12:02", "from 10.0.0.4"}} {
+		extracts, _ := scnr.Extract(row)
+		fmt.Printf("extracts: %q, row: %q\n", extracts, row)
+	}
+	fmt.Printf("%+v\n", scnr.ExtractOverlaps())
+
+	// Output:
+	// extracts: ["3" "bob" "<KV>" "10.0.0.3"], row: ["12:00" "retry count={} user=<KV> for <IP>"]
+	// extracts: ["4" "<KV>"], row: ["12:01" "retry count={}"]
+	// extracts: ["10.0.0.4"], row: ["12:02" "from <IP>"]
+	// [{Column:1 Extract:count Rows:2 TokenOf:kv}]
+}
+
+// ExampleScanner_Extract_mask shows how MASK_KEEP_LAST partially redacts extracted values,
+// keeping the last MaskKeepLast characters.
+func ExampleScanner_Extract_mask() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{1}, Mask: MASK_KEEP_LAST, MaskKeepLast: 4, RegexString: `card=(\d+)`, Submatch: 1, Token: "card={}"},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	row := []string{"12:00", "payment card=4111111111111234 short card=123"}
+	extracts, errors := scnr.Extract(row)
+	fmt.Printf("extracts: %q, row: %q, errors: %v\n", extracts, row, errors)
+
+	defaultInputs.Extracts[0].Mask = "MASK_ALL"
+	_, err := NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	// Output:
+	// extracts: ["************1234" "123"], row: ["12:00" "payment card={} short card={}"], errors: []
+	// Extract Mask is not valid: MASK_ALL, MaskKeepLast: 4
+}
+
+// ExampleScanner_Extract_delta shows how a Delta Extract returns the per row delta of a cumulative
+// counter, separately for each delta key (I.E. unique ID).
+func ExampleScanner_Extract_delta() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.ExtractFixedColumns = true
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{1}, Default: "0", Delta: true, RegexString: `bytes=(\S+)`, Submatch: 1, Token: "bytes={}"},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, keyCounter := range [][2]string{{"a", "100"}, {"a", "150"}, {"b", "7"}, {"a", "400"}, {"b", "10"},
+		{"a", "20"}, {"a", "20.5"}, {"a", "x"}} {
+		scnr.SetDeltaKey(keyCounter[0])
+		row := []string{"12:00", "bytes=" + keyCounter[1]}
+		extracts, errors := scnr.Extract(row)
+		fmt.Printf("key: %s, counter: %s, extracts: %q, errors: %v\n", keyCounter[0], keyCounter[1], extracts, errors)
+	}
+
+	defaultInputs.ExtractCacheSize = 10
+	_, err := NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	// Output:
+	// key: a, counter: 100, extracts: ["0"], errors: []
+	// key: a, counter: 150, extracts: ["50"], errors: []
+	// key: b, counter: 7, extracts: ["0"], errors: []
+	// key: a, counter: 400, extracts: ["250"], errors: []
+	// key: b, counter: 10, extracts: ["3"], errors: []
+	// key: a, counter: 20, extracts: ["-380"], errors: []
+	// key: a, counter: 20.5, extracts: ["0.5"], errors: []
+	// key: a, counter: x, extracts: ["x"], errors: [column 1, value: x, Delta: value is not a number]
+	// Extract Delta cannot be used with ExtractCacheSize
+}
+
+// ExampleScanner_Extract_dedupExtractsPerRow shows how a value matched by two Extracts is
+// output only once when DedupExtractsPerRow is set.
+func ExampleScanner_Extract_dedupExtractsPerRow() {
+	for _, dedup := range []bool{false, true} {
+		defaultInputs, _ := NewInputs("./test/testInputs.json")
+		defaultInputs.DedupExtractsPerRow = dedup
+		defaultInputs.Extracts = []*Extract{
+			{Columns: []int{0}, RegexString: `(host=)(\S+)`, Token: "${1}{}", Submatch: 2},
+			{Columns: []int{1}, RegexString: `(peer=)(\S+)`, Token: "${1}{}", Submatch: 2},
+			{Columns: []int{1}, RegexString: `(port=)(\d+)`, Token: "${1}{}", Submatch: 2},
+		}
+		scnr, _ := NewScanner(*defaultInputs)
+		extracts, _ := scnr.Extract([]string{"host=db1", "peer=db1 port=5432"})
+		fmt.Printf("dedup: %t, extracts: %q\n", dedup, extracts)
+	}
+
+	// Output:
+	// dedup: false, extracts: ["db1" "db1" "5432"]
+	// dedup: true, extracts: ["db1" "5432"]
+}
+
+// ExampleScanner_ExtractResults shows how the column each value was extracted from is returned
+// with the value, for an Extract that runs on multiple columns.
+func ExampleScanner_ExtractResults() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.ExtractFixedColumns = true
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0, 2}, RegexString: `(id=)(\d+)`, Token: "${1}{}", Submatch: 2},
+		{Columns: []int{1}, Default: "none", RegexString: `(user=)(\w+)`, Token: "${1}{}", Submatch: 2},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range [][]string{{"id=1", "user=bob", "x"}, {"x", "y", "id=2"}} {
+		results, errors := scnr.ExtractResults(row)
+		fmt.Printf("results: %+v, errors: %v\n", results, errors)
+	}
+
+	// Output:
+	// results: [{Column:0 Value:1} {Column:1 Value:bob}], errors: []
+	// results: [{Column:2 Value:2} {Column:-1 Value:none}], errors: []
+}
+
+// ExampleScanner_ExtractCoverageReport shows how often each Extract matched in each of its
+// columns, to find Extracts that never match.
+func ExampleScanner_ExtractCoverageReport() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.Extracts = []*Extract{
+		{Columns: []int{0, 1}, Name: "version", RegexString: `(version=)(\S+)`, Token: "${1}{}", Submatch: 2},
+		{Columns: []int{1, 5}, RegexString: `(count=)(\d+)`, Token: "${1}{}", Submatch: 2},
+	}
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range [][]string{{"version=1.2", "count=3"}, {"version=1.3", "count=x"}, {"start", "count=4"}} {
+		scnr.Extract(row)
+	}
+	fmt.Print(scnr.ExtractCoverageReport())
+
+	// Output:
+	// extract: version, column: 0, attempts: 3, matches: 2, percent: 66.7
+	// extract: version, column: 1, attempts: 3, matches: 0, percent: 0.0, NEVER MATCHED
+	// extract: extract1, column: 1, attempts: 3, matches: 2, percent: 66.7
+	// extract: extract1, column: 5, attempts: 0, matches: 0, percent: 0.0
+}
+
+// ExampleExtract_priority shows how Priority makes Extracts evaluate in the same order regardless
+// of their order in the inputs.
+func ExampleExtract_priority() {
+	// The IP Extract must be evaluated before the number Extract, which would otherwise
+	// tokenize the octets.
+	extracts := []string{
+		`{"Columns": [0], "Name": "number", "RegexString": "\\b\\d+\\b", "Token": "{n}"}`,
+		`{"Columns": [0], "Name": "ip", "Priority": 10, "RegexString": "\\d+\\.\\d+\\.\\d+\\.\\d+", "Token": "{ip}"}`,
+	}
+	for _, order := range [][]int{{0, 1}, {1, 0}} {
+		inputsJson := fmt.Sprintf(`{"Extracts": [%s, %s], "PrefixExtractsWithName": true}`, extracts[order[0]], extracts[order[1]])
+		var inputs Inputs
+		if err := json.Unmarshal([]byte(inputsJson), &inputs); err != nil {
+			fmt.Println(err)
+			return
+		}
+		scnr, _ := NewScanner(inputs)
+		row := []string{"connect from 10.0.0.1 port 22"}
+		extracted, _ := scnr.Extract(row)
+		fmt.Printf("%q %q\n", extracted, row[0])
+	}
+
+	// Output:
+	// ["ip=10.0.0.1" "number=22"] "connect from {ip} port {n}"
+	// ["ip=10.0.0.1" "number=22"] "connect from {ip} port {n}"
+}
+
+// ExampleScanner_SplitsExcludeHashColumns_individually shows how HashColumnsIndividually replaces
+// each hash column with its own hash, and counts the hashes for each column.
+func ExampleScanner_SplitsExcludeHashColumns_individually() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.HashColumns = []int{0, 2}
+	defaultInputs.HashColumnsIndividually = true
+	defaultInputs.OutputDelimiter = "|"
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, splits := range [][]string{{"a", "1", "x"}, {"a", "2", "y"}, {"b", "3", "x"}} {
+		hashed, _ := scnr.SplitsExcludeHashColumns(splits, HASH_FORMAT_STRING)
+		fmt.Println(strings.Join(hashed, "|"))
+	}
+	for _, column := range defaultInputs.HashColumns {
+		for _, hash := range SortedHashMapCounts(scnr.ColumnHashCounts[column]) {
+			fmt.Printf("column: %d, hash: %s, count: %d, value: %s\n", column, hash,
+				scnr.ColumnHashCounts[column][hash], scnr.ColumnHashMap[column][hash])
+		}
+	}
+
+	fmt.Printf("all hashes: %d\n", len(scnr.HashCounts))
+
+	// Output:
+	// '0x0cc175b9c0f1b6a831c399e269772661'|1|'0x9dd4e461268c8034f5c8564e155c67a6'
+	// '0x0cc175b9c0f1b6a831c399e269772661'|2|'0x415290769594460e2e485922904f345d'
+	// '0x92eb5ffee6ae2fec3ad71c777531578f'|3|'0x9dd4e461268c8034f5c8564e155c67a6'
+	// column: 0, hash: '0x0cc175b9c0f1b6a831c399e269772661', count: 2, value: a
+	// column: 0, hash: '0x92eb5ffee6ae2fec3ad71c777531578f', count: 1, value: b
+	// column: 2, hash: '0x9dd4e461268c8034f5c8564e155c67a6', count: 2, value: x
+	// column: 2, hash: '0x415290769594460e2e485922904f345d', count: 1, value: y
+	// all hashes: 4
+}
+
+// ExampleScanner_Split_fieldCountPad shows how FIELD_COUNT_PAD pads short rows, and truncates long
+// rows, to the ExpectedFieldCount, returning ErrFieldCountPadded.
+func ExampleScanner_Split_fieldCountPad() {
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.InputDelimiter = ","
+	defaultInputs.ExpectedFieldCount = 3
+	defaultInputs.FieldCountPolicy = FIELD_COUNT_PAD
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range []string{"a,b", "a,b,c", "a,b,c,d"} {
+		splits, err := scnr.Split(row)
+		fmt.Printf("%q %v %t\n", splits, err, errors.Is(err, ErrFieldCountPadded))
+	}
+
+	// Output:
+	// ["a" "b" ""] Split field count padded, expectedFieldCount: 3, actual: 2 true
+	// ["a" "b" "c"] <nil> false
+	// ["a" "b" "c"] Split field count padded, expectedFieldCount: 3, actual: 4 true
+}
+
+// ExampleRegisterUniqueIdFunc shows how a registered function can derive the unique ID from
+// two captures, the serial number and the slot, that a single regex capture cannot combine.
+func ExampleRegisterUniqueIdFunc() {
+	serialSlotRegex := regexp.MustCompile(`serial=(\w+).*slot=(\d+)`)
+	RegisterUniqueIdFunc("serialSlot", func(row string) string {
+		match := serialSlotRegex.FindStringSubmatch(row)
+		if match == nil {
+			return ""
+		}
+		return match[1] + "-" + match[2]
+	})
+
+	defaultInputs, _ := NewInputs("./test/testInputs.json")
+	defaultInputs.UniqueIdFunc = "serialSlot"
+	scnr, _ := NewScanner(*defaultInputs)
+	for _, row := range []string{"boot serial=AB12 fw=3.1 slot=4", "no id here"} {
+		fmt.Printf("unique ID: %q\n", scnr.UniqueId(row))
+	}
+
+	defaultInputs.UniqueIdFunc = "missing"
+	_, err := NewScanner(*defaultInputs)
+	fmt.Println(err)
+
+	// Output:
+	// unique ID: "AB12-4"
+	// unique ID: ""
+	// UniqueIdFunc is not registered: missing
+}
+
+// extractCacheInputs returns inputs with Extracts on two columns, and rows where the Extract
+// column values repeat, as in high repetition logs, but the other columns do not.
+func extractCacheInputs(cacheSize int) (Inputs, [][]string) {
+	inputs := Inputs{
+		ExtractCacheSize: cacheSize,
+		Extracts: []*Extract{
+			{Columns: []int{1, 2}, Name: "kv", RegexString: `(\w+=)(\w+)`, Token: "${1}{}", Submatch: 2},
+			{Columns: []int{2}, Name: "ip", OutputTag: "network", RegexString: `\d+\.\d+\.\d+\.\d+`, Token: "{ip}"},
+			{Columns: []int{2}, Explode: true, Name: "id", RegexString: `(id:)(\d+)`, Token: "${1}{}", Submatch: 2},
+			{Columns: []int{2}, Name: "count", RegexString: `(count=)(\S+)`, Submatch: 2, Token: "${1}{}", Type: EXTRACT_TYPE_NUMBER},
+		},
+	}
+	messages := []string{
+		"connect from 10.0.0.1 user=bob id:1 id:2",
+		"disconnect from 10.0.0.2 user=alice reason=timeout",
+		"retry count=3 for 10.0.0.3",
+		"retry count=x for 10.0.0.3",
+		"heartbeat",
+	}
+	var rows [][]string
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, []string{fmt.Sprintf("2023-10-07 12:00:%02d.%03d", i/1000, i%1000),
+			fmt.Sprintf("level=%d", i%2), messages[(i*7)%len(messages)]})
+	}
+	// A short row, so a missing Extract column is cached too.
+	rows = append(rows, []string{"2023-10-07 12:00:02.000", "level=1"})
+	return inputs, rows
+}
+
+// TestScanner_Extract_cache verifies the cached results are identical to uncached results,
+// including the rows with matches replaced, types, columns, exploded values, and coverage, with
+// a cache small enough that entries are evicted. A FullRow Extract is cached on all columns.
+func TestScanner_Extract_cache(t *testing.T) {
+	for _, test := range []struct {
+		cacheSize int
+		fullRow   bool
+	}{{2, false}, {100, false}, {2, true}, {100, true}} {
+		cacheSize := test.cacheSize
+		inputs, rows := extractCacheInputs(0)
+		if test.fullRow {
+			inputs.Extracts = append(inputs.Extracts, &Extract{FullRow: true, Name: "user", RegexString: `user=\w+`, Token: "{}"})
+			rows = append(rows, slices.Clone(rows[0]), slices.Clone(rows[0]))
+		}
+		uncached, err := NewScanner(inputs)
+		if err != nil {
+			t.Fatalf("calling NewScanner: %s", err)
+		}
+		inputs.ExtractCacheSize = cacheSize
+		cached, err := NewScanner(inputs)
+		if err != nil {
+			t.Fatalf("calling NewScanner: %s", err)
+		}
+
+		for i, row := range rows {
+			uncachedRow, cachedRow := slices.Clone(row), slices.Clone(row)
+			uncachedResults, uncachedErrors := uncached.ExtractResults(uncachedRow)
+			uncachedTypes := slices.Clone(uncached.ExtractTypes())
+			cachedResults, cachedErrors := cached.ExtractResults(cachedRow)
+			if !reflect.DeepEqual(uncachedResults, cachedResults) || !reflect.DeepEqual(uncachedRow, cachedRow) ||
+				!reflect.DeepEqual(uncachedTypes, cached.ExtractTypes()) ||
+				!reflect.DeepEqual(uncached.TaggedExtracts(), cached.TaggedExtracts()) ||
+				fmt.Sprint(uncachedErrors) != fmt.Sprint(cachedErrors) {
+				t.Fatalf("cacheSize: %d, row: %d, uncached: %+v %q %q %v, cached: %+v %q %q %v", cacheSize, i,
+					uncachedResults, uncachedRow, uncachedTypes, uncachedErrors,
+					cachedResults, cachedRow, cached.ExtractTypes(), cachedErrors)
+			}
+
+			uncachedExtracts, _ := uncached.Extract(slices.Clone(row))
+			cachedExtracts, _ := cached.Extract(slices.Clone(row))
+			if !reflect.DeepEqual(uncached.Explode(uncachedExtracts), cached.Explode(cachedExtracts)) {
+				t.Fatalf("cacheSize: %d, row: %d, exploded extracts differ", cacheSize, i)
+			}
+		}
+		if !reflect.DeepEqual(uncached.ExtractCoverage(), cached.ExtractCoverage()) {
+			t.Errorf("cacheSize: %d, coverage, uncached: %+v, cached: %+v", cacheSize, uncached.ExtractCoverage(),
+				cached.ExtractCoverage())
+		}
+		if !reflect.DeepEqual(uncached.ExtractOverlaps(), cached.ExtractOverlaps()) {
+			t.Errorf("cacheSize: %d, overlaps, uncached: %+v, cached: %+v", cacheSize, uncached.ExtractOverlaps(),
+				cached.ExtractOverlaps())
+		}
+		if got := cached.extractCache.order.Len(); got > cacheSize {
+			t.Errorf("cacheSize: %d, entries: %d", cacheSize, got)
+		}
+	}
+}
+
+// BenchmarkScanner_Extract_cache compares Extract with and without the cache, on rows where
+// the Extract column values repeat.
+func BenchmarkScanner_Extract_cache(b *testing.B) {
+	for _, cacheSize := range []int{0, 64} {
+		b.Run(fmt.Sprintf("cacheSize=%d", cacheSize), func(b *testing.B) {
+			inputs, rows := extractCacheInputs(cacheSize)
+			scnr, err := NewScanner(inputs)
+			if err != nil {
+				b.Fatalf("calling NewScanner: %s", err)
+			}
+			row := make([]string, 3)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				row = append(row[:0], rows[i%len(rows)]...)
+				scnr.Extract(row)
+			}
+		})
+	}
+}
+
+// TestRateLimiter verifies the rate of a burst of rows, from concurrent callers, stays near the
+// limit, and that a negative MaxRowsPerSecond is not valid.
+func TestRateLimiter(t *testing.T) {
+	rate, callers, rows := 1000, 4, 2000
+	limiter := NewRateLimiter(rate)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rows/callers; j++ {
+				limiter.Wait()
+			}
+		}()
+	}
+	wg.Wait()
+	// The initial burst allows the measured rate to be slightly over the limit.
+	measured := float64(rows) / time.Since(start).Seconds()
+	if measured < 0.9*float64(rate) || measured > 1.1*float64(rate) {
+		t.Errorf("rate: %d, measured: %.0f", rate, measured)
+	}
+
+	if _, err := NewScanner(Inputs{MaxRowsPerSecond: -1}); err == nil ||
+		err.Error() != "MaxRowsPerSecond is not valid: -1" {
+		t.Errorf("expected MaxRowsPerSecond error, got: %v", err)
+	}
+}
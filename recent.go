@@ -0,0 +1,87 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// recentPath is the HTTP path used to query the recentRows.
+	recentPath = "/recent"
+	// recentDefaultRows is the number of rows returned when the query does not specify n.
+	recentDefaultRows = 100
+)
+
+// recentRows is a ring buffer holding the most recent parsed output rows, from all threads,
+// so operators can inspect live parsing via HTTP; see ServeHTTP. recentRows implements
+// io.StringWriter so it can be used as a rowOutput writer.
+type recentRows struct {
+	mutex sync.Mutex
+	next  int
+	rows  []string
+	size  int
+}
+
+// newRecentRows returns a recentRows that keeps the most recent size rows.
+func newRecentRows(size int) *recentRows {
+	return &recentRows{rows: make([]string, 0, size), size: size}
+}
+
+// WriteString adds a row to the buffer, replacing the oldest row when the buffer is full.
+// A trailing newline is removed.
+func (rr *recentRows) WriteString(row string) (int, error) {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	trimmed := strings.TrimRight(row, "\r\n")
+	if len(rr.rows) < rr.size {
+		rr.rows = append(rr.rows, trimmed)
+	} else {
+		rr.rows[rr.next] = trimmed
+	}
+	rr.next = (rr.next + 1) % rr.size
+	return len(row), nil
+}
+
+// recent returns up to n of the most recent rows, oldest first.
+func (rr *recentRows) recent(n int) []string {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	n = min(n, len(rr.rows))
+	out := make([]string, 0, n)
+	if n == 0 {
+		return out
+	}
+	// The newest row is before next, which is len(rr.rows) until the buffer is full.
+	start := (rr.next - n + len(rr.rows)) % len(rr.rows)
+	for i := 0; i < n; i++ {
+		out = append(out, rr.rows[(start+i)%len(rr.rows)])
+	}
+	return out
+}
+
+// ServeHTTP handles GET /recent?n=100, returning the n most recent rows, oldest first, one per line.
+func (rr *recentRows) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n := recentDefaultRows
+	if nString := r.URL.Query().Get("n"); nString != "" {
+		var err error
+		n, err = strconv.Atoi(nString)
+		if err != nil || n < 0 {
+			http.Error(w, "n must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, row := range rr.recent(n) {
+		w.Write([]byte(row + "\n"))
+	}
+}
@@ -0,0 +1,70 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/paulfdunn/go-helper/logh"
+)
+
+// spooledRows holds the rows for the recent rows and syslog outputs in a temporary file in the
+// dataDirectory while a data file is processed, so the rows are only sent once the data file has
+// been read to the end; rows from an attempt that is retried (see Inputs.ScanErrorRetries) are
+// not sent. Rows are quoted, one per line, so rows can contain newlines.
+type spooledRows struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// newSpooledRows creates the spool file for the data file fileName.
+func newSpooledRows(fileName string) (*spooledRows, error) {
+	file, err := os.CreateTemp(dataDirectory, fileName+".*.spool"+lockedFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	return &spooledRows{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// WriteString adds a row to the spool.
+func (sr *spooledRows) WriteString(row string) (int, error) {
+	if _, err := sr.writer.WriteString(strconv.Quote(row) + "\n"); err != nil {
+		return 0, err
+	}
+	return len(row), nil
+}
+
+// send writes the spooled rows, in order, to each of the writers.
+func (sr *spooledRows) send(writers []io.StringWriter) error {
+	if err := sr.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := sr.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(sr.file)
+	scanner.Buffer(nil, maxOutputRowSize)
+	for scanner.Scan() {
+		row, err := strconv.Unquote(scanner.Text())
+		if err != nil {
+			return err
+		}
+		for _, writer := range writers {
+			if _, err := writer.WriteString(row); err != nil {
+				lpf(logh.Error, "writing spooled row: %s", err)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// close closes and removes the spool file.
+func (sr *spooledRows) close() {
+	sr.file.Close()
+	os.Remove(sr.file.Name())
+}
@@ -0,0 +1,66 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"io/fs"
+	"time"
+
+	"github.com/paulfdunn/go-helper/logh"
+)
+
+// stableFiles defers processing of files in the DataDirectory that may still be being written,
+// so a partial file is not processed and moved to the ProcessedInputDirectory. A file is stable
+// when its size and modification time have not changed for the interval, across sweeps of the
+// DataDirectory.
+type stableFiles struct {
+	interval time.Duration
+	seen     map[string]fileState
+}
+
+// fileState is the size and modification time of a file, and when they were first seen.
+type fileState struct {
+	modTime time.Time
+	since   time.Time
+	size    int64
+}
+
+// newStableFiles returns a stableFiles where files are stable once unchanged for interval.
+func newStableFiles(interval time.Duration) *stableFiles {
+	return &stableFiles{interval: interval, seen: make(map[string]fileState)}
+}
+
+// filter returns the files that are stable at now; other files are deferred to a later sweep.
+// Files that are no longer in the DataDirectory are forgotten. Directories, and files that cannot
+// be stat'ed, are returned unchanged.
+func (sf *stableFiles) filter(files []fs.DirEntry, now time.Time) []fs.DirEntry {
+	stable := make([]fs.DirEntry, 0, len(files))
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || file.IsDir() {
+			stable = append(stable, file)
+			continue
+		}
+		present[file.Name()] = true
+		state, ok := sf.seen[file.Name()]
+		if !ok || state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+			sf.seen[file.Name()] = fileState{modTime: info.ModTime(), since: now, size: info.Size()}
+			lpf(logh.Debug, "file is not stable, deferred: %s", file.Name())
+			continue
+		}
+		if now.Sub(state.since) < sf.interval {
+			lpf(logh.Debug, "file is not stable, deferred: %s", file.Name())
+			continue
+		}
+		stable = append(stable, file)
+	}
+	for name := range sf.seen {
+		if !present[name] {
+			delete(sf.seen, name)
+		}
+	}
+	return stable
+}
@@ -0,0 +1,117 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paulfdunn/go-helper/logh"
+)
+
+const (
+	// syslogLocal is the syslog address for the local syslog daemon, at syslogLocalPath.
+	syslogLocal     = "local"
+	syslogLocalPath = "/dev/log"
+	// syslogTimeFormat is the RFC5424 TIMESTAMP format; at most microseconds are allowed.
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+var (
+	// Syslog facility and severity names, and their RFC5424 codes.
+	syslogFacilities = map[string]int{"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+		"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "local0": 16, "local1": 17,
+		"local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23}
+	syslogSeverities = map[string]int{"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5,
+		"info": 6, "debug": 7}
+)
+
+// syslogWriter forwards parsed output rows, from all threads, to a syslog endpoint as RFC5424
+// messages, one row per message. syslogWriter implements io.StringWriter so it can be used as a
+// rowOutput writer. Messages sent over TCP are framed with octet counting (RFC6587); messages
+// sent over a unix stream socket are terminated with a newline; datagrams are not framed.
+type syslogWriter struct {
+	conn      net.Conn
+	errLogged bool
+	hostname  string
+	mutex     sync.Mutex
+	network   string
+	priority  int
+}
+
+// newSyslogWriter connects to address, which is syslogLocal or a URL with a scheme of udp or tcp
+// (I.E. udp://localhost:514), and returns a syslogWriter that sends messages with the facility and
+// severity names.
+func newSyslogWriter(address string, facility string, severity string) (*syslogWriter, error) {
+	facilityCode, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("invalid syslog facility: %s", facility)
+	}
+	severityCode, ok := syslogSeverities[severity]
+	if !ok {
+		return nil, fmt.Errorf("invalid syslog severity: %s", severity)
+	}
+	sw := &syslogWriter{hostname: "-", priority: facilityCode*8 + severityCode}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		sw.hostname = hostname
+	}
+
+	var err error
+	if address == syslogLocal {
+		// The local daemon listens on a datagram socket on most systems; a stream socket otherwise.
+		for _, network := range []string{"unixgram", "unix"} {
+			if sw.conn, err = net.Dial(network, syslogLocalPath); err == nil {
+				sw.network = network
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return sw, nil
+	}
+	network, hostPort, ok := strings.Cut(address, "://")
+	if !ok || (network != "udp" && network != "tcp") {
+		return nil, fmt.Errorf("invalid syslog address: %s", address)
+	}
+	if sw.conn, err = net.Dial(network, hostPort); err != nil {
+		return nil, err
+	}
+	sw.network = network
+	return sw, nil
+}
+
+// WriteString sends a row as a syslog message. A trailing newline is removed. Only the first
+// error is logged, as a syslog endpoint that is down would otherwise log an error for every row.
+func (sw *syslogWriter) WriteString(row string) (int, error) {
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", sw.priority, time.Now().UTC().Format(syslogTimeFormat),
+		sw.hostname, appName, os.Getpid(), strings.TrimRight(row, "\r\n"))
+	switch sw.network {
+	case "tcp":
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	case "unix":
+		msg += "\n"
+	}
+
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	if _, err := sw.conn.Write([]byte(msg)); err != nil {
+		if !sw.errLogged {
+			sw.errLogged = true
+			lpf(logh.Error, "writing to syslog: %s", err)
+		}
+		return 0, err
+	}
+	return len(row), nil
+}
+
+// close closes the connection to the syslog endpoint.
+func (sw *syslogWriter) close() error {
+	return sw.conn.Close()
+}
@@ -0,0 +1,88 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulfdunn/go-helper/logh"
+	"github.com/paulfdunn/go-parser/parser"
+)
+
+// taggedExtractWriters writes the values of Extracts with an OutputTag (see Scanner.TaggedExtracts)
+// to one file per tag, named <DATA_FILE_NAME>.<tag>.extracts.txt in the dataDirectory. Each line is
+// the unique ID followed by the values for the tag from one row, separated by the OutputDelimiter;
+// rows without values for the tag are not written. A nil *taggedExtractWriters writes nothing.
+type taggedExtractWriters struct {
+	delimiter string
+	files     map[string]*os.File
+	newline   string
+	writers   map[string]*bufio.Writer
+}
+
+// newTaggedExtractWriters creates the locked files for the OutputTags of scnr, for the data file
+// fileName. nil is returned when no Extract has an OutputTag.
+func newTaggedExtractWriters(scnr *parser.Scanner, fileName string) (*taggedExtractWriters, error) {
+	if len(scnr.OutputTags()) == 0 {
+		return nil, nil
+	}
+	tew := &taggedExtractWriters{delimiter: scnr.OutputDelimiter, files: make(map[string]*os.File),
+		newline: scnr.Newline(), writers: make(map[string]*bufio.Writer)}
+	for _, tag := range scnr.OutputTags() {
+		file, err := os.Create(taggedExtractsFilePath(fileName, tag) + lockedFileSuffix)
+		if err != nil {
+			tew.close(false)
+			return nil, err
+		}
+		lpf(logh.Info, "%s extracts output file: %s", tag, file.Name())
+		tew.files[tag] = file
+		tew.writers[tag] = bufio.NewWriter(file)
+	}
+	return tew, nil
+}
+
+// taggedExtractsFilePath returns the path of the output file for the tag, for the data file fileName.
+func taggedExtractsFilePath(fileName string, tag string) string {
+	return filepath.Join(dataDirectory, fileName+"."+tag+taggedExtractsFileSuffix)
+}
+
+// write writes the tagged extracts from one row, with the uniqueId.
+func (tew *taggedExtractWriters) write(uniqueId string, tagged map[string][]string) error {
+	if tew == nil {
+		return nil
+	}
+	for tag, values := range tagged {
+		if len(values) == 0 {
+			continue
+		}
+		line := uniqueId + tew.delimiter + strings.Join(values, tew.delimiter) + tew.newline
+		if _, err := tew.writers[tag].WriteString(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close flushes and closes all files, and removes the lockedFileSuffix when rename is true.
+func (tew *taggedExtractWriters) close(rename bool) {
+	if tew == nil {
+		return
+	}
+	for tag, file := range tew.files {
+		if err := tew.writers[tag].Flush(); err != nil {
+			lpf(logh.Error, "calling Flush: %s", err)
+		}
+		file.Close()
+		if !rename {
+			continue
+		}
+		if err := os.Rename(file.Name(), strings.TrimSuffix(file.Name(), lockedFileSuffix)); err != nil {
+			lpf(logh.Error, "calling os.Rename, output file left locked: %s", err)
+		}
+	}
+}
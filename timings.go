@@ -0,0 +1,75 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Pipeline stages that are timed by stageTimings.
+const (
+	stageScan = iota
+	stagePreProcess
+	stageFilter
+	stageReplace
+	stageSplit
+	stageExtract
+	stageHash
+	stageWrite
+	stageCount
+)
+
+var stageNames = [stageCount]string{"scan", "preprocess", "filter", "replace", "split", "extract", "hash", "write"}
+
+// stageTimings accumulates the time spent in each pipeline stage for a data file, for
+// performance tuning. A nil *stageTimings records nothing, so timing has little overhead
+// when it is not enabled. Scan time is the time spent waiting for rows from the Scanner.
+type stageTimings struct {
+	calls     [stageCount]int64
+	durations [stageCount]time.Duration
+}
+
+// start returns the start time for the first stage to record, or the zero time when st is nil.
+func (st *stageTimings) start() time.Time {
+	if st == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// record adds the time since start to the stage, and sets start to now for the next stage.
+func (st *stageTimings) record(stage int, start *time.Time) {
+	if st == nil {
+		return
+	}
+	now := time.Now()
+	st.calls[stage]++
+	st.durations[stage] += now.Sub(*start)
+	*start = now
+}
+
+// report returns the total time for each stage that ran, one per line, with the number of
+// times the stage ran and the percent of the total time for all stages.
+func (st *stageTimings) report() string {
+	var total time.Duration
+	for _, duration := range st.durations {
+		total += duration
+	}
+	var sb strings.Builder
+	for stage, duration := range st.durations {
+		if st.calls[stage] == 0 {
+			continue
+		}
+		percent := 0.0
+		if total > 0 {
+			percent = 100 * float64(duration) / float64(total)
+		}
+		fmt.Fprintf(&sb, "stage: %s, calls: %d, total: %s, percent: %.1f\n", stageNames[stage], st.calls[stage],
+			duration, percent)
+	}
+	return sb.String()
+}
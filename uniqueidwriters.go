@@ -0,0 +1,152 @@
+// Author: Paul F. Dunn, https://github.com/paulfdunn/
+// Original source location: https://github.com/paulfdunn/go-parser
+// This code is licensed under the MIT license. Please keep this attribution when
+// replicating/copying/reusing the code.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/paulfdunn/go-helper/logh"
+)
+
+// uniqueIdWriters routes output to one file per unique ID, named
+// <DATA_FILE_NAME>.<uniqueId>.parsed.txt in the dataDirectory; the data file name keeps the
+// output of data files with the same unique ID, processed concurrently, separate. At most maxOpen
+// files are kept open; the least recently used file is closed when another file needs to be
+// opened, and re-opened for append if needed again. Files are tracked by path in created, open,
+// and writers. Output written when the unique ID is empty goes to defaultWriter.
+type uniqueIdWriters struct {
+	created       []string
+	defaultWriter *bufio.Writer
+	fileName      string
+	maxOpen       int
+	newline       string
+	open          []string
+	sql           bool
+	uniqueId      *string
+	writers       map[string]*uniqueIdWriter
+}
+
+type uniqueIdWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+var (
+	// uniqueIdFileNameRegex matches characters that are replaced when using a unique ID as a file name.
+	uniqueIdFileNameRegex = regexp.MustCompile(`[^\w.-]`)
+)
+
+func newUniqueIdWriters(flags flags, uniqueId *string, defaultWriter *bufio.Writer, newline string) *uniqueIdWriters {
+	return &uniqueIdWriters{
+		defaultWriter: defaultWriter,
+		fileName:      flags.dataFileName,
+		maxOpen:       max(flags.splitUniqueIdOpen, 1),
+		newline:       newline,
+		sql:           flags.sqlColumns > 0 && !flags.tee,
+		uniqueId:      uniqueId,
+		writers:       make(map[string]*uniqueIdWriter),
+	}
+}
+
+// WriteString writes s to the file for the current unique ID.
+func (uiw *uniqueIdWriters) WriteString(s string) (int, error) {
+	if *uiw.uniqueId == "" {
+		return uiw.defaultWriter.WriteString(s)
+	}
+	w, err := uiw.writer(uiw.filePath(*uiw.uniqueId))
+	if err != nil {
+		return 0, err
+	}
+	return w.WriteString(s)
+}
+
+// close closes all files, writing the SQL transaction end if needed, and removes the
+// lockedFileSuffix from all files.
+func (uiw *uniqueIdWriters) close() {
+	for _, lockedFilePath := range uiw.created {
+		if uiw.sql {
+			w, err := uiw.writer(lockedFilePath)
+			if err != nil {
+				lpf(logh.Error, "opening unique ID output file: %s", err)
+				continue
+			}
+			w.WriteString(sqlTransactionEnd + uiw.newline)
+		}
+		uiw.closeWriter(lockedFilePath)
+		err := os.Rename(lockedFilePath, strings.TrimSuffix(lockedFilePath, lockedFileSuffix))
+		if err != nil {
+			lpf(logh.Error, "calling os.Rename: %s", err)
+		}
+	}
+}
+
+// closeWriter flushes and closes the file at filePath.
+func (uiw *uniqueIdWriters) closeWriter(filePath string) {
+	uw, ok := uiw.writers[filePath]
+	if !ok {
+		return
+	}
+	if err := uw.writer.Flush(); err != nil {
+		lpf(logh.Error, "calling Flush: %s", err)
+	}
+	uw.file.Close()
+	delete(uiw.writers, filePath)
+	uiw.open = slices.DeleteFunc(uiw.open, func(path string) bool { return path == filePath })
+}
+
+// filePath returns the locked path of the output file for uniqueId. When characters of the unique
+// ID are replaced to make a file name, a hash of the unique ID is added, so unique IDs that only
+// differ in replaced characters (I.E. "a/b" and "a b") do not share a file.
+func (uiw *uniqueIdWriters) filePath(uniqueId string) string {
+	name := uniqueIdFileNameRegex.ReplaceAllString(uniqueId, "_")
+	if name != uniqueId {
+		h := fnv.New32a()
+		h.Write([]byte(uniqueId))
+		name += fmt.Sprintf("_%08x", h.Sum32())
+	}
+	return filepath.Join(dataDirectory, uiw.fileName+"."+name+parsedOutputFileSuffix+lockedFileSuffix)
+}
+
+// writer returns the writer for the file at filePath, opening the file if needed. Files are
+// truncated when first opened, and appended to when re-opened.
+func (uiw *uniqueIdWriters) writer(filePath string) (*bufio.Writer, error) {
+	if uw, ok := uiw.writers[filePath]; ok {
+		// Move to the end of the open list as the most recently used.
+		uiw.open = append(slices.DeleteFunc(uiw.open, func(path string) bool { return path == filePath }), filePath)
+		return uw.writer, nil
+	}
+
+	if len(uiw.open) >= uiw.maxOpen {
+		uiw.closeWriter(uiw.open[0])
+	}
+
+	flag := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	created := slices.Contains(uiw.created, filePath)
+	if !created {
+		flag |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(filePath, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	uw := &uniqueIdWriter{file: file, writer: bufio.NewWriter(file)}
+	uiw.writers[filePath] = uw
+	uiw.open = append(uiw.open, filePath)
+	if !created {
+		lpf(logh.Info, "unique ID output file: %s", file.Name())
+		uiw.created = append(uiw.created, filePath)
+		if uiw.sql {
+			uw.writer.WriteString(sqlTransactionBegin + uiw.newline)
+		}
+	}
+	return uw.writer, nil
+}